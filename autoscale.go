@@ -0,0 +1,128 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+var (
+	//ErrBadWorkerLimits is when MinWorkers or MaxWorkers are negative, or MinWorkers is more than MaxWorkers
+	ErrBadWorkerLimits = errors.New("min_workers and max_workers cannot be negative and min_workers cannot be more than max_workers")
+	//ErrAutoscaleNotSupported is when autoscaling a processor with a BatchHandler or in ordered mode
+	ErrAutoscaleNotSupported = errors.New("autoscaling is not supported for BatchHandlers or ordered processors, use workers instead")
+
+	// ScaleInterval is how often autoscaled processors checks their queues
+	ScaleInterval = 1 * time.Second
+	// ScaleUpThreshold is how full a queue has to be, between 0 and 1, for a worker to be added
+	ScaleUpThreshold = 0.75
+	// ScaleDownThreshold is how empty a queue has to be, between 0 and 1, for a worker to be retired
+	ScaleDownThreshold = 0.25
+	// ScaleDownChecks is how many checks in a row the queue has to be below ScaleDownThreshold before a worker is retired
+	// Workers are added right away but retired slowly, so a queue that goes up and down does not make workers come and go all the time
+	ScaleDownChecks = 3
+)
+
+// autoscaling returns true if the processor should scale its workers between MinWorkers and MaxWorkers
+func (p *Processor) autoscaling() bool {
+	return p.MaxWorkers > 0
+}
+
+// validateWorkerLimits makes sure MinWorkers and MaxWorkers can be used
+func (p *Processor) validateWorkerLimits() error {
+	if p.MinWorkers < 0 || p.MaxWorkers < 0 || (p.MaxWorkers > 0 && p.MinWorkers > p.MaxWorkers) {
+		return ErrBadWorkerLimits
+	}
+	return nil
+}
+
+// minWorkers returns the MinWorkers, but always at least one
+func (p *Processor) minWorkers() int {
+	if p.MinWorkers < 1 {
+		return 1
+	}
+	return p.MinWorkers
+}
+
+// trackWorker adds a worker to the workers metric, the returned func removes it again
+func (p *Processor) trackWorker() func() {
+	atomic.AddInt64(&p.running, 1)
+	p.Metric.IncrementMetric(p.metricName("workers"), 1)
+	return func() {
+		p.Metric.IncrementMetric(p.metricName("workers"), -1)
+		atomic.AddInt64(&p.running, -1)
+	}
+}
+
+// runAutoscaled is used instead of runHandle when autoscaling, it runs the workers of a subscription
+// Workers are added when the queue is filled above ScaleUpThreshold and retired when it stays below ScaleDownThreshold
+// The workers are left as they are while the processor is paused
+func (p *Processor) runAutoscaled(ctx context.Context, jobs *pubsub.Pipe) {
+	defer p.workers.Done()
+	maxWorkers := p.MaxWorkers
+	queueSize := p.QueueSize
+	if queueSize <= 0 {
+		queueSize = cap(jobs.Flow)
+	}
+
+	var workers sync.WaitGroup
+	// retire makes the worker that reads it stop
+	retire := make(chan struct{}, maxWorkers)
+	running := 0
+	start := func() {
+		running++
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer p.trackWorker()()
+			p.consume(ctx, jobs, retire, func(pay payload.Payload) {
+				p.handlePayload(ctx, p.emitter(), pay)
+			})
+		}()
+	}
+	for running < p.minWorkers() {
+		start()
+	}
+
+	ticker := time.NewTicker(ScaleInterval)
+	defer ticker.Stop()
+	below := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.drain:
+			workers.Wait()
+			return
+		case <-ctx.Done():
+			workers.Wait()
+			return
+		}
+		if p.pauseGate() != nil {
+			// The queue fills up because nothing is read while paused, more workers would not help
+			below = 0
+			continue
+		}
+		fill := float64(len(jobs.Flow)) / float64(queueSize)
+		switch {
+		case fill >= ScaleUpThreshold:
+			below = 0
+			if running < maxWorkers {
+				start()
+			}
+		case fill <= ScaleDownThreshold && running > p.minWorkers():
+			below++
+			if below >= ScaleDownChecks {
+				below = 0
+				running--
+				retire <- struct{}{}
+			}
+		default:
+			below = 0
+		}
+	}
+}
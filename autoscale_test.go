@@ -0,0 +1,125 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+func TestValidateWorkerLimits(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Min         int
+		Max         int
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "NoAutoscaling"},
+		{Name: "Autoscaling", Min: 1, Max: 4},
+		{Name: "OnlyMax", Max: 4},
+		{Name: "NegativeMin", Min: -1, Max: 4, ExpectedErr: ErrBadWorkerLimits},
+		{Name: "NegativeMax", Max: -1, ExpectedErr: ErrBadWorkerLimits},
+		{Name: "MinAboveMax", Min: 5, Max: 4, ExpectedErr: ErrBadWorkerLimits},
+	}
+
+	for _, tc := range testCases {
+		p := NewProcessor(tc.Name)
+		p.MinWorkers = tc.Min
+		p.MaxWorkers = tc.Max
+		if err := p.validateWorkerLimits(); !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+	}
+}
+
+// waitForWorkers polls the running workers until it has the expected value
+func waitForWorkers(p *Processor, expected int64) bool {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if p.RunningWorkers() == expected {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestAutoscale(t *testing.T) {
+	interval := ScaleInterval
+	ScaleInterval = 10 * time.Millisecond
+	defer func() {
+		ScaleInterval = interval
+	}()
+
+	handler := newSlowHandler()
+	p := NewProcessor("autoscaled")
+	p.SetHandler(handler)
+	p.QueueSize = 40
+	p.MinWorkers = 1
+	p.MaxWorkers = 4
+	if err := p.Subscribe("autoscaled_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !waitForWorkers(p, 1) {
+		t.Fatal("the processor should start with MinWorkers")
+	}
+
+	for i := 0; i < 40; i++ {
+		pubsub.Publish("autoscaled_topic", payload.NewBasePayload([]byte(`scale me`), "test", nil))
+	}
+	if !waitForWorkers(p, 4) {
+		t.Fatal("a full queue should scale up to MaxWorkers")
+	}
+	if !waitForWorkers(p, 1) {
+		t.Fatal("an empty queue should scale down to MinWorkers")
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handled := atomic.LoadInt32(&handler.handled); handled != 40 {
+		t.Fatal("all payloads should be handled: ", handled)
+	}
+	if !waitForWorkers(p, 0) {
+		t.Fatal("a stopped processor has no workers")
+	}
+
+	// A paused processor should not scale up on its full queue
+	paused := NewProcessor("autoscaled_paused")
+	paused.SetHandler(newSlowHandler())
+	paused.QueueSize = 40
+	paused.MinWorkers = 1
+	paused.MaxWorkers = 4
+	if err := paused.Subscribe("autoscaled_paused_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := paused.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := paused.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		pubsub.Publish("autoscaled_paused_topic", payload.NewBasePayload([]byte(`wait`), "test", nil))
+	}
+	time.Sleep(10 * ScaleInterval)
+	if workers := paused.RunningWorkers(); workers != 1 {
+		t.Fatal("a paused processor should not scale up: ", workers)
+	}
+	paused.Stop()
+
+	batched := NewProcessor("autoscaled_batch")
+	batched.SetHandler(newBatchHandler())
+	batched.MaxWorkers = 2
+	if err := batched.Start(context.Background()); !errors.Is(err, ErrAutoscaleNotSupported) {
+		t.Fatal("expected ErrAutoscaleNotSupported: ", err)
+	}
+}
@@ -0,0 +1,59 @@
+package go4data
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	//ErrBadBatchConfig is when a BatchConfig has negative values
+	ErrBadBatchConfig = errors.New("the batch config is not valid, size, bytes and linger cannot be negative")
+
+	// DefaultBatchSize is how many payloads a batch holds if no Size is configured
+	DefaultBatchSize = 100
+	// DefaultBatchLinger is how long to wait for a batch to fill up if no Linger is configured
+	DefaultBatchLinger = 1 * time.Second
+)
+
+// BatchConfig decides how Processors with a BatchHandler collects payloads into batches
+// A batch is handled as soon as any of the limits is reached
+type BatchConfig struct {
+	// Size is the max amount of payloads in a batch, defaults to DefaultBatchSize
+	Size int `json:"size" yaml:"size"`
+	// Bytes is the max amount of payload bytes in a batch, 0 means no limit
+	Bytes int `json:"bytes" yaml:"bytes"`
+	// Linger is how long to wait after the first payload in a batch before the batch is handled, defaults to DefaultBatchLinger
+	Linger time.Duration `json:"linger" yaml:"linger"`
+}
+
+// Validate is used to make sure the BatchConfig can be used
+func (bc *BatchConfig) Validate() error {
+	if bc.Size < 0 || bc.Bytes < 0 || bc.Linger < 0 {
+		return ErrBadBatchConfig
+	}
+	return nil
+}
+
+// size returns the Size or the DefaultBatchSize
+func (bc *BatchConfig) size() int {
+	if bc == nil || bc.Size == 0 {
+		return DefaultBatchSize
+	}
+	return bc.Size
+}
+
+// bytes returns the Bytes limit, 0 is no limit
+func (bc *BatchConfig) bytes() int {
+	if bc == nil {
+		return 0
+	}
+	return bc.Bytes
+}
+
+// linger returns the Linger or the DefaultBatchLinger
+func (bc *BatchConfig) linger() time.Duration {
+	if bc == nil || bc.Linger == 0 {
+		return DefaultBatchLinger
+	}
+	return bc.Linger
+}
@@ -0,0 +1,209 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/metric"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+const (
+	// UnroutedDrop drops payloads emitted on relationships without topics, its the default
+	UnroutedDrop = "drop"
+	// UnroutedError makes EmitTo return handlers.ErrNoRoute for relationships without topics
+	UnroutedError = "error"
+)
+
+var (
+	//ErrBadUnrouted is when Unrouted is set to something else than drop or error
+	ErrBadUnrouted = errors.New("unrouted has to be drop or error")
+	//ErrUnknownRelationship is when mapping topics to a relationship that the Handler does not emit on
+	ErrUnknownRelationship = errors.New("the Handler does not emit on this relationship")
+)
+
+// processorMetrics is the metrics that the processor itself keeps track of, the Handler adds its own
+var processorMetrics = map[string]string{
+	"emitted":           "keeps track of how many payloads the handler has emitted",
+	"retries":           "keeps track of how many times a payload has been retried",
+	"failures":          "keeps track of how many payloads that has been given to the FailureHandler",
+	"throttled_seconds": "keeps track of how many seconds the processor has waited on its rate limit",
+}
+
+// processorGauges is the metrics that the processor keeps track of that can go both up and down
+var processorGauges = map[string]string{
+	"workers": "the amount of workers that are running",
+}
+
+// emitter is the Emitter a Processor gives to its Handler, payloads are published onto the topics of the relationship in the processors Environment
+type emitter struct {
+	p *Processor
+}
+
+// Emit will publish the payloads on the primary relationship
+func (e emitter) Emit(ctx context.Context, payloads ...payload.Payload) {
+	e.p.publish(ctx, e.p.relationshipTopics(e.p.primaryRelationship()), payloads)
+}
+
+// EmitTo will publish the payloads on the topics of a relationship
+func (e emitter) EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error {
+	topics, err := e.p.route(relationship)
+	if err != nil {
+		return err
+	}
+	e.p.publish(ctx, topics, payloads)
+	return nil
+}
+
+// publish will publish the payloads onto the topics, any publishing errors are given to the FailureHandler
+func (p *Processor) publish(ctx context.Context, topics []string, payloads []payload.Payload) {
+	if len(payloads) == 0 {
+		return
+	}
+	p.Metric.IncrementMetric(p.metricName("emitted"), float64(len(payloads)))
+	errs := pubsub.PublishTopicsContext(p.Environment().Context(ctx), topics, payloads...)
+	for _, err := range errs {
+		p.fail(Failure{
+			Err:       err,
+			Payload:   err.Payload,
+			Processor: p.ID,
+		})
+	}
+}
+
+// routeFailure publishes payloads that failed after all attempts on the failure relationship
+// It returns false if the Handler has no failure relationship or it has no topics, the FailureHandler is used then
+func (p *Processor) routeFailure(ctx context.Context, payloads []payload.Payload) bool {
+	router, ok := p.Handler.(handlers.Router)
+	if !ok {
+		return false
+	}
+	for _, relationship := range router.Relationships() {
+		if relationship != handlers.RelationshipFailure {
+			continue
+		}
+		topics := p.relationshipTopics(relationship)
+		if len(topics) == 0 {
+			return false
+		}
+		p.publish(ctx, topics, payloads)
+		return true
+	}
+	return false
+}
+
+// emitter returns the Emitter to give to the Handler
+func (p *Processor) emitter() handlers.Emitter {
+	return emitter{p: p}
+}
+
+// primaryRelationship returns the relationship used by Emit, Topics is always published on it
+func (p *Processor) primaryRelationship() string {
+	if router, ok := p.Handler.(handlers.Router); ok {
+		if relationships := router.Relationships(); len(relationships) != 0 {
+			return relationships[0]
+		}
+	}
+	return handlers.RelationshipSuccess
+}
+
+// relationshipTopics returns the topics a relationship is published on
+func (p *Processor) relationshipTopics(relationship string) []string {
+	topics := p.Relationships[relationship]
+	if relationship == p.primaryRelationship() {
+		topics = append(append([]string{}, p.Topics...), topics...)
+	}
+	return topics
+}
+
+// route returns the topics of a relationship, or handlers.ErrNoRoute if there are none and Unrouted is UnroutedError
+func (p *Processor) route(relationship string) ([]string, error) {
+	topics := p.relationshipTopics(relationship)
+	if len(topics) == 0 && p.Unrouted == UnroutedError {
+		return nil, fmt.Errorf("%s: %w", relationship, handlers.ErrNoRoute)
+	}
+	return topics, nil
+}
+
+// validateRelationships makes sure Unrouted is valid and that all relationships with topics are emitted on by the Handler
+func (p *Processor) validateRelationships() error {
+	if p.Unrouted != "" && p.Unrouted != UnroutedDrop && p.Unrouted != UnroutedError {
+		return fmt.Errorf("%s: %w", p.Unrouted, ErrBadUnrouted)
+	}
+	known := []string{handlers.RelationshipSuccess}
+	if router, ok := p.Handler.(handlers.Router); ok {
+		known = router.Relationships()
+	}
+	for relationship := range p.Relationships {
+		found := false
+		for _, k := range known {
+			if k == relationship {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %w", relationship, ErrUnknownRelationship)
+		}
+	}
+	return nil
+}
+
+// OutputTopics returns all topics the processor can publish on, Topics and the topics of all relationships
+func (p *Processor) OutputTopics() []string {
+	seen := make(map[string]bool)
+	var topics []string
+	add := func(ts []string) {
+		for _, topic := range ts {
+			if !seen[topic] {
+				seen[topic] = true
+				topics = append(topics, topic)
+			}
+		}
+	}
+	add(p.Topics)
+	// Sorted so that the output is the same each time
+	relationships := make([]string, 0, len(p.Relationships))
+	for relationship := range p.Relationships {
+		relationships = append(relationships, relationship)
+	}
+	sort.Strings(relationships)
+	for _, relationship := range relationships {
+		add(p.Relationships[relationship])
+	}
+	return topics
+}
+
+// metricName returns the name of a processor metric
+func (p *Processor) metricName(name string) string {
+	return fmt.Sprintf("%s_%d_%s", p.Name, p.ID, name)
+}
+
+// addMetrics adds the processor metrics to the metric Provider
+func (p *Processor) addMetrics() error {
+	for name, description := range processorMetrics {
+		err := p.Metric.AddMetric(&metric.Metric{
+			Name:        p.metricName(name),
+			Description: description,
+		})
+		// Metrics are kept when a processor is restarted
+		if err != nil && !errors.Is(err, metric.ErrMetricAlreadyExist) {
+			return err
+		}
+	}
+	for name, description := range processorGauges {
+		err := p.Metric.AddMetric(&metric.Metric{
+			Name:        p.metricName(name),
+			Description: description,
+			Gauge:       true,
+		})
+		if err != nil && !errors.Is(err, metric.ErrMetricAlreadyExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/handlers/terminal"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+)
+
+func TestEmitter(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	p := env.NewProcessor("emitter", "emitter_out")
+	if err := p.addMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		failures []Failure
+		mu       sync.Mutex
+	)
+	p.FailureHandler = func(f Failure) {
+		mu.Lock()
+		failures = append(failures, f)
+		mu.Unlock()
+	}
+	// A queue of 2 makes the third payload fail
+	out, err := env.Engine.Subscribe("emitter_out", 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.emitter().Emit(context.Background())
+	p.emitter().Emit(context.Background(),
+		payload.NewBasePayload([]byte(`1`), "test", nil),
+		payload.NewBasePayload([]byte(`2`), "test", nil),
+		payload.NewBasePayload([]byte(`3`), "test", nil),
+	)
+
+	if len(out.Flow) != 2 {
+		t.Fatal("the emitted payloads should be published on the processors topics, got ", len(out.Flow))
+	}
+	if emitted := p.Metric.GetMetric(p.metricName("emitted")); emitted == nil || emitted.Value != 3 {
+		t.Fatal("the emitted payloads should be counted")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failures) != 1 {
+		t.Fatal("publishing errors should be given to the FailureHandler, got ", len(failures))
+	}
+	if string(failures[0].Payload.GetPayload()) != "3" {
+		t.Fatal("the failure should carry the payload that could not be published")
+	}
+
+	// Restarting a processor adds the metrics again
+	if err := p.addMetrics(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type routeHandler struct {
+	handlers.Handler
+}
+
+func (rh *routeHandler) Relationships() []string {
+	return []string{"even", "odd"}
+}
+
+func TestRelationships(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	p := env.NewProcessor("relationships", "route_even")
+	p.Handler = &routeHandler{}
+	p.Relationships = map[string][]string{"odd": {"route_odd"}, "even": {"route_even_too"}}
+	if err := p.validateRelationships(); err != nil {
+		t.Fatal(err)
+	}
+	if topics := p.OutputTopics(); len(topics) != 3 {
+		t.Fatal("all relationship topics should be outputs: ", topics)
+	}
+	even, _ := env.Engine.Subscribe("route_even", 100, 10)
+	evenToo, _ := env.Engine.Subscribe("route_even_too", 100, 10)
+	odd, _ := env.Engine.Subscribe("route_odd", 100, 10)
+
+	e := p.emitter()
+	e.Emit(context.Background(), payload.NewBasePayload([]byte(`2`), "test", nil))
+	if err := e.EmitTo(context.Background(), "odd", payload.NewBasePayload([]byte(`1`), "test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(even.Flow) != 1 || len(evenToo.Flow) != 1 {
+		t.Fatal("Emit should publish on Topics and the topics of the primary relationship")
+	}
+	if len(odd.Flow) != 1 {
+		t.Fatal("EmitTo should publish on the topics of the relationship")
+	}
+
+	// Unrouted relationships
+	if err := e.EmitTo(context.Background(), "nowhere", payload.NewBasePayload([]byte(`3`), "test", nil)); err != nil {
+		t.Fatal("unrouted payloads should be dropped by default: ", err)
+	}
+	p.Unrouted = UnroutedError
+	if err := e.EmitTo(context.Background(), "nowhere", payload.NewBasePayload([]byte(`3`), "test", nil)); !errors.Is(err, handlers.ErrNoRoute) {
+		t.Fatal("expected ErrNoRoute: ", err)
+	}
+
+	p.Relationships = map[string][]string{"success": {"route_even"}}
+	if err := p.validateRelationships(); !errors.Is(err, ErrUnknownRelationship) {
+		t.Fatal("expected ErrUnknownRelationship: ", err)
+	}
+	p.Relationships = nil
+	p.Unrouted = "explode"
+	if err := p.validateRelationships(); !errors.Is(err, ErrBadUnrouted) {
+		t.Fatal("expected ErrBadUnrouted: ", err)
+	}
+}
+
+func TestRouteFailure(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	exec := terminal.NewExecCMDHandler()
+	exec.GetConfiguration().SetProperty("command", "false")
+	// Using the payload as an argument makes it subscribe
+	exec.GetConfiguration().SetProperty("arguments", []string{"payload"})
+	p := env.NewProcessor("routefailure")
+	p.SetHandler(exec)
+	p.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	var failures int32
+	p.FailureHandler = func(f Failure) {
+		atomic.AddInt32(&failures, 1)
+	}
+	if err := p.Subscribe("routefailure_in"); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := env.Engine.Subscribe("routefailure_failed", 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// Without topics on the failure relationship the FailureHandler is used
+	env.Engine.Publish("routefailure_in", payload.NewBasePayload([]byte(`fail`), "test", property.NewConfiguration()))
+	for i := 0; i < 100 && atomic.LoadInt32(&failures) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&failures) != 1 {
+		t.Fatal("the FailureHandler should be used when the failure relationship has no topics")
+	}
+
+	p.Stop()
+	p.Relationships = map[string][]string{handlers.RelationshipFailure: {"routefailure_failed"}}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	input := payload.NewBasePayload([]byte(`fail`), "test", property.NewConfiguration())
+	env.Engine.Publish("routefailure_in", input)
+	select {
+	case pay := <-failed.Flow:
+		if pay.GetMetaData().GetProperty("exec_error") == nil {
+			t.Fatal("the error should be added to the failed payload")
+		}
+		if input.GetMetaData().GetProperty("exec_error") != nil {
+			t.Fatal("the error should be added to a copy and not the input")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the failed payload should be published on the failure relationship")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(failed.Flow) != 0 || atomic.LoadInt32(&failures) != 1 {
+		t.Fatal("the failed payload should only be routed once, after the last attempt")
+	}
+}
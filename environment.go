@@ -0,0 +1,240 @@
+package go4data
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/metric"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+	"github.com/percybolmer/go4data/pubsub"
+	"github.com/percybolmer/go4data/register"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Environment is what a flow of processors share, the pubsub Engine, the Handlers that can be loaded, processor IDs and metrics
+// Processors from different Environments never see each others payloads, which allows many isolated flows, or parallel tests, in one binary
+// Fields that are nil falls back to the process-wide defaults used by NewProcessor, Load and the pubsub package
+type Environment struct {
+	// Engine is the pubsub Engine that processors subscribe and publish through
+	Engine pubsub.Engine
+	// Registry is the Handlers that can be loaded by name
+	Registry *register.Registry
+	// IDs is used to give processors unique IDs
+	IDs *IDAllocator
+	// Metrics is the prometheus registry that processors register their metrics in
+	Metrics *prometheus.Registry
+	// Events is where processors publishes their Events
+	Events *EventBus
+}
+
+// IDAllocator is used to make sure no processors are generated with a ID that already exists
+type IDAllocator struct {
+	last uint
+	sync.Mutex
+}
+
+// defaultEnvironment uses the process-wide defaults, its used by NewProcessor, Load and LoadPipeline
+var defaultEnvironment = &Environment{}
+
+// NewID is used to generate a new ID, the first ID is 1
+func (ia *IDAllocator) NewID() uint {
+	ia.Lock()
+	defer ia.Unlock()
+	ia.last++
+	return ia.last
+}
+
+// NewEnvironment creates an Environment that is isolated from the process-wide defaults
+// It gets its own DefaultEngine, a Registry with all Handlers Registered so far, its own IDs, a new prometheus registry and its own EventBus
+// Close should be called when the Environment is no longer used
+func NewEnvironment() *Environment {
+	return &Environment{
+		Engine:   pubsub.NewDefaultEngine(2),
+		Registry: register.NewRegistry(),
+		IDs:      &IDAllocator{},
+		Metrics:  prometheus.NewRegistry(),
+		Events:   NewEventBus(),
+	}
+}
+
+// Close will cancel the Engine of the Environment, the process-wide Engine is never cancelled
+func (env *Environment) Close() {
+	if env.Engine != nil {
+		env.Engine.Cancel()
+	}
+}
+
+// NewProcessor is used to spawn a new processor that belongs to the Environment
+// See the package level NewProcessor
+func (env *Environment) NewProcessor(name string, topics ...string) *Processor {
+	proc := &Processor{
+		ID:             env.newID(),
+		Name:           name,
+		FailureHandler: PrintFailure,
+		Handler:        nil,
+		Workers:        1,
+		subscriptions:  make([]*pubsub.Pipe, 0),
+		Topics:         make([]string, 0),
+		QueueSize:      DefaultQueueSize,
+		Metric:         metric.NewPrometheusProviderWithRegisterer(env.registerer()),
+		env:            env,
+	}
+	if len(topics) != 0 {
+		proc.Topics = append(proc.Topics, topics...)
+	}
+
+	return proc
+}
+
+// Load will return a slice of processors, that belongs to the Environment, loaded from a config
+func (env *Environment) Load(path string) ([]*Processor, error) {
+	procs, err := LoadLoaders(path)
+	if err != nil {
+		return nil, err
+	}
+	var realproc []*Processor
+	for _, proc := range procs {
+		rp, err := proc.convert(env)
+		if err != nil {
+			return nil, err
+		}
+		realproc = append(realproc, rp)
+	}
+	return realproc, nil
+}
+
+// GetHandler is used to get a new copy of a Handler from the Registry of the Environment
+func (env *Environment) GetHandler(name string) (handlers.Handler, error) {
+	var (
+		handler handlers.Handler
+		err     error
+	)
+	if env.Registry != nil {
+		handler, err = env.Registry.GetHandler(name)
+	} else {
+		handler, err = register.GetHandler(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return handler, nil
+}
+
+// GetFailureHandler is used to create a Registered FailureHandler that works within the Environment
+func (env *Environment) GetFailureHandler(name string, cfg *property.Configuration) (func(f Failure), error) {
+	factory, ok := FailureHandlerRegister[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrFailureHandlerNotRegistered)
+	}
+	if cfg == nil {
+		cfg = property.NewConfiguration()
+	}
+	return factory(env, cfg)
+}
+
+// SubscribeEvents returns a stream of Events from all processors in the Environment
+// See EventBus.Subscribe
+func (env *Environment) SubscribeEvents(buffer int) (<-chan Event, func()) {
+	return env.events().Subscribe(buffer)
+}
+
+// Publish will push payloads onto a topic in the Engine of the Environment
+func (env *Environment) Publish(key string, payloads ...payload.Payload) []pubsub.PublishingError {
+	return env.engine().Publish(key, payloads...)
+}
+
+// PublishTopics will push payloads onto many topics in the Engine of the Environment
+func (env *Environment) PublishTopics(topics []string, payloads ...payload.Payload) []pubsub.PublishingError {
+	return env.engine().PublishTopics(topics, payloads...)
+}
+
+// Context returns a context that makes Handlers publish through the Engine of the Environment
+func (env *Environment) Context(ctx context.Context) context.Context {
+	if env.Engine == nil {
+		return ctx
+	}
+	return pubsub.WithEngine(ctx, env.Engine)
+}
+
+// engine returns the Engine to use, the process-wide Engine if none is set
+func (env *Environment) engine() pubsub.Engine {
+	if env.Engine != nil {
+		return env.Engine
+	}
+	return pubsub.EngineFrom(nil)
+}
+
+// subscribe will subscribe a processor to a topic in the Engine, as a member of the consumer group if its set
+func (env *Environment) subscribe(key, group string, pid uint, queueSize int) (*pubsub.Pipe, error) {
+	return pubsub.SubscribeGroupTo(env.engine(), key, group, pid, queueSize)
+}
+
+// ack tells the Engine that the payloads has been handled, Engines that does not implement pubsub.Acknowledger do not need to know
+func (env *Environment) ack(payloads []payload.Payload) error {
+	acker, ok := env.engine().(pubsub.Acknowledger)
+	if !ok {
+		return nil
+	}
+	for _, p := range payloads {
+		if err := acker.Ack(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nack tells the Engine that the payloads could not be handled, and returns the payloads that the Engine will not deliver again
+// Engines that does not implement pubsub.Acknowledger never delivers a payload again
+func (env *Environment) nack(payloads []payload.Payload) ([]payload.Payload, error) {
+	acker, ok := env.engine().(pubsub.Acknowledger)
+	if !ok {
+		return payloads, nil
+	}
+	var failed []payload.Payload
+	var firstErr error
+	for _, p := range payloads {
+		again, err := acker.Nack(p)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if !again {
+			failed = append(failed, p)
+		}
+	}
+	return failed, firstErr
+}
+
+// unsubscribe will remove a processors subscription to a topic in the Engine
+func (env *Environment) unsubscribe(key string, pid uint) error {
+	if env.Engine != nil {
+		return env.Engine.Unsubscribe(key, pid)
+	}
+	return pubsub.Unsubscribe(key, pid)
+}
+
+// newID returns the next processor ID
+func (env *Environment) newID() uint {
+	if env.IDs != nil {
+		return env.IDs.NewID()
+	}
+	return NewID()
+}
+
+// registerer returns where metrics should be registered, nil means the prometheus DefaultRegisterer
+func (env *Environment) registerer() prometheus.Registerer {
+	if env.Metrics != nil {
+		return env.Metrics
+	}
+	return nil
+}
+
+// events returns the EventBus to use, the process-wide EventBus if none is set
+func (env *Environment) events() *EventBus {
+	if env.Events != nil {
+		return env.Events
+	}
+	return defaultEventBus
+}
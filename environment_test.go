@@ -0,0 +1,144 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/handlers/terminal"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/pubsub"
+	"github.com/percybolmer/go4data/register"
+)
+
+func TestIDAllocator(t *testing.T) {
+	ids := &IDAllocator{}
+	if id := ids.NewID(); id != 1 {
+		t.Fatal("the first ID should be 1, got ", id)
+	}
+	if id := ids.NewID(); id != 2 {
+		t.Fatal("the second ID should be 2, got ", id)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	global, err := pubsub.Subscribe("env_test_out", NewID(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envs := []*Environment{NewEnvironment(), NewEnvironment()}
+	var outputs []*pubsub.Pipe
+	for i, env := range envs {
+		defer env.Close()
+		// Same name and same ID in both, this would make the prometheus metrics collide in a shared registry
+		proc := env.NewProcessor("envflow", "env_test_out")
+		if proc.ID != 1 {
+			t.Fatal("each Environment should have its own IDs, got ", proc.ID)
+		}
+		if proc.Environment() != env {
+			t.Fatal("the processor does not belong to the Environment")
+		}
+		handler, err := env.GetHandler("Stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		proc.SetHandler(handler)
+		if err := proc.Subscribe("env_test_in"); err != nil {
+			t.Fatal(err)
+		}
+		if err := proc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		out, err := env.Engine.Subscribe("env_test_out", 100, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, out)
+
+		if errs := env.Publish("env_test_in", payload.NewBasePayload([]byte{byte('a' + i)}, "test", nil)); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	for i, out := range outputs {
+		select {
+		case pay := <-out.Flow:
+			if string(pay.GetPayload()) != string([]byte{byte('a' + i)}) {
+				t.Fatal("a payload leaked between Environments: ", string(pay.GetPayload()))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no payload was published in the Environment")
+		}
+		select {
+		case pay := <-out.Flow:
+			t.Fatal("a payload leaked between Environments: ", string(pay.GetPayload()))
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	select {
+	case pay := <-global.Flow:
+		t.Fatal("a payload leaked into the process-wide engine: ", string(pay.GetPayload()))
+	default:
+	}
+
+	for _, env := range envs {
+		families, err := env.Metrics.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(families) == 0 {
+			t.Fatal("the metrics should be registered in the Environment")
+		}
+	}
+}
+
+func TestEnvironmentRegistry(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+	other := NewEnvironment()
+	defer other.Close()
+
+	if err := env.Registry.Register("EnvOnly", terminal.NewStdoutHandler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.GetHandler("EnvOnly"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetHandler("EnvOnly"); !errors.Is(err, register.ErrHandlerNotRegistered) {
+		t.Fatal("a Handler should only be available in the Environment it was Registered in")
+	}
+	if _, err := defaultEnvironment.GetHandler("EnvOnly"); !errors.Is(err, register.ErrHandlerNotRegistered) {
+		t.Fatal("a Handler should only be available in the Environment it was Registered in")
+	}
+}
+
+func TestEnvironmentDeadLetter(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	pipe, err := env.Engine.Subscribe("env_deadletter_topic", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := env.NewProcessor("envdeadletter")
+	if err := proc.SetFailureHandler("deadletter", failureHandlerConfig("topic", "env_deadletter_topic")); err != nil {
+		t.Fatal(err)
+	}
+	proc.FailureHandler(Failure{
+		Err:     errors.New("broken payload"),
+		Payload: payload.NewBasePayload([]byte(`dead`), "test", nil),
+	})
+	select {
+	case pay := <-pipe.Flow:
+		if string(pay.GetPayload()) != "dead" {
+			t.Fatal("wrong payload on the dead letter topic: ", string(pay.GetPayload()))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the dead letter should be published in the Environment of the processor")
+	}
+}
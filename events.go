@@ -0,0 +1,177 @@
+package go4data
+
+import (
+	"sync"
+	"time"
+
+	"github.com/percybolmer/go4data/payload"
+)
+
+// EventType is what happened to a processor
+type EventType string
+
+const (
+	// EventStart is sent when a processor has started
+	EventStart EventType = "start"
+	// EventStop is sent when a processor has stopped
+	EventStop EventType = "stop"
+	// EventValidationFailed is sent when a processor could not start because its settings or the configuration of its Handler is not valid
+	EventValidationFailed EventType = "validation_failed"
+	// EventFailure is sent when a processor gives a Failure to its FailureHandler
+	EventFailure EventType = "failure"
+	// EventPayloadProcessed is sent each time the Handler has handled a payload without errors
+	EventPayloadProcessed EventType = "payload_processed"
+)
+
+// Event is a change in the state of a processor, it is given to the hooks of the processor and published on the EventBus of its Environment
+type Event struct {
+	// Type is what happened
+	Type EventType `json:"type"`
+	// Processor is the ID of the processor
+	Processor uint `json:"processor"`
+	// Name is the name of the processor
+	Name string `json:"name"`
+	// Time is when the Event happened
+	Time time.Time `json:"time"`
+	// Err is the error of EventValidationFailed and EventFailure
+	Err error `json:"-"`
+	// Failure is the Failure given to the FailureHandler, only set for EventFailure
+	Failure *Failure `json:"failure,omitempty"`
+	// Payload is the payload that was handled, only set for EventPayloadProcessed
+	Payload payload.Payload `json:"payload,omitempty"`
+	// Duration is how long it took to handle the payload, only set for EventPayloadProcessed
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// EventBus is a stream of Events from all processors in an Environment
+// Subscribers that are too slow to read the Events miss them, the processors are never blocked by the EventBus
+type EventBus struct {
+	subscribers map[int]chan Event
+	nextID      int
+	sync.RWMutex
+}
+
+// defaultEventBus is the process-wide EventBus used by processors that does not belong to an Environment with its own
+var defaultEventBus = NewEventBus()
+
+// NewEventBus creates an EventBus without any subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// SubscribeEvents returns a stream of Events from all processors that uses the process-wide defaults
+// See EventBus.Subscribe
+func SubscribeEvents(buffer int) (<-chan Event, func()) {
+	return defaultEventBus.Subscribe(buffer)
+}
+
+// Subscribe returns a channel that gets all Events published from now on, buffer is how many Events that can be queued before they are dropped
+// The returned func unsubscribes and closes the channel
+func (eb *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	eb.Lock()
+	defer eb.Unlock()
+	id := eb.nextID
+	eb.nextID++
+	events := make(chan Event, buffer)
+	eb.subscribers[id] = events
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			eb.Lock()
+			delete(eb.subscribers, id)
+			close(events)
+			eb.Unlock()
+		})
+	}
+}
+
+// Publish sends an Event to all subscribers that has room for it
+func (eb *EventBus) Publish(e Event) {
+	eb.RLock()
+	defer eb.RUnlock()
+	for _, events := range eb.subscribers {
+		select {
+		case events <- e:
+		default:
+			// The subscriber is full
+		}
+	}
+}
+
+// hasSubscribers is used to skip building Events that nobody listens to
+func (eb *EventBus) hasSubscribers() bool {
+	eb.RLock()
+	defer eb.RUnlock()
+	return len(eb.subscribers) != 0
+}
+
+// OnStart adds a hook that is called each time the processor is started
+func (p *Processor) OnStart(hook func(e Event)) {
+	p.addHook(EventStart, hook)
+}
+
+// OnStop adds a hook that is called each time the processor is stopped
+func (p *Processor) OnStop(hook func(e Event)) {
+	p.addHook(EventStop, hook)
+}
+
+// OnValidationFailed adds a hook that is called when the processor cannot start because its settings are not valid
+func (p *Processor) OnValidationFailed(hook func(e Event)) {
+	p.addHook(EventValidationFailed, hook)
+}
+
+// OnFailure adds a hook that is called each time the processor gives a Failure to its FailureHandler
+func (p *Processor) OnFailure(hook func(e Event)) {
+	p.addHook(EventFailure, hook)
+}
+
+// OnPayloadProcessed adds a hook that is called each time the Handler has handled a payload without errors
+// The hook is called by the workers, so it should be fast
+func (p *Processor) OnPayloadProcessed(hook func(e Event)) {
+	p.addHook(EventPayloadProcessed, hook)
+}
+
+// addHook stores a hook for an EventType
+func (p *Processor) addHook(t EventType, hook func(e Event)) {
+	p.hooksMu.Lock()
+	defer p.hooksMu.Unlock()
+	if p.hooks == nil {
+		p.hooks = make(map[EventType][]func(e Event))
+	}
+	p.hooks[t] = append(p.hooks[t], hook)
+}
+
+// observed returns true if any hook or EventBus subscriber would get an Event of the type
+func (p *Processor) observed(t EventType) bool {
+	p.hooksMu.RLock()
+	hooked := len(p.hooks[t]) != 0
+	p.hooksMu.RUnlock()
+	return hooked || p.Environment().events().hasSubscribers()
+}
+
+// emitEvent fills in the processor and time of the Event and gives it to the hooks and the EventBus
+func (p *Processor) emitEvent(e Event) {
+	e.Processor = p.ID
+	e.Name = p.Name
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	p.hooksMu.RLock()
+	hooks := p.hooks[e.Type]
+	p.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(e)
+	}
+	p.Environment().events().Publish(e)
+}
+
+// fail gives a Failure to the FailureHandler and sends an EventFailure
+func (p *Processor) fail(f Failure) {
+	if p.observed(EventFailure) {
+		p.emitEvent(Event{Type: EventFailure, Err: f.Err, Failure: &f})
+	}
+	p.FailureHandler(f)
+}
@@ -0,0 +1,144 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+	"github.com/percybolmer/go4data/ratelimit"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	first, unsubscribe := bus.Subscribe(1)
+	second, _ := bus.Subscribe(2)
+
+	bus.Publish(Event{Type: EventStart, Processor: 1})
+	// first is full and should miss this one without blocking
+	bus.Publish(Event{Type: EventStop, Processor: 1})
+
+	if e := <-first; e.Type != EventStart {
+		t.Fatal("wrong event: ", e.Type)
+	}
+	if e := <-second; e.Type != EventStart {
+		t.Fatal("wrong event: ", e.Type)
+	}
+	if e := <-second; e.Type != EventStop {
+		t.Fatal("wrong event: ", e.Type)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-first; ok {
+		t.Fatal("the channel should be closed after unsubscribing")
+	}
+	bus.Publish(Event{Type: EventStart})
+	if len(second) != 1 {
+		t.Fatal("the remaining subscriber should still get events")
+	}
+}
+
+// failOnPurpose fails payloads that says fail
+func failOnPurpose(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	if string(p.GetPayload()) == "fail" {
+		return errors.New("failed on purpose")
+	}
+	return nil
+}
+
+func TestProcessorEvents(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+	stream, unsubscribe := env.SubscribeEvents(10)
+	defer unsubscribe()
+
+	p := env.NewProcessor("events")
+	p.SetHandler(newFuncHandler(failOnPurpose, false))
+	p.FailureHandler = func(f Failure) {}
+
+	var mu sync.Mutex
+	hooked := make(map[EventType]int)
+	hook := func(e Event) {
+		mu.Lock()
+		hooked[e.Type]++
+		mu.Unlock()
+	}
+	p.OnStart(hook)
+	p.OnStop(hook)
+	p.OnValidationFailed(hook)
+	p.OnFailure(hook)
+	p.OnPayloadProcessed(hook)
+
+	p.RateLimit = -1
+	if err := p.Start(context.Background()); !errors.Is(err, ratelimit.ErrBadLimit) {
+		t.Fatal("should not start with a bad rate limit: ", err)
+	}
+	p.RateLimit = 0
+
+	if err := p.Subscribe("events_in"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	env.Publish("events_in", payload.NewBasePayload([]byte(`ok`), "test", nil))
+	env.Publish("events_in", payload.NewBasePayload([]byte(`fail`), "test", nil))
+
+	expected := []EventType{EventValidationFailed, EventStart}
+	var got []Event
+	timeout := time.After(2 * time.Second)
+	for len(got) < 4 {
+		select {
+		case e := <-stream:
+			if e.Processor != p.ID || e.Name != "events" || e.Time.IsZero() {
+				t.Fatalf("event is missing the processor: %+v", e)
+			}
+			got = append(got, e)
+		case <-timeout:
+			t.Fatal("did not get all events: ", got)
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-stream; e.Type != EventStop {
+		t.Fatal("expected a stop event: ", e.Type)
+	}
+
+	for i, want := range expected {
+		if got[i].Type != want {
+			t.Fatalf("event %d should be %s, got %s", i, want, got[i].Type)
+		}
+	}
+	if !errors.Is(got[0].Err, ratelimit.ErrBadLimit) {
+		t.Fatal("validation event should have the error: ", got[0].Err)
+	}
+	// The payloads are handled in any order
+	for _, e := range got[2:] {
+		switch e.Type {
+		case EventPayloadProcessed:
+			if string(e.Payload.GetPayload()) != "ok" {
+				t.Fatal("wrong payload processed: ", string(e.Payload.GetPayload()))
+			}
+		case EventFailure:
+			if e.Err == nil || e.Failure == nil || string(e.Failure.Payload.GetPayload()) != "fail" {
+				t.Fatalf("failure event is missing the failure: %+v", e)
+			}
+		default:
+			t.Fatal("unexpected event: ", e.Type)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, typ := range []EventType{EventStart, EventStop, EventValidationFailed, EventFailure, EventPayloadProcessed} {
+		if hooked[typ] != 1 {
+			t.Fatalf("the %s hook was called %d times", typ, hooked[typ])
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package go4data
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -22,13 +23,50 @@ type Failure struct {
 	Payload payload.Payload `json:"payload"`
 	// Processor is the UUID of the procesor that triggers the Error
 	Processor uint `json:"processor"`
+	// Attempts is how many times the payload was handled before giving up, 0 if the failure is not related to a payload
+	Attempts int `json:"attempts"`
+	// Stack is the stack trace if the failure is from a Handler that panicked
+	Stack string `json:"stack,omitempty"`
 }
 
 // PrintFailure is a FailureHandler
 func PrintFailure(f Failure) {
+	if f.Stack != "" {
+		// The stack trace of a panic is printed after the failure
+		defer fmt.Println(f.Stack)
+	}
 	if f.Payload == nil {
 		fmt.Printf("%s cast by %d with no payload attached\n", f.Err, f.Processor)
 		return
 	}
+	if f.Attempts > 1 {
+		fmt.Printf("%s cast by %d after %d attempts with payload %s\n", f.Err, f.Processor, f.Attempts, f.Payload.GetPayload())
+		return
+	}
 	fmt.Printf("%s cast by %d with payload %s\n", f.Err, f.Processor, f.Payload.GetPayload())
 }
+
+// errString returns the error message, or an empty string if there is no error
+func (f Failure) errString() string {
+	if f.Err == nil {
+		return ""
+	}
+	return f.Err.Error()
+}
+
+// MarshalJSON is used to output the error as a string since errors cannot be marshalled
+func (f Failure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Err       string          `json:"error"`
+		Payload   payload.Payload `json:"payload"`
+		Processor uint            `json:"processor"`
+		Attempts  int             `json:"attempts"`
+		Stack     string          `json:"stack,omitempty"`
+	}{
+		Err:       f.errString(),
+		Payload:   f.Payload,
+		Processor: f.Processor,
+		Attempts:  f.Attempts,
+		Stack:     f.Stack,
+	})
+}
@@ -0,0 +1,142 @@
+package go4data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+)
+
+// FailureHandlerFactory is used to create a new FailureHandler from a configuration
+// env is the Environment of the processor that will use the FailureHandler
+type FailureHandlerFactory func(env *Environment, cfg *property.Configuration) (func(f Failure), error)
+
+// FailureHandlerRegister is used to keep track of all available FailureHandlers that can be selected by name
+// To have a processor use a custom FailureHandler from a yaml it needs to be Registered with RegisterFailureHandler
+var FailureHandlerRegister map[string]FailureHandlerFactory
+
+var (
+	//ErrFailureHandlerAlreadyRegistered is when trying to add a FailureHandler that already is Registered
+	ErrFailureHandlerAlreadyRegistered = errors.New("a FailureHandler with this name is already Registered")
+	//ErrFailureHandlerNotRegistered is when trying to find a FailureHandler that does not exist
+	ErrFailureHandlerNotRegistered = errors.New("the FailureHandler asked for is not Registered")
+	//ErrMissingFailureHandlerProperty is when a FailureHandler is created without a property it needs
+	ErrMissingFailureHandlerProperty = errors.New("the FailureHandler needs additional properties to work")
+)
+
+func init() {
+	FailureHandlerRegister = make(map[string]FailureHandlerFactory)
+	RegisterFailureHandler("print", NewPrintFailureHandler)
+	RegisterFailureHandler("deadletter", NewDeadLetterFailureHandler)
+	RegisterFailureHandler("file", NewFileFailureHandler)
+}
+
+// RegisterFailureHandler is used to register a FailureHandler. If a FailureHandler with that name already exists it will return ErrFailureHandlerAlreadyRegistered
+func RegisterFailureHandler(name string, f FailureHandlerFactory) error {
+	if _, ok := FailureHandlerRegister[name]; ok {
+		return ErrFailureHandlerAlreadyRegistered
+	}
+	FailureHandlerRegister[name] = f
+	return nil
+}
+
+// GetFailureHandler is used to create a Registered FailureHandler with the given configuration
+func GetFailureHandler(name string, cfg *property.Configuration) (func(f Failure), error) {
+	return defaultEnvironment.GetFailureHandler(name, cfg)
+}
+
+// requiredString is used by FailureHandlerFactories to get a string property that has to be set
+func requiredString(cfg *property.Configuration, name string) (string, error) {
+	prop := cfg.GetProperty(name)
+	if prop == nil || prop.Value == nil || prop.String() == "" {
+		return "", fmt.Errorf("%s: %w", name, ErrMissingFailureHandlerProperty)
+	}
+	return prop.String(), nil
+}
+
+// NewPrintFailureHandler returns PrintFailure, it takes no configuration
+func NewPrintFailureHandler(env *Environment, cfg *property.Configuration) (func(f Failure), error) {
+	return PrintFailure, nil
+}
+
+// NewDeadLetterFailureHandler returns a FailureHandler that publishes failed payloads onto a topic in the Environment
+// A copy of the payload is published with the error, processor and attempts added to its metadata, the failed payload is left as it is
+// Properties:
+//
+//	topic - the topic to publish failed payloads onto
+func NewDeadLetterFailureHandler(env *Environment, cfg *property.Configuration) (func(f Failure), error) {
+	topic, err := requiredString(cfg, "topic")
+	if err != nil {
+		return nil, err
+	}
+	return func(f Failure) {
+		pay := deadLetter(f)
+		meta := pay.GetMetaData()
+		setMetaData(meta, "error", "the error that made the payload fail", f.errString())
+		setMetaData(meta, "processor", "the ID of the processor where the payload failed", f.Processor)
+		setMetaData(meta, "attempts", "how many times the payload was handled before it failed", f.Attempts)
+		if errs := env.Publish(topic, pay); len(errs) != 0 {
+			// The dead letter topic is not working, atleast dont lose the failure
+			PrintFailure(f)
+		}
+	}, nil
+}
+
+// deadLetter returns a new payload with the data and a copy of the metadata of the failed payload
+// The failed payload can be shared with other processors, so its metadata cannot be changed
+func deadLetter(f Failure) payload.Payload {
+	if f.Payload == nil {
+		return payload.NewBasePayload(nil, "deadletter", nil)
+	}
+	meta := property.NewConfiguration()
+	if f.Payload.GetMetaData() != nil {
+		meta = f.Payload.GetMetaData().Copy()
+	}
+	source := "deadletter"
+	if base, ok := f.Payload.(*payload.BasePayload); ok {
+		source = base.Source
+	}
+	return payload.NewBasePayload(f.Payload.GetPayload(), source, meta)
+}
+
+// setMetaData adds the property if it does not exist and sets its value
+func setMetaData(meta *property.Configuration, name, description string, value interface{}) {
+	if meta.GetProperty(name) == nil {
+		meta.AddProperty(name, description, false)
+	}
+	meta.SetProperty(name, value)
+}
+
+// NewFileFailureHandler returns a FailureHandler that appends each Failure as a JSON line to a file
+// Properties:
+//
+//	path - the file to write failures to
+func NewFileFailureHandler(env *Environment, cfg *property.Configuration) (func(f Failure), error) {
+	path, err := requiredString(cfg, "path")
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	return func(f Failure) {
+		line, err := json.Marshal(f)
+		if err != nil {
+			PrintFailure(f)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			PrintFailure(f)
+			return
+		}
+		defer file.Close()
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			PrintFailure(f)
+		}
+	}, nil
+}
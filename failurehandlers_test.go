@@ -0,0 +1,116 @@
+package go4data
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+func failureHandlerConfig(name string, value interface{}) *property.Configuration {
+	cfg := property.NewConfiguration()
+	cfg.AddProperty(name, "", true)
+	cfg.SetProperty(name, value)
+	return cfg
+}
+
+func TestRegisterFailureHandler(t *testing.T) {
+	if err := RegisterFailureHandler("print", NewPrintFailureHandler); !errors.Is(err, ErrFailureHandlerAlreadyRegistered) {
+		t.Fatal("should not be able to register print twice: ", err)
+	}
+	if _, err := GetFailureHandler("nosuchhandler", nil); !errors.Is(err, ErrFailureHandlerNotRegistered) {
+		t.Fatal("should not find a handler that is not registered: ", err)
+	}
+	if _, err := GetFailureHandler("print", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetFailureHandler("deadletter", nil); !errors.Is(err, ErrMissingFailureHandlerProperty) {
+		t.Fatal("deadletter should require a topic: ", err)
+	}
+	if _, err := GetFailureHandler("file", nil); !errors.Is(err, ErrMissingFailureHandlerProperty) {
+		t.Fatal("file should require a path: ", err)
+	}
+}
+
+func TestDeadLetterFailureHandler(t *testing.T) {
+	pipe, err := pubsub.Subscribe("deadletter_test_topic", NewID(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := GetFailureHandler("deadletter", failureHandlerConfig("topic", "deadletter_test_topic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := payload.NewBasePayload([]byte(`dead`), "test", nil)
+	fh(Failure{
+		Err:       errors.New("broken payload"),
+		Payload:   failed,
+		Processor: 7,
+		Attempts:  3,
+	})
+	if failed.GetMetaData().GetProperty("error") != nil {
+		t.Fatal("the failed payload should not be changed")
+	}
+
+	select {
+	case pay := <-pipe.Flow:
+		if string(pay.GetPayload()) != "dead" {
+			t.Fatal("wrong payload on the dead letter topic: ", string(pay.GetPayload()))
+		}
+		meta := pay.GetMetaData()
+		if meta.GetProperty("error").String() != "broken payload" {
+			t.Fatal("the error was not added to the metadata")
+		}
+		if attempts, _ := meta.GetProperty("attempts").Int(); attempts != 3 {
+			t.Fatal("the attempts was not added to the metadata")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no payload was published on the dead letter topic")
+	}
+}
+
+func TestFileFailureHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "failures.json")
+
+	fh, err := GetFailureHandler("file", failureHandlerConfig("path", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh(Failure{Err: errors.New("first"), Payload: payload.NewBasePayload([]byte(`one`), "test", nil), Processor: 1})
+	fh(Failure{Err: errors.New("second"), Processor: 2})
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatal("expected 2 lines, got ", len(lines))
+	}
+	if lines[0]["error"] != "first" || lines[1]["error"] != "second" {
+		t.Fatal("errors was not written properly: ", lines)
+	}
+}
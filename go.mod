@@ -3,6 +3,7 @@ module github.com/percybolmer/go4data
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/elastic/go-elasticsearch/v6 v6.8.10
 	github.com/elastic/go-elasticsearch/v7 v7.10.0
 	github.com/elastic/go-elasticsearch/v8 v8.0.0-20201216152027-57cb70149147
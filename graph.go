@@ -0,0 +1,254 @@
+package go4data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphFormat is the language a topology graph is written in
+type GraphFormat string
+
+const (
+	// GraphDOT writes the graph in the Graphviz DOT language
+	GraphDOT GraphFormat = "dot"
+	// GraphMermaid writes the graph as a Mermaid flowchart
+	GraphMermaid GraphFormat = "mermaid"
+)
+
+var (
+	//ErrUnknownGraphFormat is when asking for a graph in another format than dot or mermaid
+	ErrUnknownGraphFormat = errors.New("the graph format has to be dot or mermaid")
+
+	// GraphPropertyLength is how many characters a property value can have in a node label before its cut
+	GraphPropertyLength = 32
+)
+
+// graphNode is a processor, or a topic that is only published or only subscribed to, in the graph
+type graphNode struct {
+	id     string
+	label  []string
+	orphan bool
+}
+
+// graphEdge is a topic going from one node to another
+type graphEdge struct {
+	from, to string
+	label    string
+	orphan   bool
+}
+
+// WriteGraph draws how the processors are connected by their topics
+// Processors are nodes labelled with their name, Handler and the properties that are set, and topics are the edges between them.
+// Topics that nobody subscribes to and subscriptions that nobody publishes to are drawn as highlighted topic nodes
+func WriteGraph(w io.Writer, format GraphFormat, procs ...*Processor) error {
+	nodes, edges := buildGraph(procs)
+	bw := bufio.NewWriter(w)
+	switch format {
+	case GraphDOT:
+		writeDOT(bw, nodes, edges)
+	case GraphMermaid:
+		writeMermaid(bw, nodes, edges)
+	default:
+		return fmt.Errorf("%s: %w", format, ErrUnknownGraphFormat)
+	}
+	return bw.Flush()
+}
+
+// WriteGraph draws the processors of the pipeline, see the package level WriteGraph
+func (pl *Pipeline) WriteGraph(w io.Writer, format GraphFormat) error {
+	pl.Lock()
+	procs := make([]*Processor, len(pl.Processors))
+	copy(procs, pl.Processors)
+	pl.Unlock()
+	return WriteGraph(w, format, procs...)
+}
+
+// buildGraph turns the processors into nodes and edges, the order follows the processors so the output is the same each time
+func buildGraph(procs []*Processor) ([]graphNode, []graphEdge) {
+	var (
+		nodes       []graphNode
+		edges       []graphEdge
+		ids         = make(map[*Processor]string)
+		published   []string
+		seen        = make(map[string]bool)
+		subscribers = make(map[string][]*Processor)
+		topicNodes  = make(map[string]string)
+	)
+	for i, proc := range procs {
+		ids[proc] = fmt.Sprintf("p%d", i)
+		nodes = append(nodes, graphNode{id: ids[proc], label: processorLabel(proc)})
+		for _, topic := range proc.OutputTopics() {
+			if !seen[topic] {
+				seen[topic] = true
+				published = append(published, topic)
+			}
+		}
+	}
+	for _, proc := range procs {
+		for _, subscription := range proc.SubscribedTopics() {
+			for _, topic := range matchSubscription(subscription, published) {
+				subscribers[topic] = append(subscribers[topic], proc)
+			}
+		}
+	}
+	// topicNode adds a highlighted node for a topic that is missing a publisher or subscriber
+	topicNode := func(topic, problem string) string {
+		key := topic + "\x00" + problem
+		if id, ok := topicNodes[key]; ok {
+			return id
+		}
+		id := fmt.Sprintf("t%d", len(topicNodes))
+		topicNodes[key] = id
+		nodes = append(nodes, graphNode{id: id, label: []string{topic, problem}, orphan: true})
+		return id
+	}
+
+	for _, proc := range procs {
+		for _, out := range graphOutputs(proc) {
+			if len(subscribers[out.topic]) == 0 {
+				edges = append(edges, graphEdge{from: ids[proc], to: topicNode(out.topic, "(no subscribers)"), label: out.label, orphan: true})
+				continue
+			}
+			for _, sub := range subscribers[out.topic] {
+				edges = append(edges, graphEdge{from: ids[proc], to: ids[sub], label: out.label})
+			}
+		}
+	}
+	for _, proc := range procs {
+		for _, topic := range proc.SubscribedTopics() {
+			if len(matchSubscription(topic, published)) == 0 {
+				edges = append(edges, graphEdge{from: topicNode(topic, "(no publishers)"), to: ids[proc], label: topic, orphan: true})
+			}
+		}
+	}
+	return nodes, edges
+}
+
+// graphOutput is a topic a processor publishes on and the label of its edge
+type graphOutput struct {
+	topic string
+	label string
+}
+
+// graphOutputs returns the topics of a processor, topics that are not on the primary relationship are labelled with their relationship
+func graphOutputs(proc *Processor) []graphOutput {
+	var outputs []graphOutput
+	seen := make(map[graphOutput]bool)
+	add := func(out graphOutput) {
+		if !seen[out] {
+			seen[out] = true
+			outputs = append(outputs, out)
+		}
+	}
+	for _, topic := range proc.Topics {
+		add(graphOutput{topic: topic, label: topic})
+	}
+	primary := proc.primaryRelationship()
+	relationships := make([]string, 0, len(proc.Relationships))
+	for relationship := range proc.Relationships {
+		relationships = append(relationships, relationship)
+	}
+	sort.Strings(relationships)
+	for _, relationship := range relationships {
+		for _, topic := range proc.Relationships[relationship] {
+			label := topic
+			if relationship != primary {
+				label = relationship + ": " + topic
+			}
+			add(graphOutput{topic: topic, label: label})
+		}
+	}
+	return outputs
+}
+
+// processorLabel returns the lines of a processor node, its name, consumer group, Handler and the properties that are set
+func processorLabel(proc *Processor) []string {
+	label := []string{proc.Name}
+	if proc.Group != "" {
+		label = append(label, "group: "+proc.Group)
+	}
+	if proc.Handler == nil {
+		return label
+	}
+	label = append(label, proc.Handler.GetHandlerName())
+	cfg := proc.Handler.GetConfiguration()
+	if cfg == nil {
+		return label
+	}
+	for _, prop := range cfg.Properties {
+		if prop.Value == nil {
+			continue
+		}
+		// Cut on runes so that multi-byte characters are not split
+		value := []rune(prop.String())
+		if len(value) > GraphPropertyLength {
+			value = append(value[:GraphPropertyLength], []rune("...")...)
+		}
+		label = append(label, fmt.Sprintf("%s: %s", prop.Name, string(value)))
+	}
+	return label
+}
+
+// writeDOT writes the graph in the Graphviz DOT language
+func writeDOT(w *bufio.Writer, nodes []graphNode, edges []graphEdge) {
+	escape := func(s string) string {
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s)
+	}
+	fmt.Fprintln(w, "digraph go4data {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, n := range nodes {
+		lines := make([]string, len(n.label))
+		for i, line := range n.label {
+			lines[i] = escape(line)
+		}
+		label := strings.Join(lines, `\n`)
+		if n.orphan {
+			fmt.Fprintf(w, "\t%s [label=\"%s\", shape=note, style=\"dashed,filled\", color=red, fillcolor=\"#ffe0e0\"];\n", n.id, label)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s [label=\"%s\"];\n", n.id, label)
+	}
+	for _, e := range edges {
+		if e.orphan {
+			fmt.Fprintf(w, "\t%s -> %s [label=\"%s\", style=dashed, color=red];\n", e.from, e.to, escape(e.label))
+			continue
+		}
+		fmt.Fprintf(w, "\t%s -> %s [label=\"%s\"];\n", e.from, e.to, escape(e.label))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart
+func writeMermaid(w *bufio.Writer, nodes []graphNode, edges []graphEdge) {
+	escape := func(s string) string {
+		return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "|", "#124;", "\n", " ").Replace(s)
+	}
+	fmt.Fprintln(w, "flowchart LR")
+	var orphans []string
+	for _, n := range nodes {
+		lines := make([]string, len(n.label))
+		for i, line := range n.label {
+			lines[i] = escape(line)
+		}
+		fmt.Fprintf(w, "    %s[\"%s\"]\n", n.id, strings.Join(lines, "<br/>"))
+		if n.orphan {
+			orphans = append(orphans, n.id)
+		}
+	}
+	for _, e := range edges {
+		if e.orphan {
+			fmt.Fprintf(w, "    %s -. \"%s\" .-> %s\n", e.from, escape(e.label), e.to)
+			continue
+		}
+		fmt.Fprintf(w, "    %s -- \"%s\" --> %s\n", e.from, escape(e.label), e.to)
+	}
+	if len(orphans) != 0 {
+		fmt.Fprintln(w, "    classDef orphan fill:#ffe0e0,stroke:#d00,stroke-dasharray:5 5")
+		fmt.Fprintf(w, "    class %s orphan\n", strings.Join(orphans, ","))
+	}
+}
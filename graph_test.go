@@ -0,0 +1,105 @@
+package go4data
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/percybolmer/go4data/handlers/terminal"
+)
+
+func TestWriteGraph(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	exec := env.NewProcessor("exec", "graph_output")
+	exec.SetHandler(terminal.NewExecCMDHandler())
+	exec.GetConfiguration().SetProperty("command", `echo "hi"`)
+	exec.Relationships = map[string][]string{"failure": {"graph_failed"}}
+	printer := env.NewProcessor("printer", "graph_nobody")
+	printer.SetHandler(terminal.NewStdoutHandler())
+	for proc, topics := range map[*Processor][]string{exec: {"graph_input"}, printer: {"graph_output", "graph_failed"}} {
+		if err := proc.Subscribe(topics...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type testCase struct {
+		Name     string
+		Format   GraphFormat
+		Expected []string
+	}
+	testCases := []testCase{
+		{Name: "DOT", Format: GraphDOT, Expected: []string{
+			"digraph go4data {",
+			`p0 [label="exec\nExecCMD\ncommand: echo \"hi\""];`,
+			`p1 [label="printer\nStdout"];`,
+			`p0 -> p1 [label="graph_output"];`,
+			`p0 -> p1 [label="failure: graph_failed"];`,
+			`t0 [label="graph_nobody\n(no subscribers)", shape=note`,
+			`p1 -> t0 [label="graph_nobody", style=dashed, color=red];`,
+			`t1 -> p0 [label="graph_input", style=dashed, color=red];`,
+		}},
+		{Name: "Mermaid", Format: GraphMermaid, Expected: []string{
+			"flowchart LR",
+			`p0["exec<br/>ExecCMD<br/>command: echo #quot;hi#quot;"]`,
+			`p0 -- "failure: graph_failed" --> p1`,
+			`p1 -. "graph_nobody" .-> t0`,
+			`t1 -. "graph_input" .-> p0`,
+			"class t0,t1 orphan",
+		}},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := WriteGraph(&buf, tc.Format, exec, printer); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range tc.Expected {
+			if !strings.Contains(buf.String(), expected) {
+				t.Fatalf("%s: missing %s in\n%s", tc.Name, expected, buf.String())
+			}
+		}
+	}
+
+	if err := WriteGraph(&bytes.Buffer{}, "svg", exec); !errors.Is(err, ErrUnknownGraphFormat) {
+		t.Fatal("should not draw unknown formats: ", err)
+	}
+
+	// Long values are cut on characters, not bytes
+	exec.GetConfiguration().SetProperty("command", strings.Repeat("å", GraphPropertyLength+5))
+	label := processorLabel(exec)
+	command := label[len(label)-1]
+	if !utf8.ValidString(command) || command != "command: "+strings.Repeat("å", GraphPropertyLength)+"..." {
+		t.Fatal("the value should be cut after GraphPropertyLength characters: ", command)
+	}
+}
+
+func TestWriteGraphPattern(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	source := env.NewProcessor("source", "graphpattern.raw.sales")
+	source.SetHandler(terminal.NewStdoutHandler())
+	archive := env.NewProcessor("archive")
+	archive.SetHandler(terminal.NewStdoutHandler())
+	archive.Group = "archivers"
+	if err := archive.Subscribe("graphpattern.raw.*"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGraph(&buf, GraphDOT, source, archive); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `p1 [label="archive\ngroup: archivers\nStdout"];`) {
+		t.Fatal("the group should be in the label: ", buf.String())
+	}
+	if !strings.Contains(buf.String(), `p0 -> p1 [label="graphpattern.raw.sales"];`) {
+		t.Fatal("the pattern should be connected to the topic: ", buf.String())
+	}
+	if strings.Contains(buf.String(), "orphan") || strings.Contains(buf.String(), "no publishers") {
+		t.Fatal("a matched pattern is not an orphan: ", buf.String())
+	}
+}
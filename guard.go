@@ -0,0 +1,67 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	//ErrHandlerPanic is when a Handler panics while handling payloads, the panic is recovered and given to the FailureHandler
+	ErrHandlerPanic = errors.New("the handler panicked")
+	//ErrHandleTimeout is when a Handler takes longer than the HandleTimeout of the processor
+	ErrHandleTimeout = errors.New("the handler did not finish within the handle timeout")
+)
+
+// PanicError is the error used when a Handler panics, it keeps the value and the stack trace of the panic
+type PanicError struct {
+	// Value is what the Handler panicked with
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+// Error is used to be part of error interface
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrHandlerPanic, pe.Value)
+}
+
+// Unwrap makes errors.Is(err, ErrHandlerPanic) true
+func (pe *PanicError) Unwrap() error {
+	return ErrHandlerPanic
+}
+
+// guard runs handle and makes sure a panic in the Handler does not kill the processor
+// Panics are turned into a PanicError that is never retried
+// If the processor has a HandleTimeout the ctx given to handle gets a deadline, and errors after the deadline are reported with ErrHandleTimeout
+// handle is not stopped when the deadline is reached, it is up to the Handler to return when ctx is done
+func (p *Processor) guard(ctx context.Context, handle func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(&PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	if p.HandleTimeout <= 0 {
+		return handle(ctx)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, p.HandleTimeout)
+	defer cancel()
+	err = handle(callCtx)
+	// A Handler that finished successfully is not a failure even if it was late
+	// Only report the deadline of the call, not the processor being stopped
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrHandleTimeout, p.HandleTimeout, err)
+	}
+	return err
+}
+
+// stackOf returns the stack trace of a PanicError, or an empty string if the error is not from a panic
+func stackOf(err error) string {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		return string(pe.Stack)
+	}
+	return ""
+}
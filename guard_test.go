@@ -0,0 +1,134 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+)
+
+// guardedHandler panics, sleeps or succeeds depending on the payload
+type guardedHandler struct {
+	handlers.Handler
+	calls int
+}
+
+func newGuardedHandler() *guardedHandler {
+	gh := &guardedHandler{}
+	gh.Handler = newFuncHandler(gh.handle, false)
+	return gh
+}
+
+func (gh *guardedHandler) handle(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	gh.calls++
+	action := "panic"
+	if p != nil {
+		action = string(p.GetPayload())
+	}
+	switch action {
+	case "panic":
+		var csv map[string]string
+		csv["boom"] = "nil map"
+	case "sleep":
+		<-ctx.Done()
+		return ctx.Err()
+	case "ignore":
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestGuard(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Payload     string
+		Timeout     time.Duration
+		ExpectedErr error
+		Stack       bool
+	}
+
+	testCases := []testCase{
+		{Name: "Fine", Payload: "fine"},
+		{Name: "Panic", Payload: "panic", ExpectedErr: ErrHandlerPanic, Stack: true},
+		{Name: "NoTimeout", Payload: "ignore"},
+		{Name: "Timeout", Payload: "sleep", Timeout: 10 * time.Millisecond, ExpectedErr: ErrHandleTimeout},
+		// A Handler that ignores ctx but succeeds late is not a failure
+		{Name: "TimeoutIgnored", Payload: "ignore", Timeout: 10 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		handler := newGuardedHandler()
+		p := NewProcessor(tc.Name)
+		p.SetHandler(handler)
+		p.HandleTimeout = tc.Timeout
+		// Panics should never be retried
+		p.Retry = &RetryPolicy{MaxAttempts: 3}
+		var failures []Failure
+		p.FailureHandler = func(f Failure) {
+			failures = append(failures, f)
+		}
+
+		p.handlePayload(context.Background(), handlers.Discard, payload.NewBasePayload([]byte(tc.Payload), "test", nil))
+
+		if tc.ExpectedErr == nil {
+			if len(failures) != 0 {
+				t.Fatalf("%s: expected no failure, got %v", tc.Name, failures[0].Err)
+			}
+			continue
+		}
+		if len(failures) != 1 || !errors.Is(failures[0].Err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, failures)
+		}
+		if tc.Stack != (failures[0].Stack != "") {
+			t.Fatalf("%s: the stack trace should only be set for panics", tc.Name)
+		}
+		if tc.ExpectedErr == ErrHandlerPanic && handler.calls != 1 {
+			t.Fatalf("%s: a panic should not be retried, got %d calls", tc.Name, handler.calls)
+		}
+	}
+}
+
+func TestGuardSubscriptionless(t *testing.T) {
+	p := NewProcessor("guard_subscriptionless")
+	p.SetHandler(newGuardedHandler())
+	p.ExecutionInterval = 10 * time.Millisecond
+
+	var (
+		failures []Failure
+		mu       sync.Mutex
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.FailureHandler = func(f Failure) {
+		mu.Lock()
+		failures = append(failures, f)
+		mu.Unlock()
+		cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.HandleSubscriptionless(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the panic was never reported")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failures) == 0 || !errors.Is(failures[0].Err, ErrHandlerPanic) {
+		t.Fatal("a panic in a Subscriptionless Handler should be a failure: ", failures)
+	}
+	if !strings.Contains(failures[0].Stack, "guardedHandler") {
+		t.Fatal("the failure should have the stack trace of the panic")
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/percybolmer/go4data/metric"
+	"github.com/percybolmer/go4data/property"
+)
+
+// Base is embedded by Handlers to get everything except Handle
+// It takes care of the configuration, name, error channel and the payloads_in and payloads_out metrics
+// Handlers override ValidateConfiguration if they need to read any values from the configuration
+type Base struct {
+	// Cfg is values needed to properly run the Handler
+	Cfg *property.Configuration `json:"configs" yaml:"configs"`
+	// Name is sort of like an ID used to load data back should be the same that is used to register the Handler
+	Name string `json:"handler" yaml:"handler_name"`
+	// MetricPayloadOut is how many payloads the processor has outputted
+	MetricPayloadOut string
+	// MetricPayloadIn is how many payloads the processor has inputted
+	MetricPayloadIn string
+
+	// subscriptionless is used to say if the Handler is subscriptionless
+	subscriptionless bool
+	errChan          chan error
+	metrics          metric.Provider
+	metricPrefix     string
+}
+
+// NewBase creates a Base with an empty configuration, properties are then added with Cfg.AddProperty
+func NewBase(name string) Base {
+	return Base{
+		Cfg:     property.NewConfiguration(),
+		Name:    name,
+		errChan: make(chan error, 1000),
+	}
+}
+
+// GetHandlerName is used to retrun a unqiue string name
+func (b *Base) GetHandlerName() string {
+	return b.Name
+}
+
+// ValidateConfiguration makes sure all required properties are set
+func (b *Base) ValidateConfiguration() (bool, []string) {
+	return b.Cfg.ValidateProperties()
+}
+
+// GetConfiguration will return the CFG for the Handler
+func (b *Base) GetConfiguration() *property.Configuration {
+	return b.Cfg
+}
+
+// Subscriptionless will return true/false if the Handler is genereating payloads itself
+func (b *Base) Subscriptionless() bool {
+	return b.subscriptionless
+}
+
+// SetSubscriptionless is used to say if the Handler is genereating payloads itself
+func (b *Base) SetSubscriptionless(subscriptionless bool) {
+	b.subscriptionless = subscriptionless
+}
+
+// GetErrorChannel will return a channel that the Handler can output eventual errors onto
+func (b *Base) GetErrorChannel() chan error {
+	if b.errChan == nil {
+		b.errChan = make(chan error, 1000)
+	}
+	return b.errChan
+}
+
+// SetMetricProvider is used to change what metrics provider is used by the handler
+// It adds the payloads_in and payloads_out metrics, Handlers that want more metrics can add them with Metrics after calling this
+func (b *Base) SetMetricProvider(p metric.Provider, prefix string) error {
+	b.metrics = p
+	b.metricPrefix = prefix
+
+	b.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
+	b.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
+	err := b.metrics.AddMetric(&metric.Metric{
+		Name:        b.MetricPayloadOut,
+		Description: "keeps track of how many payloads the handler has outputted",
+	})
+	// Metrics are kept when a processor is restarted
+	if err != nil && !errors.Is(err, metric.ErrMetricAlreadyExist) {
+		return err
+	}
+	err = b.metrics.AddMetric(&metric.Metric{
+		Name:        b.MetricPayloadIn,
+		Description: "keeps track of how many payloads the handler has ingested",
+	})
+	if err != nil && !errors.Is(err, metric.ErrMetricAlreadyExist) {
+		return err
+	}
+	return nil
+}
+
+// Metrics returns the metric.Provider set by SetMetricProvider, nil if none is set
+func (b *Base) Metrics() metric.Provider {
+	return b.metrics
+}
+
+// MetricPrefix returns the prefix set by SetMetricProvider
+func (b *Base) MetricPrefix() string {
+	return b.metricPrefix
+}
+
+// PayloadsIn will increment the payloads_in metric, it does nothing if no metric.Provider is set
+func (b *Base) PayloadsIn(count int) {
+	if b.metrics != nil {
+		b.metrics.IncrementMetric(b.MetricPayloadIn, float64(count))
+	}
+}
+
+// PayloadsOut will increment the payloads_out metric, it does nothing if no metric.Provider is set
+func (b *Base) PayloadsOut(count int) {
+	if b.metrics != nil {
+		b.metrics.IncrementMetric(b.MetricPayloadOut, float64(count))
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/percybolmer/go4data/metric"
+)
+
+func TestBase(t *testing.T) {
+	base := NewBase("BaseTest")
+	if base.GetHandlerName() != "BaseTest" {
+		t.Fatal("the name should be set by NewBase")
+	}
+	if base.GetErrorChannel() == nil {
+		t.Fatal("Should not be nil errChan")
+	}
+	if base.Subscriptionless() {
+		t.Fatal("a Base should not be subscriptionless by default")
+	}
+	base.SetSubscriptionless(true)
+	if !base.Subscriptionless() {
+		t.Fatal("should be subscriptionless")
+	}
+	data, err := json.Marshal(&base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"handler":"BaseTest"`) {
+		t.Fatal("the name should be saved as handler: ", string(data))
+	}
+
+	base.Cfg.AddProperty("needed", "a required property", true)
+	if valid, _ := base.ValidateConfiguration(); valid {
+		t.Fatal("a missing required property should not be valid")
+	}
+	base.Cfg.SetProperty("needed", "yes")
+	if valid, errs := base.ValidateConfiguration(); !valid {
+		t.Fatal(errs)
+	}
+
+	// Incrementing without a metric.Provider should not panic
+	base.PayloadsIn(1)
+	if err := base.SetMetricProvider(metric.NewPrometheusProvider(), "basetest"); err != nil {
+		t.Fatal(err)
+	}
+	if base.Metrics() == nil || base.MetricPrefix() != "basetest" {
+		t.Fatal("the metric provider and prefix should be set")
+	}
+	base.PayloadsIn(2)
+	base.PayloadsOut(3)
+	if met := base.Metrics().GetMetric("basetest_payloads_in"); met == nil || met.Value != 2 {
+		t.Fatal("payloads in should be counted")
+	}
+	if met := base.Metrics().GetMetric("basetest_payloads_out"); met == nil || met.Value != 3 {
+		t.Fatal("payloads out should be counted")
+	}
+}
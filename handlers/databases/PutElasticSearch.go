@@ -3,15 +3,16 @@
 package databases
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
-	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 
 	elasticsearch6 "github.com/elastic/go-elasticsearch/v6"
@@ -19,14 +20,14 @@ import (
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
+var (
+	//ErrBulkFailed is when elasticsearch reports that one or more documents in a bulk request failed
+	ErrBulkFailed = errors.New("one or more documents in the bulk request failed")
+)
+
 // PutElasticSearch is used to push payloads onto a elasticsearch topic
 type PutElasticSearch struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg *property.Configuration `json:"configs" yaml:"configs"`
-	// Name is sort of like an ID used to load data back should be the same that is used to register the Handler
-	Name string `json:"handler_name" yaml:"handler_name"`
-	// subscriptionless should be set to true if this Handler does not need any input payloads to function
-	subscriptionless bool
+	handlers.Base
 	// the index to push onto
 	index string
 	// the ip of the elastic node
@@ -36,13 +37,6 @@ type PutElasticSearch struct {
 	// elastictype is the type that is set for the input to elasticsearch, used for mapping purpose
 	elastictype string
 
-	//errChan is the channel to output errors.
-	errChan chan error
-	// metrics is a metric.Provider that allows export of metrics
-	metrics metric.Provider
-	// metricPrefix is a unique string to attach to metrics
-	metricPrefix string
-
 	//es6 is for version 6
 	es6 *elasticsearch6.Client
 	//es 7 is for version 7
@@ -56,12 +50,7 @@ func init() {
 // NewPutElasticSearchHandler generates a new PutElasticSearch Handler
 func NewPutElasticSearchHandler() handlers.Handler {
 	act := &PutElasticSearch{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:    "PutElasticSearch",
-		errChan: make(chan error, 1000),
-		metrics: metric.NewPrometheusProvider(),
+		Base: handlers.NewBase("PutElasticSearch"),
 	}
 	act.Cfg.AddProperty("index", "the index to push to", true)
 	act.Cfg.AddProperty("ip", "the ip of the elasticserver to connect", true)
@@ -71,14 +60,9 @@ func NewPutElasticSearchHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName should return the name of the handler that was used in register
-func (a *PutElasticSearch) GetHandlerName() string {
-	return a.Name
-}
-
 // Handle is used to send the payload []byte to an index as a JSON blobb
-func (a *PutElasticSearch) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
-	a.metrics.IncrementMetric(fmt.Sprintf("%s_payloads_in", a.metricPrefix), 1)
+func (a *PutElasticSearch) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
+	a.PayloadsIn(1)
 
 	req := esapi.IndexRequest{
 		Index:   a.index,
@@ -99,8 +83,71 @@ func (a *PutElasticSearch) Handle(ctx context.Context, input payload.Payload, to
 		defer res.Body.Close()
 	}
 
-	if len(topics) != 0 {
-		pubsub.PublishTopics(topics, input)
+	emitter.Emit(ctx, input)
+	return nil
+}
+
+// HandleBatch is used to send many payloads to the index with a single bulk request
+func (a *PutElasticSearch) HandleBatch(ctx context.Context, emitter handlers.Emitter, inputs []payload.Payload) error {
+	a.PayloadsIn(len(inputs))
+
+	action := map[string]map[string]string{
+		"index": {
+			"_index": a.index,
+		},
+	}
+	if a.es6 != nil {
+		action["index"]["_type"] = a.elastictype
+	}
+	meta, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	for _, input := range inputs {
+		body.Write(meta)
+		body.WriteByte('\n')
+		body.Write(bytes.TrimSpace(input.GetPayload()))
+		body.WriteByte('\n')
+	}
+
+	req := esapi.BulkRequest{
+		Body:    &body,
+		Refresh: "true",
+	}
+	var res *esapi.Response
+	if a.es6 != nil {
+		res, err = req.Do(ctx, a.es6)
+	} else if a.es7 != nil {
+		res, err = req.Do(ctx, a.es7)
+	}
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		defer res.Body.Close()
+		if err := bulkError(res); err != nil {
+			return err
+		}
+	}
+
+	emitter.Emit(ctx, inputs...)
+	return nil
+}
+
+// bulkError returns an error if the bulk response says that the request or any document failed
+func bulkError(res *esapi.Response) error {
+	if res.IsError() {
+		return fmt.Errorf("%s: %w", res.String(), ErrBulkFailed)
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil && err != io.EOF {
+		return err
+	}
+	if result.Errors {
+		return ErrBulkFailed
 	}
 	return nil
 }
@@ -194,32 +241,3 @@ func (a *PutElasticSearch) ValidateConfiguration() (bool, []string) {
 	}
 	return true, nil
 }
-
-// GetConfiguration will return the CFG for the Handler
-func (a *PutElasticSearch) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *PutElasticSearch) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *PutElasticSearch) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *PutElasticSearch) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	// Here you can add Metrics that you want to be stored, should return error if the metric collides with another metric from ANY handler.
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        fmt.Sprintf("%s_payloads_in", prefix),
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-	return err
-
-}
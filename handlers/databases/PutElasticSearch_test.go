@@ -1,17 +1,19 @@
 package databases
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	elasticsearch6 "github.com/elastic/go-elasticsearch/v6"
 	elasticsearch7 "github.com/elastic/go-elasticsearch/v7"
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 var handler = func(w http.ResponseWriter, r *http.Request) {
@@ -69,24 +71,14 @@ func TestPutElasticSearchHandle(t *testing.T) {
 	// Later replace and setup a fake http Callback so we dont need a real elasticnode up and runnin
 	payload := payload.NewBasePayload([]byte(`{ "username": "testersson" }`), "test", nil)
 
-	err = es.Handle(context.Background(), payload, "test")
+	output := handlers.NewCollector()
+	err = es.Handle(context.Background(), output, payload)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pipe, err := pubsub.Subscribe("test", 1, 10)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Get DefaultEngine and Drain it
-	de, err := pubsub.EngineAsDefaultEngine()
-	if err != nil {
-		t.Fatal(err)
-	}
-	de.DrainTopicsBuffer()
-
-	if len(pipe.Flow) != 1 {
-		t.Fatal("Found no payload on topic")
+	if len(output.Payloads()) != 1 {
+		t.Fatal("Found no emitted payload")
 	}
 
 	// Replace es6 with MOck client
@@ -100,12 +92,12 @@ func TestPutElasticSearchHandle(t *testing.T) {
 	}
 	es.es6 = client2
 	es.es7 = nil
-	err = es.Handle(context.Background(), payload, "test")
+	err = es.Handle(context.Background(), output, payload)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(pipe.Flow) != 2 {
-		t.Fatal("Wrong payload length of topic: ", len(pipe.Flow))
+	if len(output.Payloads()) != 2 {
+		t.Fatal("Wrong amount of emitted payloads: ", len(output.Payloads()))
 	}
 
 }
@@ -237,13 +229,13 @@ func TestPutElasticSearchValidateConfiguration(t *testing.T) {
 
 	es.SetMetricProvider(metric.NewPrometheusProvider(), "test")
 
-	if es.metrics == nil {
+	if es.Metrics() == nil {
 		t.Fatal("Failed to assgin new metric provider")
 	}
-	if es.metricPrefix != "test" {
+	if es.MetricPrefix() != "test" {
 		t.Fatal("Prefix not  applied")
 	}
-	if met := es.metrics.GetMetric("test_payloads_in"); met == nil {
+	if met := es.Metrics().GetMetric("test_payloads_in"); met == nil {
 		t.Fatal("Didnt create payloads in metric")
 	}
 
@@ -251,3 +243,55 @@ func TestPutElasticSearchValidateConfiguration(t *testing.T) {
 		t.Fatal("Wrong handler name")
 	}
 }
+
+func TestPutElasticSearchHandleBatch(t *testing.T) {
+	var lines []string
+	bulkErrors := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lines = nil
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if bulkErrors {
+			w.Write([]byte(`{"took": 1, "errors": true, "items": []}`))
+			return
+		}
+		w.Write([]byte(`{"took": 1, "errors": false, "items": []}`))
+	}))
+	defer ts.Close()
+
+	es := NewPutElasticSearchHandler().(*PutElasticSearch)
+	es.SetMetricProvider(metric.NewPrometheusProvider(), "putelastic_batch")
+	es.index = "test"
+	es.elastictype = "testdata"
+	client, err := elasticsearch7.NewClient(elasticsearch7.Config{
+		Addresses: []string{
+			ts.URL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	es.es7 = client
+
+	batch := []payload.Payload{
+		payload.NewBasePayload([]byte(`{ "username": "first" }`), "test", nil),
+		payload.NewBasePayload([]byte(`{ "username": "second" }`), "test", nil),
+	}
+	if err := es.HandleBatch(context.Background(), handlers.Discard, batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Fatal("expected an action and a document line per payload: ", lines)
+	}
+	if lines[0] != `{"index":{"_index":"test"}}` || lines[1] != `{ "username": "first" }` {
+		t.Fatal("wrong bulk body: ", lines)
+	}
+
+	bulkErrors = true
+	if err := es.HandleBatch(context.Background(), handlers.Discard, batch); !errors.Is(err, ErrBulkFailed) {
+		t.Fatal("expected the bulk to fail: ", err)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/percybolmer/go4data/payload"
+)
+
+// Relationships that the built-in Handlers emit on
+const (
+	// RelationshipSuccess is used for payloads that was handled successfully, its the primary relationship for Handlers that are not Routers
+	RelationshipSuccess = "success"
+	// RelationshipFailure is used for payloads that could not be handled
+	RelationshipFailure = "failure"
+	// RelationshipMatched is used for payloads that matched a filter
+	RelationshipMatched = "matched"
+	// RelationshipUnmatched is used for payloads that did not match a filter
+	RelationshipUnmatched = "unmatched"
+)
+
+// ErrNoRoute is when emitting on a relationship that has no topics and the processor is configured to not drop those payloads
+var ErrNoRoute = errors.New("the relationship has no topics to publish on")
+
+// FailedError is an error that carries the payload that should be routed as the failure instead of the input
+// Handlers should not change the input, since other processors can be handling the same payload
+type FailedError struct {
+	Err     error
+	Payload payload.Payload
+}
+
+// Error is used to be part of error interface
+func (fe *FailedError) Error() string {
+	return fe.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (fe *FailedError) Unwrap() error {
+	return fe.Err
+}
+
+// Failed wraps err so that the Processor publishes p on the failure relationship, or gives it to the FailureHandler, instead of the input
+// It is used to add information about the error to a copy of the input, only Handle can use it and not HandleBatch
+func Failed(err error, p payload.Payload) error {
+	if err == nil {
+		return nil
+	}
+	return &FailedError{Err: err, Payload: p}
+}
+
+// Emitter is given to Handle by the Processor and is what Handlers use to output payloads
+// The Processor decides where the payloads are published and takes care of any errors while publishing them
+type Emitter interface {
+	// Emit will output payloads on the primary relationship of the Handler
+	Emit(ctx context.Context, payloads ...payload.Payload)
+	// EmitTo will output payloads on a named relationship
+	// If the relationship has no topics the payloads are dropped, or ErrNoRoute is returned if the processor is configured to do so
+	EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error
+}
+
+// Router is implemented by Handlers that emit on named relationships
+// The relationships can then be mapped to their own topics on the processor
+type Router interface {
+	// Relationships returns all relationships the Handler emits on, the first one is the primary relationship used by Emit
+	Relationships() []string
+}
+
+// discard is an Emitter that throws away all payloads
+type discard struct{}
+
+// Emit does nothing
+func (discard) Emit(ctx context.Context, payloads ...payload.Payload) {}
+
+// EmitTo does nothing
+func (discard) EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error {
+	return nil
+}
+
+// Discard is an Emitter that throws away all payloads
+var Discard Emitter = discard{}
+
+// Collector is an Emitter that keeps all payloads that are emitted, it is used to test Handlers without any Pub/Sub engine
+type Collector struct {
+	payloads      []payload.Payload
+	relationships map[string][]payload.Payload
+	sync.Mutex
+}
+
+// NewCollector creates an empty Collector
+func NewCollector() *Collector {
+	return &Collector{
+		relationships: make(map[string][]payload.Payload),
+	}
+}
+
+// Emit will store the payloads
+func (c *Collector) Emit(ctx context.Context, payloads ...payload.Payload) {
+	c.Lock()
+	c.payloads = append(c.payloads, payloads...)
+	c.Unlock()
+}
+
+// EmitTo will store the payloads under the relationship
+func (c *Collector) EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error {
+	c.Lock()
+	if c.relationships == nil {
+		c.relationships = make(map[string][]payload.Payload)
+	}
+	c.relationships[relationship] = append(c.relationships[relationship], payloads...)
+	c.Unlock()
+	return nil
+}
+
+// Payloads returns all payloads emitted with Emit so far
+func (c *Collector) Payloads() []payload.Payload {
+	c.Lock()
+	defer c.Unlock()
+	return append([]payload.Payload{}, c.payloads...)
+}
+
+// Relationship returns all payloads emitted on the relationship with EmitTo so far
+func (c *Collector) Relationship(relationship string) []payload.Payload {
+	c.Lock()
+	defer c.Unlock()
+	return append([]payload.Payload{}, c.relationships[relationship]...)
+}
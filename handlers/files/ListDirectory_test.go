@@ -6,9 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 func TestListDirHandle(t *testing.T) {
@@ -35,22 +35,12 @@ func TestListDirHandle(t *testing.T) {
 		time.Sleep(2 * time.Second)
 		cancel()
 	}()
-	go rfg.Handle(ctxsub, nil, "foundfiles")
+	output := handlers.NewCollector()
+	go rfg.Handle(ctxsub, output, nil)
 
 	time.Sleep(2 * time.Second)
-	// Get items from topic and there should be 1
-	output, err := pubsub.Subscribe("foundfiles", 1, 10)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Get DefaultEngine and Drain it
-	de, err := pubsub.EngineAsDefaultEngine()
-	if err != nil {
-		t.Fatal(err)
-	}
-	de.DrainTopicsBuffer()
-
-	if len(output.Flow) != 1 {
+	// There should be 1 emitted payload
+	if len(output.Payloads()) != 1 {
 		t.Fatal("Wrong length")
 	}
 }
@@ -79,6 +69,9 @@ func TestListDirectory(t *testing.T) {
 	if len(payloads) != 1 {
 		t.Fatal("Wrong length of payloads: ", len(payloads))
 	}
+	if payloads[0].GetMetaData().GetProperty("filepath").String() != string(payloads[0].GetPayload()) {
+		t.Fatal("the filepath should be added to the metadata")
+	}
 
 }
 
@@ -95,17 +88,17 @@ func TestListDirectoryMetrics(t *testing.T) {
 	}
 
 	handler.SetMetricProvider(metric.NewPrometheusProvider(), "test")
-	if handler.metrics == nil {
+	if handler.Metrics() == nil {
 		t.Fatal("Should not have failed to assigned metric")
 	}
 
-	if handler.metricPrefix != "test" {
+	if handler.MetricPrefix() != "test" {
 		t.Fatal("Pefix not applied")
 	}
-	if met := handler.metrics.GetMetric("test_payloads_in"); met == nil {
+	if met := handler.Metrics().GetMetric("test_payloads_in"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
-	if met := handler.metrics.GetMetric("test_payloads_out"); met == nil {
+	if met := handler.Metrics().GetMetric("test_payloads_out"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
 	if handler.GetHandlerName() != "ListDirectory" {
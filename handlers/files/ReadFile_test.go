@@ -1,14 +1,15 @@
 package files
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 func TestReadFileHandle(t *testing.T) {
@@ -22,32 +23,22 @@ func TestReadFileHandle(t *testing.T) {
 	rfg.SetMetricProvider(metric.NewPrometheusProvider(), "testreadfile")
 
 	// Bad payload should return error
-	// Real payload should return 1 length in topic
+	// Real payload should emit 1 payload
 	goodpayload := payload.NewBasePayload([]byte("testing/coolfile.txt"), "test", nil)
 	badpayload := payload.NewBasePayload([]byte("testing/nosuchfile.txt"), "test", nil)
 
-	err = rfg.Handle(nil, badpayload, "test")
+	output := handlers.NewCollector()
+	err = rfg.Handle(context.Background(), output, badpayload)
 
 	if !os.IsNotExist(err) {
 		t.Fatal(err)
 	}
-	err = rfg.Handle(nil, goodpayload, "test")
+	err = rfg.Handle(context.Background(), output, goodpayload)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	output, err := pubsub.Subscribe("test", 1, 10)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Get DefaultEngine and Drain it
-	de, err := pubsub.EngineAsDefaultEngine()
-	if err != nil {
-		t.Fatal(err)
-	}
-	de.DrainTopicsBuffer()
-
-	if len(output.Flow) != 1 {
+	if len(output.Payloads()) != 1 {
 		t.Fatal("Bad output length")
 	}
 }
@@ -64,17 +55,17 @@ func TestReadFileMetrics(t *testing.T) {
 	}
 
 	handler.SetMetricProvider(metric.NewPrometheusProvider(), "test2")
-	if handler.metrics == nil {
+	if handler.Metrics() == nil {
 		t.Fatal("Should not have failed to assigned metric")
 	}
 
-	if handler.metricPrefix != "test2" {
+	if handler.MetricPrefix() != "test2" {
 		t.Fatal("Pefix not applied")
 	}
-	if met := handler.metrics.GetMetric("test2_payloads_in"); met == nil {
+	if met := handler.Metrics().GetMetric("test2_payloads_in"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
-	if met := handler.metrics.GetMetric("test2_payloads_out"); met == nil {
+	if met := handler.Metrics().GetMetric("test2_payloads_out"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
 	if handler.GetHandlerName() != "ReadFile" {
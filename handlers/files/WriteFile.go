@@ -3,6 +3,7 @@
 package files
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -10,33 +11,19 @@ import (
 	"os"
 
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
-	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 )
 
 // WriteFile is used to will print the stringified version of GetPayload into a file
 type WriteFile struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg     *property.Configuration `json:"configs" yaml:"configs"`
-	Name    string                  `json:"name" yaml:"handler_name"`
+	handlers.Base
 	path    string
 	append  bool
 	forward bool
 	//pid and gid are set to change pid/gid fpr temp files
-	pid              int
-	gid              int
-	subscriptionless bool
-
-	errChan      chan error
-	metrics      metric.Provider
-	metricPrefix string
-	// MetricPayloadOut is how many payloads the processor has outputted
-	MetricPayloadOut string
-	// MetricPayloadIn is how many payloads the processor has inputted
-	MetricPayloadIn string
+	pid int
+	gid int
 }
 
 var (
@@ -53,12 +40,7 @@ func init() {
 // NewWriteFileHandler generates a new WriteFile Handler
 func NewWriteFileHandler() handlers.Handler {
 	act := &WriteFile{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:    "WriteFile",
-		errChan: make(chan error, 1000),
-		metrics: metric.NewPrometheusProvider(),
+		Base: handlers.NewBase("WriteFile"),
 	}
 	act.Cfg.AddProperty("path", "the path on where to write files", true)
 	act.Cfg.AddProperty("append", "if set to true it will append to files instead of overwriting collisions", true)
@@ -68,33 +50,37 @@ func NewWriteFileHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName is used to retrun a unqiue string name
-func (a *WriteFile) GetHandlerName() string {
-	return a.Name
+// Handle is used to write files to disc
+func (a *WriteFile) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
+	return a.HandleBatch(ctx, emitter, []payload.Payload{input})
 }
 
-// Handle is used to write files to disc
-func (a *WriteFile) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
-	a.metrics.IncrementMetric(a.MetricPayloadIn, 1)
+// HandleBatch is used to write many payloads to disc at once
+// When writing to a file it is only opened once for the whole batch, when writing to a directory each payload gets its own file
+func (a *WriteFile) HandleBatch(ctx context.Context, emitter handlers.Emitter, inputs []payload.Payload) error {
+	a.PayloadsIn(len(inputs))
 	finfo, err := os.Stat(a.path)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
 	if finfo != nil && finfo.IsDir() {
-		// Write is to a folder, No need for error, but lets create a random name with tmpfile
-		file, err := ioutil.TempFile(a.path, "WriteFile_")
-		if err != nil {
-			return err
-		}
-		// set gid/pid
-		err = os.Chown(file.Name(), a.pid, a.gid)
-		if err != nil {
-			return err
-		}
-		err = write(file, input.GetPayload())
-		if err != nil {
-			return err
+		for _, input := range inputs {
+			// Write is to a folder, No need for error, but lets create a random name with tmpfile
+			file, err := ioutil.TempFile(a.path, "WriteFile_")
+			if err != nil {
+				return err
+			}
+			// set gid/pid
+			err = os.Chown(file.Name(), a.pid, a.gid)
+			if err != nil {
+				file.Close()
+				return err
+			}
+			err = write(file, input.GetPayload())
+			if err != nil {
+				return err
+			}
 		}
 	} else {
 		if finfo != nil && !a.append {
@@ -105,18 +91,22 @@ func (a *WriteFile) Handle(ctx context.Context, input payload.Payload, topics ..
 		if err != nil {
 			return err
 		}
-		_, err = fmt.Fprintf(file, "\n%s", string(input.GetPayload()))
-		if err != nil {
+		defer file.Close()
+		writer := bufio.NewWriter(file)
+		for _, input := range inputs {
+			_, err = fmt.Fprintf(writer, "\n%s", string(input.GetPayload()))
+			if err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
 			return err
 		}
 	}
 
 	if a.forward {
-		errs := pubsub.PublishTopics(topics, input)
-		for _, err := range errs {
-			a.errChan <- err
-		}
-		a.metrics.IncrementMetric(a.MetricPayloadOut, 1)
+		emitter.Emit(ctx, inputs...)
+		a.PayloadsOut(len(inputs))
 	}
 	return nil
 
@@ -180,40 +170,3 @@ func (a *WriteFile) ValidateConfiguration() (bool, []string) {
 	a.forward = forward
 	return true, nil
 }
-
-// GetConfiguration will return the CFG for the Handler
-func (a *WriteFile) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *WriteFile) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *WriteFile) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *WriteFile) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	a.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
-	a.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadOut,
-		Description: "keeps track of how many payloads the handler has outputted",
-	})
-	if err != nil {
-		return err
-	}
-	err = a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadIn,
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-
-	return err
-}
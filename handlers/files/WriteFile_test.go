@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
@@ -57,21 +61,21 @@ func TestWriteFileHandle(t *testing.T) {
 			Source:  "test",
 			Payload: tc.data,
 		}
-		err := act.Handle(context.Background(), pay)
+		err := act.Handle(context.Background(), handlers.Discard, pay)
 
 		if !errors.Is(err, tc.expectedErr) {
 			t.Fatalf("%s: %s : %s", tc.name, err, tc.expectedErr)
 		}
 		writeact := act.(*WriteFile)
 		if writeact.append {
-			err := act.Handle(context.Background(), pay)
+			err := act.Handle(context.Background(), handlers.Discard, pay)
 			if !errors.Is(err, tc.expectedErr) {
 				t.Fatalf("%s: %s : %s", tc.name, err, tc.expectedErr)
 			}
 		}
 
 		if writeact.forward {
-			if writeact.metrics.GetMetric(writeact.MetricPayloadOut).Value != 1 {
+			if writeact.Metrics().GetMetric(writeact.MetricPayloadOut).Value != 1 {
 				t.Fatal("Act didnt forward payload")
 			}
 		}
@@ -79,6 +83,60 @@ func TestWriteFileHandle(t *testing.T) {
 	}
 }
 
+func TestWriteFileHandleBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writefilebatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	type testCase struct {
+		name          string
+		path          string
+		expectedFiles int
+	}
+	testcases := []testCase{
+		{name: "file", path: filepath.Join(dir, "batch.txt"), expectedFiles: 1},
+		{name: "directory", path: dir, expectedFiles: 4},
+	}
+
+	for i, tc := range testcases {
+		act := NewWriteFileHandler()
+		act.SetMetricProvider(metric.NewPrometheusProvider(), fmt.Sprintf("%s_%d", "batchprefix", i))
+		cfg := act.GetConfiguration()
+		cfg.SetProperty("path", tc.path)
+		cfg.SetProperty("append", true)
+		cfg.SetProperty("forward", false)
+		if ok, errs := act.ValidateConfiguration(); !ok {
+			t.Fatal(errs)
+		}
+
+		batch := []payload.Payload{
+			payload.NewBasePayload([]byte(`one`), "test", nil),
+			payload.NewBasePayload([]byte(`two`), "test", nil),
+			payload.NewBasePayload([]byte(`three`), "test", nil),
+		}
+		if err := act.(*WriteFile).HandleBatch(context.Background(), handlers.Discard, batch); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != tc.expectedFiles {
+			t.Fatalf("%s: expected %d files, found %d", tc.name, tc.expectedFiles, len(files))
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "batch.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\none\ntwo\nthree" {
+		t.Fatal("the batch was not written properly: ", string(data))
+	}
+}
+
 func TestWriteFileValidateConfiguration(t *testing.T) {
 	type testCase struct {
 		Name        string
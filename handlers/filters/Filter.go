@@ -8,10 +8,8 @@ import (
 	"fmt"
 
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 )
 
@@ -22,21 +20,9 @@ var (
 
 // FilterHandler is used to filter out payloads that contains the wanted values
 type FilterHandler struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg  *property.Configuration `json:"configs" yaml:"configs"`
-	Name string                  `json:"name" yaml:"handler_name"`
-
+	handlers.Base
 	filters      map[string][]*payload.Filter
 	strictgroups []string
-
-	subscriptionless bool
-	errChan          chan error
-	metrics          metric.Provider
-	metricPrefix     string
-	// MetricPayloadOut is how many payloads the processor has outputted
-	MetricPayloadOut string
-	// MetricPayloadIn is how many payloads the processor has inputted
-	MetricPayloadIn string
 }
 
 func init() {
@@ -46,11 +32,7 @@ func init() {
 // NewFilterHandler generates a new Filter Handler
 func NewFilterHandler() handlers.Handler {
 	act := &FilterHandler{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:    "Filter",
-		errChan: make(chan error, 1000),
+		Base:    handlers.NewBase("Filter"),
 		filters: make(map[string][]*payload.Filter, 0),
 	}
 	act.Cfg.AddProperty("strict", "Strict is a array of groupnames that will apply StrictMode, with strictmode all Filters in that group has to match", false)
@@ -59,14 +41,14 @@ func NewFilterHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName is used to retrun a unqiue string name
-func (a *FilterHandler) GetHandlerName() string {
-	return a.Name
+// Relationships returns matched for payloads that passed the filters and unmatched for the rest
+func (a *FilterHandler) Relationships() []string {
+	return []string{handlers.RelationshipMatched, handlers.RelationshipUnmatched}
 }
 
 // Handle is used to check if payload is of Filterable type, then apply Filter to it
-func (a *FilterHandler) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
-	a.metrics.IncrementMetric(a.MetricPayloadIn, 1)
+func (a *FilterHandler) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
+	a.PayloadsIn(1)
 	m, err := a.isPayloadFilterable(input)
 	if err != nil {
 		return fmt.Errorf("%w:%v", ErrNotFilterablePayload, err)
@@ -79,17 +61,12 @@ func (a *FilterHandler) Handle(ctx context.Context, input payload.Payload, topic
 		}
 	}
 	if isMatch(m, metacontainer, a.filters, a.strictgroups) {
-		a.metrics.IncrementMetric(a.MetricPayloadOut, 1)
-		errs := pubsub.PublishTopics(topics, input)
-		if errs != nil {
-			for _, err := range errs {
-				a.errChan <- err
-			}
-		}
+		a.PayloadsOut(1)
+		emitter.Emit(ctx, input)
 		return nil
 	}
 
-	return nil
+	return emitter.EmitTo(ctx, handlers.RelationshipUnmatched, input)
 
 }
 
@@ -214,39 +191,3 @@ func (a *FilterHandler) ValidateConfiguration() (bool, []string) {
 
 	return true, nil
 }
-
-// GetConfiguration will return the CFG for the Handler
-func (a *FilterHandler) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *FilterHandler) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *FilterHandler) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *FilterHandler) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	a.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
-	a.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadOut,
-		Description: "keeps track of how many payloads the handler has outputted",
-	})
-	if err != nil {
-		return err
-	}
-	err = a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadIn,
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-	return err
-}
@@ -1,15 +1,16 @@
 package filters
 
 import (
+	"context"
 	"errors"
 	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 type FilterPayload struct {
@@ -82,13 +83,14 @@ func TestFilterHandle(t *testing.T) {
 		t.Fatal(errs)
 	}
 
+	output := handlers.NewCollector()
 	notfilt := NotFilterPayload{}
-	err := fh.Handle(nil, notfilt, "non")
+	err := fh.Handle(context.Background(), output, notfilt)
 	if !errors.Is(err, ErrNotFilterablePayload) {
 		t.Fatal(err)
 	}
 	pay := payload.NewBasePayload([]byte("perbol"), "filter", nil)
-	err = fh.Handle(nil, pay, "publishme")
+	err = fh.Handle(context.Background(), output, pay)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,21 +105,42 @@ func TestFilterHandle(t *testing.T) {
 	if filtergroups == nil {
 		t.Fatal("Filtergroups should not be nil")
 	}
-	flow, err := pubsub.Subscribe("publishme", 1, 10)
-	if err != nil {
+	if len(output.Payloads()) != 1 {
+		t.Fatal("the handler should have emitted 1 payload")
+	}
+	//t.Log(filtergroups.MapWithInterfaceSlice())
+
+}
+
+func TestFilterHandleUnmatched(t *testing.T) {
+	fh := NewFilterHandler()
+	fh.SetMetricProvider(metric.NewPrometheusProvider(), "filterunmatchedHandler")
+
+	filters := make(map[string][]string, 0)
+	filters["admins"] = append(filters["admins"], "username:^admin$")
+	cfg := fh.GetConfiguration()
+	cfg.SetProperty("filters", filters)
+	if valid, errs := fh.ValidateConfiguration(); !valid {
+		t.Fatal(errs)
+	}
+
+	output := handlers.NewCollector()
+	if err := fh.Handle(context.Background(), output, payload.NewBasePayload([]byte("admin"), "filter", nil)); err != nil {
 		t.Fatal(err)
 	}
-	// Get DefaultEngine and Drain it
-	de, err := pubsub.EngineAsDefaultEngine()
-	if err != nil {
+	if err := fh.Handle(context.Background(), output, payload.NewBasePayload([]byte("perbol"), "filter", nil)); err != nil {
 		t.Fatal(err)
 	}
-	de.DrainTopicsBuffer()
-	if len(flow.Flow) != 1 {
-		t.Fatal("topic should have found 1 payload")
+	if len(output.Payloads()) != 1 || string(output.Payloads()[0].GetPayload()) != "admin" {
+		t.Fatal("the matching payload should be emitted on the primary relationship")
+	}
+	unmatched := output.Relationship(handlers.RelationshipUnmatched)
+	if len(unmatched) != 1 || string(unmatched[0].GetPayload()) != "perbol" {
+		t.Fatal("the payload that did not match should be emitted on unmatched")
+	}
+	if fh.(handlers.Router).Relationships()[0] != handlers.RelationshipMatched {
+		t.Fatal("matched should be the primary relationship")
 	}
-	//t.Log(filtergroups.MapWithInterfaceSlice())
-
 }
 
 func TestFilterIsMatch(t *testing.T) {
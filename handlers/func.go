@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+)
+
+// HandleFunc is a plain function that handles a payload, cfg is the configuration of the Handler with the values set by the user
+type HandleFunc func(ctx context.Context, emitter Emitter, cfg *property.Configuration, input payload.Payload) error
+
+// Func turns a HandleFunc and the properties it needs into a Handler
+// The returned function creates a new copy of the Handler each time and can be given to register.Register
+//
+//	register.Register("Upper", handlers.Func("Upper", upper, property.Property{Name: "suffix", Description: "added to each payload"}))
+//
+// Properties that has a Value uses it as the default value
+func Func(name string, fn HandleFunc, properties ...property.Property) func() Handler {
+	return newFunc(name, fn, false, properties)
+}
+
+// SubscriptionlessFunc is like Func but the Handler is Subscriptionless, fn is called each ExecutionInterval with a nil payload
+// and emits what it generates
+func SubscriptionlessFunc(name string, fn HandleFunc, properties ...property.Property) func() Handler {
+	return newFunc(name, fn, true, properties)
+}
+
+// newFunc returns the function that creates the Handlers of Func and SubscriptionlessFunc
+func newFunc(name string, fn HandleFunc, subscriptionless bool, properties []property.Property) func() Handler {
+	return func() Handler {
+		fh := &funcHandler{
+			Base: NewBase(name),
+			fn:   fn,
+		}
+		fh.SetSubscriptionless(subscriptionless)
+		for _, prop := range properties {
+			fh.Cfg.AddProperty(prop.Name, prop.Description, prop.Required)
+			if prop.Value != nil {
+				fh.Cfg.SetProperty(prop.Name, prop.Value)
+			}
+		}
+		return fh
+	}
+}
+
+// funcHandler is the Handler created by Func
+type funcHandler struct {
+	Base
+	fn HandleFunc
+}
+
+// Handle will run the HandleFunc and count the payloads in and out
+func (fh *funcHandler) Handle(ctx context.Context, emitter Emitter, input payload.Payload) error {
+	if input != nil {
+		fh.PayloadsIn(1)
+	}
+	return fh.fn(ctx, &countingEmitter{emitter: emitter, base: &fh.Base}, fh.Cfg, input)
+}
+
+// countingEmitter increments the payloads_out metric of a Base for each payload emitted
+type countingEmitter struct {
+	emitter Emitter
+	base    *Base
+}
+
+// Emit will count and output the payloads
+func (ce *countingEmitter) Emit(ctx context.Context, payloads ...payload.Payload) {
+	ce.base.PayloadsOut(len(payloads))
+	ce.emitter.Emit(ctx, payloads...)
+}
+
+// EmitTo will count and output the payloads on the relationship
+func (ce *countingEmitter) EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error {
+	if err := ce.emitter.EmitTo(ctx, relationship, payloads...); err != nil {
+		return err
+	}
+	ce.base.PayloadsOut(len(payloads))
+	return nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/percybolmer/go4data/metric"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+)
+
+func upper(ctx context.Context, emitter Emitter, cfg *property.Configuration, input payload.Payload) error {
+	suffix := cfg.GetProperty("suffix").String()
+	input.SetPayload([]byte(strings.ToUpper(string(input.GetPayload())) + suffix))
+	emitter.Emit(ctx, input)
+	return nil
+}
+
+func TestFunc(t *testing.T) {
+	newUpper := Func("Upper", upper,
+		property.Property{Name: "suffix", Description: "added to each payload", Value: "!"},
+		property.Property{Name: "unused", Description: "a required property", Required: true},
+	)
+	handler := newUpper()
+	if handler.GetHandlerName() != "Upper" {
+		t.Fatal("the name should be the one given to Func")
+	}
+	if valid, _ := handler.ValidateConfiguration(); valid {
+		t.Fatal("a missing required property should not be valid")
+	}
+	handler.GetConfiguration().SetProperty("unused", true)
+	if valid, errs := handler.ValidateConfiguration(); !valid {
+		t.Fatal(errs)
+	}
+	if err := handler.SetMetricProvider(metric.NewPrometheusProvider(), "functest"); err != nil {
+		t.Fatal(err)
+	}
+
+	output := NewCollector()
+	if err := handler.Handle(context.Background(), output, payload.NewBasePayload([]byte("hello"), "test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Payloads()) != 1 || string(output.Payloads()[0].GetPayload()) != "HELLO!" {
+		t.Fatal("the function should have handled the payload")
+	}
+	base := handler.(*funcHandler).Base
+	if base.Metrics().GetMetric("functest_payloads_in").Value != 1 || base.Metrics().GetMetric("functest_payloads_out").Value != 1 {
+		t.Fatal("payloads in and out should be counted")
+	}
+
+	// Each Handler gets its own configuration
+	other := newUpper()
+	other.GetConfiguration().SetProperty("suffix", "?")
+	if handler.GetConfiguration().GetProperty("suffix").String() != "!" {
+		t.Fatal("the configuration should not be shared between Handlers")
+	}
+	if handler.Subscriptionless() {
+		t.Fatal("Func should not be subscriptionless")
+	}
+
+	generator := SubscriptionlessFunc("Generate", func(ctx context.Context, emitter Emitter, cfg *property.Configuration, input payload.Payload) error {
+		emitter.Emit(ctx, payload.NewBasePayload([]byte("generated"), "test", nil))
+		return nil
+	})()
+	if !generator.Subscriptionless() {
+		t.Fatal("SubscriptionlessFunc should be subscriptionless")
+	}
+	generated := NewCollector()
+	if err := generator.Handle(context.Background(), generated, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(generated.Payloads()) != 1 {
+		t.Fatal("the function should be called with a nil payload")
+	}
+}
@@ -12,8 +12,8 @@ import (
 // to handle payloads between them.
 type Handler interface {
 	// Handle is the function that will be performed on the incomming Payloads
-	// topics is the topics to push output onto
-	Handle(ctx context.Context, payload payload.Payload, topics ...string) error
+	// Output is sent with the Emitter, Subscriptionless Handlers gets a nil payload
+	Handle(ctx context.Context, emitter Emitter, payload payload.Payload) error
 	// ValidateConfiguration is used to make sure everything that is needed by the handler is set
 	ValidateConfiguration() (bool, []string)
 	// GetConfiguration will return the configuration slice
@@ -32,3 +32,13 @@ type Handler interface {
 	// GetErrorChannel() chan error
 	GetErrorChannel() chan error
 }
+
+// BatchHandler is an optional interface for Handlers that are faster when handling many payloads at once, like database sinks.
+// A Processor that has a BatchHandler will collect payloads from its subscriptions into batches and call HandleBatch instead of Handle
+type BatchHandler interface {
+	Handler
+	// HandleBatch is the function that will be performed on a batch of incomming Payloads
+	// If an error is returned the whole batch is seen as failed
+	// Output is sent with the Emitter
+	HandleBatch(ctx context.Context, emitter Emitter, payloads []payload.Payload) error
+}
@@ -10,10 +10,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
-	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 )
 
@@ -26,12 +23,7 @@ var (
 
 // NetworkInterface is used to read packets from a network interface
 type NetworkInterface struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg *property.Configuration `json:"configs" yaml:"configs"`
-	// Name is sort of like an ID used to load data back should be the same that is used to register the Handler
-	Name string `json:"handler_name" yaml:"handler_name"`
-	// subscriptionless should be set to true if this Handler does not need any input payloads to function
-	subscriptionless bool
+	handlers.Base
 	// bpf is used to apply a bpf filter
 	bpf string
 	// netinterface is the network interface to read from
@@ -41,14 +33,6 @@ type NetworkInterface struct {
 	// link layer
 	// prommode
 	prommode bool
-
-	errChan      chan error
-	metrics      metric.Provider
-	metricPrefix string
-	// MetricPayloadOut is how many payloads the processor has outputted
-	MetricPayloadOut string
-	// MetricPayloadIn is how many payloads the processor has inputted
-	MetricPayloadIn string
 }
 
 func init() {
@@ -58,16 +42,12 @@ func init() {
 // NewNetworkInterfaceHandler generates a new NetworkInterface Handler
 func NewNetworkInterfaceHandler() handlers.Handler {
 	act := &NetworkInterface{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:             "NetworkInterface",
-		subscriptionless: true,
-		snapshotlength:   65536,
-		prommode:         true,
-		errChan:          make(chan error, 1000),
+		Base:           handlers.NewBase("NetworkInterface"),
+		snapshotlength: 65536,
+		prommode:       true,
 	}
 
+	act.SetSubscriptionless(true)
 	act.Cfg.AddProperty("bpf", "A bpf filter to be used on the input interface", false)
 	act.Cfg.AddProperty("snapshotlength", "The snapshot length to use", false)
 	act.Cfg.AddProperty("promiscuousmode", "True or false to use promiscuous mode", false)
@@ -76,13 +56,8 @@ func NewNetworkInterfaceHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName should return the name of the handler that was used in register
-func (a *NetworkInterface) GetHandlerName() string {
-	return a.Name
-}
-
 // Handle is used to sniff network packets on a interface and output all packets
-func (a *NetworkInterface) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
+func (a *NetworkInterface) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
 	// Start processing our packets
 
 	handle, err := pcap.OpenLive(a.netinterface.Name, a.snapshotlength, a.prommode, pcap.BlockForever)
@@ -98,22 +73,17 @@ func (a *NetworkInterface) Handle(ctx context.Context, input payload.Payload, to
 	for {
 		packet, err := packets.NextPacket()
 		if err != nil {
-			a.errChan <- err
+			a.GetErrorChannel() <- err
 			continue
 		}
-		a.metrics.IncrementMetric(a.MetricPayloadOut, 1)
+		a.PayloadsOut(1)
 		// Maybe instead of publishing like this we might need to make a buffer of some sort
 		// that gets dumped from into a new routine so we dont block each packet
 		newpay := &payload.NetworkPayload{
 			Source:  "NetworkInterface",
 			Payload: packet,
 		}
-		errs := pubsub.PublishTopics(topics, newpay)
-		if errs != nil {
-			for _, err := range errs {
-				a.errChan <- err
-			}
-		}
+		emitter.Emit(ctx, newpay)
 	}
 }
 
@@ -164,16 +134,6 @@ func (a *NetworkInterface) ValidateConfiguration() (bool, []string) {
 	return true, nil
 }
 
-// GetConfiguration will return the CFG for the Handler
-func (a *NetworkInterface) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *NetworkInterface) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
 // FindDevices prints all network interface info
 func FindDevices() ([]pcap.Interface, error) {
 	devices, err := pcap.FindAllDevs()
@@ -185,29 +145,3 @@ func FindDevices() ([]pcap.Interface, error) {
 	}
 	return devices, nil
 }
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *NetworkInterface) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *NetworkInterface) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	a.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
-	a.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadOut,
-		Description: "keeps track of how many payloads the handler has outputted",
-	})
-	if err != nil {
-		return err
-	}
-	err = a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadIn,
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-	return err
-}
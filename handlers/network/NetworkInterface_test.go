@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"net"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/property"
 )
@@ -25,8 +27,9 @@ func TestNetworkInterfaceHandle(t *testing.T) {
 		t.Fatal("Failed to validate settings: ", err)
 	}
 
+	output := handlers.NewCollector()
 	go func() {
-		err := nethand.Handle(nil, nil, "test_sniff")
+		err := nethand.Handle(context.Background(), output, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -36,21 +39,16 @@ func TestNetworkInterfaceHandle(t *testing.T) {
 	sendSpoofPacket("lo", t)
 	time.Sleep(3 * time.Second)
 	// See metrics is set
-	outmet := nethand.metrics.GetMetric(nethand.MetricPayloadOut)
+	outmet := nethand.Metrics().GetMetric(nethand.MetricPayloadOut)
 	if outmet == nil {
 		t.Fatal("Failed to sniff packet")
 	} else if outmet.Value == 0 {
 		t.Fatal("No packets found")
 	}
-	// See topic has received item
-	/*topic, suberr := pubsub.Subscribe("test_sniff", 1, 10)
-	if suberr != nil {
-		t.Fatal(suberr)
+	// See packets has been emitted
+	if len(output.Payloads()) == 0 {
+		t.Fatal("Didnt emit any packets")
 	}
-	pubsub.DrainTopicsBuffer()
-	if len(topic.Flow) <= 1 {
-		t.Fatal("Didnt find anything on the topic")
-	}*/
 }
 
 func sendSpoofPacket(device string, t *testing.T) {
@@ -175,13 +173,13 @@ func TestNetworkInterfaceValidateConfiguration(t *testing.T) {
 	}
 
 	rfg.SetMetricProvider(metric.NewPrometheusProvider(), "netint_test")
-	if nethand.metrics == nil || nethand.metricPrefix != "netint_test" {
+	if nethand.Metrics() == nil || nethand.MetricPrefix() != "netint_test" {
 		t.Fatal("Failed to apply metric provider")
 	}
 	if nethand.MetricPayloadIn != "netint_test_payloads_in" || nethand.MetricPayloadOut != "netint_test_payloads_out" {
 		t.Fatal("Wrong payload metrics name set")
 	}
-	if nethand.metrics.GetMetric("netint_test_payloads_in") == nil || nethand.metrics.GetMetric("netint_test_payloads_out") == nil {
+	if nethand.Metrics().GetMetric("netint_test_payloads_in") == nil || nethand.Metrics().GetMetric("netint_test_payloads_out") == nil {
 		t.Fatal("Didnt create payload metrics")
 	}
 }
@@ -3,11 +3,10 @@ package network
 import (
 	"context"
 	"testing"
-	"time"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 func TestOpenPcapHandle(t *testing.T) {
@@ -19,33 +18,24 @@ func TestOpenPcapHandle(t *testing.T) {
 	}
 	pcapHandler.SetMetricProvider(metric.NewPrometheusProvider(), "pcaphandler")
 	pcapHandler.bpf = "tcp and ip"
-	err := pcapHandler.Handle(context.Background(), testPayload, "packets")
+	output := handlers.NewCollector()
+	err := pcapHandler.Handle(context.Background(), output, testPayload)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pipe, err := pubsub.Subscribe("packets", 1, 100)
-	if err != nil {
-		t.Fatal(err)
+	if len(output.Payloads()) == 0 {
+		t.Fatal("no packets was emitted")
 	}
-
-	exit := time.NewTicker(2 * time.Second)
-
-	for {
-		select {
-		case pay := <-pipe.Flow:
-			netpay, err := payload.NewNetworkPayload(pay)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if len(netpay.Payload.Data()) == 0 {
-				t.Fatalf("Wrong packet length, %s", netpay.Payload.Dump())
-			}
-			//t.Log(netpay.Payload.Dump())
-
-		case <-exit.C:
-			return
+	for _, pay := range output.Payloads() {
+		netpay, err := payload.NewNetworkPayload(pay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(netpay.Payload.Data()) == 0 {
+			t.Fatalf("Wrong packet length, %s", netpay.Payload.Dump())
 		}
+		//t.Log(netpay.Payload.Dump())
 	}
 }
 
@@ -7,14 +7,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"strings"
 
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 )
 
@@ -34,25 +31,13 @@ var (
 
 // ParseCSV is used to parse CSV files, expects whole payloads
 type ParseCSV struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg  *property.Configuration `json:"configs" yaml:"configs"`
-	Name string                  `json:"handler_name" yaml:"handler_name"`
+	handlers.Base
 	// delimiter is the character to use for delimiting
 	delimiter string
 	// headerlength is a int that is used for the base of the header, some files has duplicate headers etc
 	headerlength int
 	// skiprows is used to skip some rows if there is excess rows in the file
 	skiprows int
-
-	subscriptionless bool
-	errChan          chan error
-
-	metrics      metric.Provider
-	metricPrefix string
-	// MetricPayloadOut is how many payloads the processor has outputted
-	MetricPayloadOut string
-	// MetricPayloadIn is how many payloads the processor has inputted
-	MetricPayloadIn string
 }
 
 func init() {
@@ -62,14 +47,10 @@ func init() {
 // NewParseCSVHandler generates a new ParseCSV Handler
 func NewParseCSVHandler() handlers.Handler {
 	act := &ParseCSV{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:         "ParseCSV",
+		Base:         handlers.NewBase("ParseCSV"),
 		delimiter:    DefaultDelimiter,
 		headerlength: DefaultHeaderLength,
 		skiprows:     DefaultSkipRows,
-		errChan:      make(chan error, 1000),
 	}
 	act.Cfg.AddProperty("delimiter", "The character or string to use as a Delimiter", false)
 	act.Cfg.AddProperty("headerlength", "How many rows the header is", false)
@@ -77,14 +58,9 @@ func NewParseCSVHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName is used to retrun a unqiue string name
-func (a *ParseCSV) GetHandlerName() string {
-	return a.Name
-}
-
 // Handle will go through a CSV payload and output all the CSV rows
-func (a ParseCSV) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
-	a.metrics.IncrementMetric(a.MetricPayloadIn, 1)
+func (a ParseCSV) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
+	a.PayloadsIn(1)
 	buf := bytes.NewBuffer(input.GetPayload())
 
 	scanner := bufio.NewScanner(buf)
@@ -122,18 +98,18 @@ func (a ParseCSV) Handle(ctx context.Context, input payload.Payload, topics ...s
 			return ErrHeaderMismatch
 		}
 		// Handle the CSV ROW as a Map of string, should this be interface?
-		newRow := payload.NewCsvPayload(headerRow, line, a.delimiter, nil)
+		// Each row gets its own copy of the metadata so that rows can be changed independently
+		var meta *property.Configuration
+		if input.GetMetaData() != nil {
+			meta = input.GetMetaData().Copy()
+		}
+		newRow := payload.NewCsvPayload(headerRow, line, a.delimiter, meta)
 		result = append(result, newRow)
 	}
 
 	// Publish rows
-	a.metrics.IncrementMetric(a.MetricPayloadOut, float64(len(result)))
-	errs := pubsub.PublishTopics(topics, result...)
-	if errs != nil {
-		for _, err := range errs {
-			a.errChan <- err
-		}
-	}
+	a.PayloadsOut(len(result))
+	emitter.Emit(ctx, result...)
 	return nil
 }
 
@@ -172,40 +148,3 @@ func (a *ParseCSV) ValidateConfiguration() (bool, []string) {
 	}
 	return true, nil
 }
-
-// GetConfiguration will return the CFG for the Handler
-func (a *ParseCSV) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *ParseCSV) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *ParseCSV) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *ParseCSV) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	a.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
-	a.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadOut,
-		Description: "keeps track of how many payloads the handler has outputted",
-	})
-	if err != nil {
-		return err
-	}
-	err = a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadIn,
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-
-	return err
-}
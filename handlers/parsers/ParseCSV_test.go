@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
@@ -57,17 +58,21 @@ func TestParseCSVHandle(t *testing.T) {
 			d.WriteString(s)
 		}
 
-		err := r.Handle(context.Background(), &payload.BasePayload{
+		output := handlers.NewCollector()
+		err := r.Handle(context.Background(), output, &payload.BasePayload{
 			Payload: d.Bytes(),
-		}, "test")
+		})
 
 		if !errors.Is(err, tc.ExpectedError) {
 			t.Fatalf("%s: %s", tc.Name, err)
 		}
-		invalue := r.metrics.GetMetric(r.MetricPayloadOut).Value
+		invalue := r.Metrics().GetMetric(r.MetricPayloadOut).Value
 		if int(invalue) != tc.ExpectedRowLength {
 			t.Fatalf("%s: Wrong length on result: %f", tc.Name, invalue)
 		}
+		if len(output.Payloads()) != tc.ExpectedRowLength {
+			t.Fatalf("%s: Wrong amount of emitted rows: %d", tc.Name, len(output.Payloads()))
+		}
 
 	}
 }
@@ -11,35 +11,22 @@ import (
 	"strings"
 
 	"github.com/percybolmer/go4data/handlers"
-	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 	"github.com/percybolmer/go4data/register"
 )
 
 // ExecCMD is used to execute a commandline command. This can be used to extend and use functions that are not part of the Workflow atm.
 type ExecCMD struct {
-	// Cfg is values needed to properly run the Handle func
-	Cfg  *property.Configuration `json:"configs" yaml:"configs"`
-	Name string                  `json:"handler_name" yaml:"handler_name"`
+	handlers.Base
 	// command is the command to run in terminal
 	command string
 	// arguments is a set of arguments to include in the command
 	arguments []string
-	// Subscriptionless is set to true if Payload is set in the arguments
-	subscriptionless bool
 	// appendOldPayload is a value that can be set to add the exec output to the old payload, used if you want to keep the payload that went into this one
 	appendOldPayload bool
 	// appendDelimiter is a value that will be set to separate the newpayload
 	appendDelimiter string
-	errChan         chan error
-	metrics         metric.Provider
-	metricPrefix    string
-	// MetricPayloadOut is how many payloads the processor has outputted
-	MetricPayloadOut string
-	// MetricPayloadIn is how many payloads the processor has inputted
-	MetricPayloadIn string
 }
 
 var (
@@ -56,15 +43,10 @@ func init() {
 // NewExecCMDHandler generates a new ExecCMD Handler
 func NewExecCMDHandler() handlers.Handler {
 	act := &ExecCMD{
-		Cfg: &property.Configuration{
-			Properties: make([]*property.Property, 0),
-		},
-		Name:             "ExecCMD",
-		errChan:          make(chan error, 1000),
-		metrics:          metric.NewPrometheusProvider(),
+		Base:             handlers.NewBase("ExecCMD"),
 		appendOldPayload: false,
-		subscriptionless: true,
 	}
+	act.SetSubscriptionless(true)
 	act.Cfg.AddProperty("command", "the command to run ", true)
 	act.Cfg.AddProperty("arguments", "The arguments to add to the command, if this list of arguments contains the word payload, It will print the payload of the incomming payload as an argument", false)
 	act.Cfg.AddProperty("append_old_payload", "Setting this to true will make the output of the handler become the oldpayload + the exec payload", false)
@@ -73,28 +55,44 @@ func NewExecCMDHandler() handlers.Handler {
 	return act
 }
 
-// GetHandlerName is used to retrun a unqiue string name
-func (a *ExecCMD) GetHandlerName() string {
-	return a.Name
+// Relationships returns success for the output of commands and failure for inputs where the command failed
+// Failed inputs are returned as errors, the Processor routes a copy of them with the error added to failure after any retries
+func (a *ExecCMD) Relationships() []string {
+	return []string{handlers.RelationshipSuccess, handlers.RelationshipFailure}
 }
 
 // Handle is used to execute a Command if its set and ValidateConfiguration has been
 // properly run
-func (a *ExecCMD) Handle(ctx context.Context, input payload.Payload, topics ...string) error {
-	a.metrics.IncrementMetric(a.MetricPayloadIn, 1)
+func (a *ExecCMD) Handle(ctx context.Context, emitter handlers.Emitter, input payload.Payload) error {
+	a.PayloadsIn(1)
 	pay, err := a.Exec(input)
 	if err != nil {
-		return err
+		// The error is added to a copy of the input, the Processor publishes the copy on the failure relationship when it has given up on it
+		return handlers.Failed(err, withExecError(input, err))
 	}
-	a.metrics.IncrementMetric(a.MetricPayloadOut, 1)
+	a.PayloadsOut(1)
+	emitter.Emit(ctx, pay)
+	return nil
+}
 
-	errs := pubsub.PublishTopics(topics, pay)
-	if errs != nil {
-		for _, err := range errs {
-			a.errChan <- err
-		}
+// withExecError returns a copy of the input with the error in its exec_error metadata, the input is shared and left as it is
+func withExecError(input payload.Payload, err error) payload.Payload {
+	if input == nil {
+		return nil
 	}
-	return nil
+	meta := property.NewConfiguration()
+	if input.GetMetaData() != nil {
+		meta = input.GetMetaData().Copy()
+	}
+	if meta.GetProperty("exec_error") == nil {
+		meta.AddProperty("exec_error", "the error from the command that failed", false)
+	}
+	meta.SetProperty("exec_error", err.Error())
+	source := "ExecCMD"
+	if base, ok := input.(*payload.BasePayload); ok {
+		source = base.Source
+	}
+	return payload.NewBasePayload(input.GetPayload(), source, meta)
 }
 
 // Exec will execute the command
@@ -181,7 +179,7 @@ func (a *ExecCMD) ValidateConfiguration() (bool, []string) {
 		for _, arg := range splice {
 			if strings.Contains(arg, "payload") {
 				// This should make INGRESS not required since we expect payloads
-				a.subscriptionless = false
+				a.SetSubscriptionless(false)
 			}
 		}
 		a.arguments = splice
@@ -190,39 +188,3 @@ func (a *ExecCMD) ValidateConfiguration() (bool, []string) {
 
 	return true, nil
 }
-
-// GetConfiguration will return the CFG for the Handler
-func (a *ExecCMD) GetConfiguration() *property.Configuration {
-	return a.Cfg
-}
-
-// Subscriptionless will return true/false if the Handler is genereating payloads itself
-func (a *ExecCMD) Subscriptionless() bool {
-	return a.subscriptionless
-}
-
-// GetErrorChannel will return a channel that the Handler can output eventual errors onto
-func (a *ExecCMD) GetErrorChannel() chan error {
-	return a.errChan
-}
-
-// SetMetricProvider is used to change what metrics provider is used by the handler
-func (a *ExecCMD) SetMetricProvider(p metric.Provider, prefix string) error {
-	a.metrics = p
-	a.metricPrefix = prefix
-
-	a.MetricPayloadIn = fmt.Sprintf("%s_payloads_in", prefix)
-	a.MetricPayloadOut = fmt.Sprintf("%s_payloads_out", prefix)
-	err := a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadOut,
-		Description: "keeps track of how many payloads the handler has outputted",
-	})
-	if err != nil {
-		return err
-	}
-	err = a.metrics.AddMetric(&metric.Metric{
-		Name:        a.MetricPayloadIn,
-		Description: "keeps track of how many payloads the handler has ingested",
-	})
-	return err
-}
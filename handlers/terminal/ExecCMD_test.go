@@ -1,14 +1,15 @@
 package terminal
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 func TestExecCMDHandle(t *testing.T) {
@@ -63,20 +64,37 @@ func TestExecCMDHandle(t *testing.T) {
 	if string(pay.GetPayload()) != "World->Hello World!" {
 		t.Fatal("Wrong payload back after append: ", string(pay.GetPayload()))
 	}
-	output, err := pubsub.Subscribe("output", 1, 10)
-	if err != nil {
-		t.Fatal(err)
-	}
+	output := handlers.NewCollector()
 	pay = payload.NewBasePayload([]byte("World"), "test", nil)
-	err = rfg.Handle(nil, pay, "output")
+	err = rfg.Handle(context.Background(), output, pay)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(output.Flow) != 1 {
+	if len(output.Payloads()) != 1 {
 		t.Fatal("Didnt properly receive item")
 	}
 
+	// A failing command returns the error with a copy of the input that has the error added, the Processor routes the copy to the failure relationship
+	rfg.Cfg.SetProperty("command", "false")
+	rfg.Cfg.SetProperty("arguments", []string{})
+	rfg.ValidateConfiguration()
+	failing := payload.NewBasePayload([]byte("World"), "test", property.NewConfiguration())
+	err = rfg.Handle(context.Background(), output, failing)
+	var failed *handlers.FailedError
+	if !errors.As(err, &failed) {
+		t.Fatal("a failing command should return a FailedError: ", err)
+	}
+	if len(output.Relationship(handlers.RelationshipFailure)) != 0 {
+		t.Fatal("the handler should not emit failures itself")
+	}
+	if failed.Payload.GetMetaData().GetProperty("exec_error") == nil || string(failed.Payload.GetPayload()) != "World" {
+		t.Fatal("the error should be added to the metadata of the copy")
+	}
+	if failing.GetMetaData().GetProperty("exec_error") != nil {
+		t.Fatal("the input should not be changed")
+	}
+
 }
 
 func TestExecCMDValidateConfiguration(t *testing.T) {
@@ -177,10 +195,10 @@ func TestExecCMDSetMetric(t *testing.T) {
 	}
 	handler := rfg.(*ExecCMD)
 
-	if handler.metrics == nil {
+	if handler.Metrics() == nil {
 		t.Fatal("Metrics not created")
 	}
-	if handler.metricPrefix != "exec_provider" {
+	if handler.MetricPrefix() != "exec_provider" {
 		t.Fatal("Metricsprefix not applied")
 	}
 
@@ -190,9 +208,9 @@ func TestExecCMDSetMetric(t *testing.T) {
 		t.Fatal("payloads out metric is wrong")
 	}
 
-	if handler.metrics.GetMetric("exec_provider_payloads_out") == nil {
+	if handler.Metrics().GetMetric("exec_provider_payloads_out") == nil {
 		t.Fatal("Didnt create payloads out")
-	} else if handler.metrics.GetMetric("exec_provider_payloads_in") == nil {
+	} else if handler.Metrics().GetMetric("exec_provider_payloads_in") == nil {
 		t.Fatal("Didnt create payloads in")
 	}
 }
@@ -1,13 +1,14 @@
 package terminal
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/pubsub"
 )
 
 func TestHandle(t *testing.T) {
@@ -21,22 +22,13 @@ func TestHandle(t *testing.T) {
 
 	rfg.SetMetricProvider(metric.NewPrometheusProvider(), "teststdouthandler")
 
-	err = rfg.Handle(nil, payload.NewBasePayload([]byte("test"), "test", nil), "test")
+	output := handlers.NewCollector()
+	err = rfg.Handle(context.Background(), output, payload.NewBasePayload([]byte("test"), "test", nil))
 	if err != nil {
 		t.Fatal(err)
 	}
-	output, err := pubsub.Subscribe("test", 1, 10)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Get DefaultEngine and Drain it
-	de, err := pubsub.EngineAsDefaultEngine()
-	if err != nil {
-		t.Fatal(err)
-	}
-	de.DrainTopicsBuffer()
 
-	if len(output.Flow) != 1 {
+	if len(output.Payloads()) != 1 {
 		t.Fatal("Bad output length")
 	}
 
@@ -105,17 +97,17 @@ func TestStdoutMetrics(t *testing.T) {
 	}
 
 	handler.SetMetricProvider(metric.NewPrometheusProvider(), "test")
-	if handler.metrics == nil {
+	if handler.Metrics() == nil {
 		t.Fatal("Should not have failed to assigned metric")
 	}
 
-	if handler.metricPrefix != "test" {
+	if handler.MetricPrefix() != "test" {
 		t.Fatal("Pefix not applied")
 	}
-	if met := handler.metrics.GetMetric("test_payloads_in"); met == nil {
+	if met := handler.Metrics().GetMetric("test_payloads_in"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
-	if met := handler.metrics.GetMetric("test_payloads_out"); met == nil {
+	if met := handler.Metrics().GetMetric("test_payloads_out"); met == nil {
 		t.Fatal("Didnt create payload in metric")
 	}
 	if handler.GetHandlerName() != "Stdout" {
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"io/ioutil"
+	"time"
 
 	"github.com/percybolmer/go4data/property"
-	"github.com/percybolmer/go4data/register"
+	"github.com/percybolmer/go4data/ratelimit"
+	"github.com/percybolmer/go4data/schedule"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,6 +23,11 @@ func Save(path string, data interface{}) error {
 
 // Load will return a slice of processors loaded from a config
 func Load(path string) ([]*Processor, error) {
+	return defaultEnvironment.Load(path)
+}
+
+// LoadLoaders will read a config into LoaderProccessors without creating any processors
+func LoadLoaders(path string) ([]*LoaderProccessor, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -30,15 +37,7 @@ func Load(path string) ([]*Processor, error) {
 	if err != nil {
 		return nil, err
 	}
-	var realproc []*Processor
-	for _, proc := range procs {
-		rp, err := proc.ConvertToProcessor()
-		if err != nil {
-			return nil, err
-		}
-		realproc = append(realproc, rp)
-	}
-	return realproc, nil
+	return procs, nil
 }
 
 // LoaderProccessor is used to load/save processors
@@ -50,14 +49,49 @@ type LoaderProccessor struct {
 	Name string `json:"name" yaml:"name"`
 	// Running is a boolean indicator if the processor is currently Running
 	Running bool `json:"running" yaml:"running"`
+	// Paused is true if the processor should not handle payloads until it is resumed
+	Paused bool `json:"paused" yaml:"paused"`
 	// Workers is a int that represents how many concurrent handlers to run
 	Workers int `json:"workers" yaml:"workers"`
 	// Topics is the Topics to publish payload onto
 	Topics []string `json:"topics" yaml:"topics"`
+	// Relationships maps relationships that the Handler emits on to their own topics
+	Relationships map[string][]string `json:"relationships" yaml:"relationships"`
+	// Unrouted is drop or error and decides what happens to payloads emitted on relationships without topics
+	Unrouted string `json:"unrouted" yaml:"unrouted"`
 	// Subscriptions is the Topics to subscribe to
 	Subscriptions []string `json:"subscriptions" yaml:"subscriptions"`
+	// Group is the consumer group to subscribe with, processors in the same group share the payloads of their subscriptions
+	Group string `json:"group" yaml:"group"`
 	// QueueSize is a integer of how many payloads are accepted on the Output channels to Subscribers
 	QueueSize int `json:"queuesize" yaml:"queuesize"`
+	// ExecutionInterval is how often a Subscriptionless Handler is executed, written as 10s, 5m etc
+	ExecutionInterval time.Duration `json:"executioninterval" yaml:"executioninterval"`
+	// Cron is a cron expression used to schedule Subscriptionless Handlers instead of ExecutionInterval
+	Cron string `json:"cron" yaml:"cron"`
+	// RunWindow limits executions of Subscriptionless Handlers to a certain time of the day
+	RunWindow *schedule.Window `json:"runwindow" yaml:"runwindow"`
+	// HandleTimeout is the longest time a Handler may spend on one call, written as 10s, 5m etc
+	// It only works for Handlers that returns when their ctx is done
+	HandleTimeout time.Duration `json:"handle_timeout" yaml:"handle_timeout"`
+	// MinWorkers is the least amount of workers per subscription when autoscaling
+	MinWorkers int `json:"min_workers" yaml:"min_workers"`
+	// MaxWorkers turns on autoscaling when set
+	MaxWorkers int `json:"max_workers" yaml:"max_workers"`
+	// RateLimit is how many payloads per second the processor handles, 0 means no limit
+	RateLimit float64 `json:"rate_limit" yaml:"rate_limit"`
+	// Burst is how many payloads that can be handled at once before the RateLimit kicks in
+	Burst int `json:"burst" yaml:"burst"`
+	// Retry is the policy used to retry failed payloads
+	Retry *RetryPolicy `json:"retry" yaml:"retry"`
+	// Batch decides how payloads are batched when the Handler is a BatchHandler
+	Batch *BatchConfig `json:"batch" yaml:"batch"`
+	// Ordered makes a processor with many Workers publish its output in the same order as the payloads arrived
+	Ordered bool `json:"ordered" yaml:"ordered"`
+	// PartitionKey is a metadata property used in Ordered mode to only keep the order between payloads with the same value
+	PartitionKey string `json:"partitionkey" yaml:"partitionkey"`
+	// FailureHandler is the Registered FailureHandler to use, the default PrintFailure is used if its not set
+	FailureHandler *LoaderFailureHandler `json:"failurehandler" yaml:"failurehandler"`
 	// LoaderHandler is a Handler that can be loaded/saved
 	Handler LoaderHandler `json:"loaderhandler" yaml:"handler"`
 }
@@ -68,12 +102,81 @@ type LoaderHandler struct {
 	Name string                  `json:"handler" yaml:"handler_name"`
 }
 
+// LoaderFailureHandler is a Registered FailureHandler and its configuration
+type LoaderFailureHandler struct {
+	Cfg  *property.Configuration `json:"configs" yaml:"configs"`
+	Name string                  `json:"name" yaml:"name"`
+}
+
 // ConvertToProcessor is used to convert a Loader back into a Processor thats
 // Runnable.
 func (la *LoaderProccessor) ConvertToProcessor() (*Processor, error) {
+	return la.convert(defaultEnvironment)
+}
+
+// convert creates a Runnable Processor in the Environment
+func (la *LoaderProccessor) convert(env *Environment) (*Processor, error) {
+	p, err := la.build(env)
+	if err != nil {
+		return nil, err
+	}
+	// Resubscribe to Subscriptions
+	err = p.Subscribe(la.Subscriptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if LA.Running is true, then start?
+	if la.Running {
+		err = p.Start(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// build will create the Processor and its Handler in the Environment and validate the configuration
+// It does not Subscribe or Start the processor
+func (la *LoaderProccessor) build(env *Environment) (*Processor, error) {
 	// Load all Processor stuff, Topics etc etc
-	p := NewProcessor(la.Name, la.Topics...)
+	p := env.NewProcessor(la.Name, la.Topics...)
 	p.QueueSize = la.QueueSize
+	p.ExecutionInterval = la.ExecutionInterval
+	p.Cron = la.Cron
+	p.RunWindow = la.RunWindow
+	p.Ordered = la.Ordered
+	p.HandleTimeout = la.HandleTimeout
+	if _, err := ratelimit.New(la.RateLimit, la.Burst); err != nil {
+		return nil, err
+	}
+	p.RateLimit = la.RateLimit
+	p.Burst = la.Burst
+	if la.Paused {
+		p.Pause()
+	}
+	p.PartitionKey = la.PartitionKey
+	p.Group = la.Group
+	if _, err := p.buildSchedule(); err != nil {
+		return nil, err
+	}
+	if la.Retry != nil {
+		if err := la.Retry.Validate(); err != nil {
+			return nil, err
+		}
+		p.Retry = la.Retry
+	}
+	if la.Batch != nil {
+		if err := la.Batch.Validate(); err != nil {
+			return nil, err
+		}
+		p.Batch = la.Batch
+	}
+	if la.FailureHandler != nil {
+		if err := p.SetFailureHandler(la.FailureHandler.Name, la.FailureHandler.Cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	//Set default value for Workers to 1 if un configured
 	if la.Workers == 0 {
@@ -81,13 +184,23 @@ func (la *LoaderProccessor) ConvertToProcessor() (*Processor, error) {
 	} else {
 		p.Workers = la.Workers
 	}
+	p.MinWorkers = la.MinWorkers
+	p.MaxWorkers = la.MaxWorkers
+	if err := p.validateWorkerLimits(); err != nil {
+		return nil, err
+	}
 	// Get NewHandler from Register
 
-	handler, err := register.GetHandler(la.Handler.Name)
+	handler, err := env.GetHandler(la.Handler.Name)
 	if err != nil {
 		return nil, err
 	}
 	p.Handler = handler
+	p.Relationships = la.Relationships
+	p.Unrouted = la.Unrouted
+	if err := p.validateRelationships(); err != nil {
+		return nil, err
+	}
 
 	cfg := p.Handler.GetConfiguration()
 	// Apply Configs
@@ -102,20 +215,5 @@ func (la *LoaderProccessor) ConvertToProcessor() (*Processor, error) {
 	if !worked && errs != nil {
 		return nil, errors.New(errs[0])
 	}
-	// Resubscribe to Subscriptions
-	err = p.Subscribe(la.Subscriptions...)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if LA.Running is true, then start?
-	if la.Running {
-		err = p.Start(context.Background())
-		if err != nil {
-			return nil, err
-		}
-	}
-	// What FailureHandler has been applied? Does FH need a GetName aswelL?
-	// ANd maybe a RegisterFailureHandler?
 	return p, nil
 }
@@ -1,12 +1,15 @@
 package go4data
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/percybolmer/go4data/handlers/files"
+	"github.com/percybolmer/go4data/ratelimit"
+	"github.com/percybolmer/go4data/schedule"
 )
 
 func generateProcs(t *testing.T) []*Processor {
@@ -93,3 +96,320 @@ func TestLoadSlice(t *testing.T) {
 
 	t.Logf("%+v", loaded)
 }
+
+func TestLoadSchedule(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].ExecutionInterval = 10 * time.Second
+	procs[1].Cron = "*/5 * * * *"
+	procs[1].RunWindow = &schedule.Window{Start: "08:00", End: "17:00"}
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/schedule.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/schedule.yml")
+
+	loaded, err := Load("testing/loader/schedule.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].ExecutionInterval != 10*time.Second {
+		t.Fatal("execution interval was not loaded: ", loaded[0].ExecutionInterval)
+	}
+	if loaded[1].Cron != "*/5 * * * *" {
+		t.Fatal("cron was not loaded")
+	}
+	if loaded[1].RunWindow == nil || loaded[1].RunWindow.Start != "08:00" || loaded[1].RunWindow.End != "17:00" {
+		t.Fatal("run window was not loaded")
+	}
+
+	bad := procs[0].ConvertToLoader()
+	bad.ExecutionInterval = 0
+	bad.Cron = "* * *"
+	if _, err := bad.ConvertToProcessor(); !errors.Is(err, schedule.ErrBadCronExpression) {
+		t.Fatal("should fail to convert a bad cron expression: ", err)
+	}
+}
+
+func TestLoadRetry(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].Retry = &RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second, Jitter: 0.2, RetryOn: []string{"connection refused"}}
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/retry.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/retry.yml")
+
+	loaded, err := Load("testing/loader/retry.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := loaded[0].Retry
+	if rp == nil || rp.MaxAttempts != 5 || rp.InitialBackoff != 100*time.Millisecond || rp.MaxBackoff != 10*time.Second || rp.Jitter != 0.2 || len(rp.RetryOn) != 1 {
+		t.Fatal("retry policy was not loaded: ", rp)
+	}
+	if loaded[1].Retry != nil {
+		t.Fatal("processors without a policy should not get one")
+	}
+
+	bad := procs[0].ConvertToLoader()
+	bad.Retry = &RetryPolicy{Jitter: 2}
+	if _, err := bad.ConvertToProcessor(); !errors.Is(err, ErrBadRetryPolicy) {
+		t.Fatal("should fail to convert a bad retry policy: ", err)
+	}
+}
+
+func TestLoadFailureHandler(t *testing.T) {
+	procs := generateProcs(t)
+	if err := procs[0].SetFailureHandler("deadletter", failureHandlerConfig("topic", "failed_payloads")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/failurehandler.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/failurehandler.yml")
+
+	loaded, err := LoadLoaders("testing/loader/failurehandler.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh := loaded[0].FailureHandler
+	if fh == nil || fh.Name != "deadletter" || fh.Cfg.GetProperty("topic").String() != "failed_payloads" {
+		t.Fatal("failurehandler was not loaded: ", fh)
+	}
+	if loaded[1].FailureHandler != nil {
+		t.Fatal("processors without a failurehandler should not get one")
+	}
+
+	loaded[0].FailureHandler = &LoaderFailureHandler{Name: "nosuchhandler"}
+	if _, err := loaded[0].ConvertToProcessor(); !errors.Is(err, ErrFailureHandlerNotRegistered) {
+		t.Fatal("should fail to convert an unregistered failurehandler: ", err)
+	}
+	loaded[0].FailureHandler = &LoaderFailureHandler{Name: "deadletter"}
+	if _, err := loaded[0].ConvertToProcessor(); !errors.Is(err, ErrMissingFailureHandlerProperty) {
+		t.Fatal("should fail to convert a failurehandler without config: ", err)
+	}
+}
+
+func TestLoadBatch(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].Batch = &BatchConfig{Size: 500, Bytes: 1048576, Linger: 5 * time.Second}
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/batch.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/batch.yml")
+
+	loaded, err := Load("testing/loader/batch.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := loaded[0].Batch
+	if bc == nil || bc.Size != 500 || bc.Bytes != 1048576 || bc.Linger != 5*time.Second {
+		t.Fatal("batch config was not loaded: ", bc)
+	}
+
+	bad := procs[0].ConvertToLoader()
+	bad.Batch = &BatchConfig{Linger: -time.Second}
+	if _, err := bad.ConvertToProcessor(); !errors.Is(err, ErrBadBatchConfig) {
+		t.Fatal("should fail to convert a bad batch config: ", err)
+	}
+}
+
+func TestLoadOrderedAndPaused(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].Ordered = true
+	procs[0].PartitionKey = "filepath"
+	procs[1].Pause()
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/ordered.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/ordered.yml")
+
+	loaded, err := Load("testing/loader/ordered.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded[0].Ordered || loaded[0].PartitionKey != "filepath" {
+		t.Fatal("ordered settings was not loaded")
+	}
+	if loaded[1].Ordered {
+		t.Fatal("processors should not be ordered by default")
+	}
+	if loaded[0].IsPaused() || !loaded[1].IsPaused() {
+		t.Fatal("paused state was not loaded")
+	}
+}
+
+func TestLoadGroup(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].Group = "archivers"
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/group.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/group.yml")
+
+	loaded, err := Load("testing/loader/group.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].Group != "archivers" || loaded[1].Group != "" {
+		t.Fatal("the consumer group was not loaded")
+	}
+}
+
+func TestLoadRelationships(t *testing.T) {
+	procs := generateProcs(t)
+	procs[1].Relationships = map[string][]string{"success": {"more_file_data"}}
+	procs[1].Unrouted = UnroutedError
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/relationships.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/relationships.yml")
+
+	loaded, err := Load("testing/loader/relationships.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded[1].Relationships["success"]) != 1 || loaded[1].Unrouted != UnroutedError {
+		t.Fatal("relationships was not loaded")
+	}
+
+	// ListDirectory does not emit on matched
+	loaders[0].Relationships = map[string][]string{"matched": {"alerts"}}
+	if _, err := loaders[0].ConvertToProcessor(); !errors.Is(err, ErrUnknownRelationship) {
+		t.Fatal("expected ErrUnknownRelationship: ", err)
+	}
+	loaders[0].Relationships = nil
+	loaders[0].Unrouted = "explode"
+	if _, err := loaders[0].ConvertToProcessor(); !errors.Is(err, ErrBadUnrouted) {
+		t.Fatal("expected ErrBadUnrouted: ", err)
+	}
+}
+
+func TestLoadHandleTimeout(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].HandleTimeout = 3 * time.Second
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/handletimeout.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/handletimeout.yml")
+
+	loaded, err := Load("testing/loader/handletimeout.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].HandleTimeout != 3*time.Second {
+		t.Fatal("handle_timeout was not loaded: ", loaded[0].HandleTimeout)
+	}
+	if loaded[1].HandleTimeout != 0 {
+		t.Fatal("processors without a handle_timeout should not get one")
+	}
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].RateLimit = 2.5
+	procs[0].Burst = 10
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/ratelimit.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/ratelimit.yml")
+
+	loaded, err := Load("testing/loader/ratelimit.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].RateLimit != 2.5 || loaded[0].Burst != 10 {
+		t.Fatal("rate_limit and burst was not loaded: ", loaded[0].RateLimit, loaded[0].Burst)
+	}
+	if loaded[1].RateLimit != 0 {
+		t.Fatal("processors without a rate_limit should not get one")
+	}
+
+	bad := procs[0].ConvertToLoader()
+	bad.Burst = -1
+	if _, err := bad.ConvertToProcessor(); !errors.Is(err, ratelimit.ErrBadLimit) {
+		t.Fatal("should fail to convert a bad rate limit: ", err)
+	}
+}
+
+func TestLoadWorkerLimits(t *testing.T) {
+	procs := generateProcs(t)
+	procs[0].MinWorkers = 2
+	procs[0].MaxWorkers = 8
+
+	loaders := make([]*LoaderProccessor, 0)
+	for _, proc := range procs {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	err := Save("testing/loader/workerlimits.yml", loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/workerlimits.yml")
+
+	loaded, err := Load("testing/loader/workerlimits.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[0].MinWorkers != 2 || loaded[0].MaxWorkers != 8 {
+		t.Fatal("min_workers and max_workers was not loaded: ", loaded[0].MinWorkers, loaded[0].MaxWorkers)
+	}
+
+	bad := procs[0].ConvertToLoader()
+	bad.MinWorkers = 10
+	if _, err := bad.ConvertToProcessor(); !errors.Is(err, ErrBadWorkerLimits) {
+		t.Fatal("should fail to convert bad worker limits: ", err)
+	}
+}
@@ -4,6 +4,7 @@ package metric
 type Provider interface {
 	AddMetric(*Metric) error
 	IncrementMetric(name string, value float64) error
+	SetMetric(name string, value float64) error
 	GetMetrics() map[string]*Metric
 	GetMetric(name string) *Metric
 }
@@ -14,4 +15,6 @@ type Metric struct {
 	Description string  `json:"description" yaml:"description"`
 	Name        string  `json:"name" yaml:"name"`
 	Value       float64 `json:"value" yaml:"value"`
+	// Gauge is true for metrics that can go both up and down, like how many workers are running. Only Gauges can be Set
+	Gauge bool `json:"gauge" yaml:"gauge"`
 }
@@ -13,6 +13,8 @@ var (
 	ErrMetricAlreadyExist = errors.New("trying to add a metric that already exists, instead try to increment it")
 	// ErrMetricNotFound is when trying to increment a nonfound metric
 	ErrMetricNotFound = errors.New("trying to increment a missing metric")
+	//ErrMetricNotGauge is when trying to set the value of a metric that only can be incremented
+	ErrMetricNotGauge = errors.New("only gauge metrics can be set")
 )
 
 // PrometheusProvider is a simple Provider for Prom metric
@@ -22,6 +24,10 @@ type PrometheusProvider struct {
 	// PromMetric is actually just a mirror of Metrics, its used to export the metric
 	// The reaason why we contain our own Metric aswell is because it seems hard to extract values from Prom package
 	PromMetrics map[string]prometheus.Counter `json:"-"`
+	// PromGauges is the mirror of Metrics that are Gauges
+	PromGauges map[string]prometheus.Gauge `json:"-"`
+	// Registerer is where the Prometheus counters are registered, nil means the prometheus DefaultRegisterer
+	Registerer prometheus.Registerer `json:"-"`
 	sync.Mutex
 }
 
@@ -30,9 +36,18 @@ func NewPrometheusProvider() *PrometheusProvider {
 	return &PrometheusProvider{
 		Metrics:     make(map[string]*Metric, 0),
 		PromMetrics: make(map[string]prometheus.Counter, 0),
+		PromGauges:  make(map[string]prometheus.Gauge, 0),
 	}
 }
 
+// NewPrometheusProviderWithRegisterer will generate a new metrics holder that registers its counters in reg
+// Use a prometheus.NewRegistry to keep metrics from colliding with other flows in the same binary
+func NewPrometheusProviderWithRegisterer(reg prometheus.Registerer) *PrometheusProvider {
+	pp := NewPrometheusProvider()
+	pp.Registerer = reg
+	return pp
+}
+
 // AddMetric is used to add new metrics, or append to old metric
 func (pp *PrometheusProvider) AddMetric(m *Metric) error {
 	if pp.Metrics == nil {
@@ -41,13 +56,30 @@ func (pp *PrometheusProvider) AddMetric(m *Metric) error {
 	if pp.PromMetrics == nil {
 		pp.PromMetrics = make(map[string]prometheus.Counter, 0)
 	}
+	if pp.PromGauges == nil {
+		pp.PromGauges = make(map[string]prometheus.Gauge, 0)
+	}
 
 	if _, ok := pp.Metrics[m.Name]; ok {
 		return ErrMetricAlreadyExist
 	}
 	pp.Lock()
 	pp.Metrics[m.Name] = m
-	promCounter := promauto.NewCounter(prometheus.CounterOpts{
+	reg := pp.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	if m.Gauge {
+		promGauge := promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: m.Name,
+			Help: m.Description,
+		})
+		promGauge.Set(m.Value)
+		pp.PromGauges[m.Name] = promGauge
+		pp.Unlock()
+		return nil
+	}
+	promCounter := promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: m.Name,
 		Help: m.Description,
 	})
@@ -57,15 +89,37 @@ func (pp *PrometheusProvider) AddMetric(m *Metric) error {
 	return nil
 }
 
-// IncrementMetric is used to increase value of metric
+// IncrementMetric is used to increase value of metric, Gauges can also be decreased with a negative value
 func (pp *PrometheusProvider) IncrementMetric(name string, value float64) error {
-	if pp.PromMetrics[name] == nil || pp.Metrics[name] == nil {
+	pp.Lock()
+	defer pp.Unlock()
+	if pp.Metrics[name] == nil {
+		return ErrMetricNotFound
+	}
+	if gauge, ok := pp.PromGauges[name]; ok {
+		gauge.Add(value)
+	} else if counter, ok := pp.PromMetrics[name]; ok {
+		counter.Add(value)
+	} else {
 		return ErrMetricNotFound
 	}
-	pp.Lock()
-	pp.PromMetrics[name].Add(value)
 	pp.Metrics[name].Value = pp.Metrics[name].Value + value
-	pp.Unlock()
+	return nil
+}
+
+// SetMetric is used to change the value of a Gauge
+func (pp *PrometheusProvider) SetMetric(name string, value float64) error {
+	pp.Lock()
+	defer pp.Unlock()
+	if pp.Metrics[name] == nil {
+		return ErrMetricNotFound
+	}
+	gauge, ok := pp.PromGauges[name]
+	if !ok {
+		return ErrMetricNotGauge
+	}
+	gauge.Set(value)
+	pp.Metrics[name].Value = value
 	return nil
 }
 
@@ -0,0 +1,47 @@
+package metric
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheusProviderGauge(t *testing.T) {
+	pp := NewPrometheusProviderWithRegisterer(prometheus.NewRegistry())
+	if err := pp.AddMetric(&Metric{Name: "test_counter", Description: "a counter"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.AddMetric(&Metric{Name: "test_gauge", Description: "a gauge", Gauge: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pp.IncrementMetric("test_gauge", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.IncrementMetric("test_gauge", -1); err != nil {
+		t.Fatal(err)
+	}
+	if pp.GetMetric("test_gauge").Value != 2 {
+		t.Fatal("a gauge should go both up and down: ", pp.GetMetric("test_gauge").Value)
+	}
+	if err := pp.SetMetric("test_gauge", 10); err != nil {
+		t.Fatal(err)
+	}
+	if pp.GetMetric("test_gauge").Value != 10 {
+		t.Fatal("the gauge was not set")
+	}
+
+	if err := pp.IncrementMetric("test_counter", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.SetMetric("test_counter", 10); !errors.Is(err, ErrMetricNotGauge) {
+		t.Fatal("expected ErrMetricNotGauge: ", err)
+	}
+	if err := pp.SetMetric("missing", 10); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatal("expected ErrMetricNotFound: ", err)
+	}
+	if err := pp.IncrementMetric("missing", 1); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatal("expected ErrMetricNotFound: ", err)
+	}
+}
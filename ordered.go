@@ -0,0 +1,223 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+var (
+	//ErrOrderedBatchHandler is when trying to run a BatchHandler in ordered mode with more than one worker
+	ErrOrderedBatchHandler = errors.New("ordered processing is not supported for BatchHandlers with more than one worker")
+
+	// ReorderWindow is how many payloads per worker that can be handled ahead of the oldest unfinished payload in ordered mode
+	ReorderWindow = 4
+)
+
+// orderedJob is a payload in ordered mode and the output the Handler emitted while handling it
+// The job is the Emitter given to the Handler, it holds on to the output until its the jobs turn to publish
+type orderedJob struct {
+	p       *Processor
+	payload payload.Payload
+	outputs []orderedOutput
+	done    chan struct{}
+}
+
+// orderedOutput is payloads emitted at once and the topics of their relationship
+type orderedOutput struct {
+	topics   []string
+	payloads []payload.Payload
+}
+
+// Emit holds on to payloads emitted on the primary relationship
+func (oj *orderedJob) Emit(ctx context.Context, payloads ...payload.Payload) {
+	oj.outputs = append(oj.outputs, orderedOutput{
+		topics:   oj.p.relationshipTopics(oj.p.primaryRelationship()),
+		payloads: payloads,
+	})
+}
+
+// EmitTo holds on to payloads emitted on a relationship
+func (oj *orderedJob) EmitTo(ctx context.Context, relationship string, payloads ...payload.Payload) error {
+	topics, err := oj.p.route(relationship)
+	if err != nil {
+		return err
+	}
+	oj.outputs = append(oj.outputs, orderedOutput{
+		topics:   topics,
+		payloads: payloads,
+	})
+	return nil
+}
+
+// reset throws away the output of an earlier attempt, so that only the output of the last attempt is published
+func (oj *orderedJob) reset() {
+	oj.outputs = nil
+}
+
+// consume reads payloads from a pipe and gives them to handle
+// It returns when the pipe is closed, the context is done, retire is read or the processor is draining and the pipe is empty
+// Nothing is read from the pipe while the processor is paused
+// retire is used by autoscaling to stop a worker, nil means the worker is never retired
+func (p *Processor) consume(ctx context.Context, jobs *pubsub.Pipe, retire <-chan struct{}, handle func(payload.Payload)) {
+	for {
+		flow, resumed := jobs.Flow, p.pauseGate()
+		if resumed != nil {
+			flow = nil
+		}
+		select {
+		case payload, ok := <-flow:
+			if !ok {
+				return
+			}
+			handle(payload)
+		case <-retire:
+			return
+		case <-resumed:
+		case <-p.drain:
+			if p.pauseGate() != nil {
+				// Paused processors leaves the queue as it is
+				return
+			}
+			for {
+				select {
+				case payload, ok := <-jobs.Flow:
+					if !ok {
+						return
+					}
+					handle(payload)
+				case <-ctx.Done():
+					return
+				default:
+					// Queue is empty
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runOrdered handles payloads from a pipe concurrently with all workers, but publishes the output in the same order as the payloads arrived
+// Output emitted by the Handler is held in a reorder buffer until all earlier payloads are done
+func (p *Processor) runOrdered(ctx context.Context, jobs *pubsub.Pipe) {
+	defer p.workers.Done()
+	queue := make(chan *orderedJob, p.Workers)
+	pending := make(chan *orderedJob, p.Workers*ReorderWindow)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer p.trackWorker()()
+			for job := range queue {
+				p.handlePayload(ctx, job, job.payload)
+				close(job.done)
+			}
+		}()
+	}
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		p.emitInOrder(ctx, pending)
+	}()
+	defer func() {
+		close(queue)
+		close(pending)
+		wg.Wait()
+		<-emitted
+	}()
+
+	p.consume(ctx, jobs, nil, func(pay payload.Payload) {
+		job := &orderedJob{
+			p:       p,
+			payload: pay,
+			done:    make(chan struct{}),
+		}
+		// pending is what limits how far ahead the workers can get
+		select {
+		case pending <- job:
+		case <-ctx.Done():
+			atomic.AddInt64(&p.unhandled, 1)
+			return
+		}
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			atomic.AddInt64(&p.unhandled, 1)
+		}
+	})
+}
+
+// emitInOrder waits for each job in the order they arrived and emits their output
+func (p *Processor) emitInOrder(ctx context.Context, pending chan *orderedJob) {
+	for job := range pending {
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+			return
+		}
+		for _, output := range job.outputs {
+			p.publish(ctx, output.topics, output.payloads)
+		}
+	}
+}
+
+// runPartitioned handles payloads from a pipe with all workers, payloads with the same PartitionKey is always handled by the same worker
+// This keeps the order for each key while different keys are handled in parallel
+func (p *Processor) runPartitioned(ctx context.Context, jobs *pubsub.Pipe) {
+	defer p.workers.Done()
+	queues := make([]chan payload.Payload, p.Workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan payload.Payload, p.QueueSize/p.Workers+1)
+		wg.Add(1)
+		go func(queue chan payload.Payload) {
+			defer wg.Done()
+			defer p.trackWorker()()
+			for pay := range queue {
+				if !p.waitResumed(ctx) {
+					// The processor stopped while paused, the rest of the queue is counted as dropped by StopGraceful
+					atomic.AddInt64(&p.unhandled, 1)
+					continue
+				}
+				p.handlePayload(ctx, p.emitter(), pay)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	p.consume(ctx, jobs, nil, func(pay payload.Payload) {
+		select {
+		case queues[p.partition(pay)] <- pay:
+		case <-ctx.Done():
+			atomic.AddInt64(&p.unhandled, 1)
+		}
+	})
+}
+
+// partition returns what worker a payload belongs to based on the value of the PartitionKey metadata property
+// Payloads without the property all goes to the same worker
+func (p *Processor) partition(pay payload.Payload) int {
+	var key string
+	if meta := pay.GetMetaData(); meta != nil {
+		if prop := meta.GetProperty(p.PartitionKey); prop != nil && prop.Value != nil {
+			key = prop.String()
+		}
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(p.Workers))
+}
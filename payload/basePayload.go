@@ -13,6 +13,10 @@ type BasePayload struct {
 	Metadata *property.Configuration `json:"metadata"`
 }
 
+func init() {
+	Register("BasePayload", func() Payload { return &BasePayload{} })
+}
+
 // NewBasePayload will spawn a basic default payload
 func NewBasePayload(payload []byte, source string, meta *property.Configuration) *BasePayload {
 	pay := &BasePayload{
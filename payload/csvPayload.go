@@ -19,6 +19,10 @@ type CsvPayload struct {
 	Metadata  *property.Configuration `json:"metadata"`
 }
 
+func init() {
+	Register("CsvPayload", func() Payload { return &CsvPayload{} })
+}
+
 // NewCsvPayload is used to Create a new Payload
 func NewCsvPayload(header, payload, delimiter string, meta *property.Configuration) *CsvPayload {
 	pay := &CsvPayload{
@@ -0,0 +1,107 @@
+package payload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// PayloadRegister is used to keep track of all Payload types that Engines can rebuild after serializing them
+// To have a custom Payload survive a Redis Engine it needs to be Registered with Register
+// It is created before any init runs, so Payloads can be Registered in init like Handlers are
+var PayloadRegister = make(map[string]func() Payload)
+
+var (
+	//ErrPayloadAlreadyRegistered is an error when trying to add a Payload type that already is Registered
+	ErrPayloadAlreadyRegistered = errors.New("a Payload with this name is already Registered")
+	//ErrPayloadNotRegistered is an error when trying to use a Payload type that is not Registered
+	ErrPayloadNotRegistered = errors.New("the Payload type is not Registered")
+)
+
+// payloadNames is the name of each Registered Payload type
+var payloadNames = make(map[reflect.Type]string)
+
+// registerMu protects the PayloadRegister since Engines reads it while Payloads can still be Registered
+var registerMu sync.RWMutex
+
+// Register is used to register a Payload type, f should return a new empty Payload that can be unmarshalled into
+// If a Payload with that name already exists it will return an ErrPayloadAlreadyRegistered
+func Register(name string, f func() Payload) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	if _, ok := PayloadRegister[name]; ok {
+		return ErrPayloadAlreadyRegistered
+	}
+	PayloadRegister[name] = f
+	payloadNames[reflect.TypeOf(f())] = name
+	return nil
+}
+
+// NewPayload returns a new empty Payload of a Registered type
+func NewPayload(name string) (Payload, error) {
+	registerMu.RLock()
+	f, ok := PayloadRegister[name]
+	registerMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrPayloadNotRegistered)
+	}
+	return f(), nil
+}
+
+// TypeName returns the name that the type of the Payload is Registered with
+func TypeName(p Payload) (string, error) {
+	registerMu.RLock()
+	name, ok := payloadNames[reflect.TypeOf(p)]
+	registerMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%T: %w", p, ErrPayloadNotRegistered)
+	}
+	return name, nil
+}
+
+// Envelope is how Engines serialize a Payload, it carries the name of the Payload type so that the same type can be rebuilt
+type Envelope struct {
+	// Type is the name the Payload type is Registered with
+	Type string `json:"type"`
+	// Data is the Payload from MarshalBinary
+	Data []byte `json:"data"`
+}
+
+// Marshal puts the Payload in an Envelope and returns it as JSON, the type of the Payload has to be Registered
+func Marshal(p Payload) ([]byte, error) {
+	name, err := TypeName(p)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Type: name, Data: data})
+}
+
+// Unmarshal rebuilds a Payload from data created by Marshal
+// Data without an Envelope is decoded as a BasePayload, so payloads from older publishers can still be read
+func Unmarshal(data []byte) (Payload, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Type == "" {
+		bp := &BasePayload{}
+		if err := bp.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return bp, nil
+	}
+	p, err := NewPayload(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.UnmarshalBinary(envelope.Data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,113 @@
+package payload
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// registerTestPayload is a custom Payload used to make sure Payloads outside the package can be Registered
+type registerTestPayload struct {
+	BasePayload
+	Count int `json:"count"`
+}
+
+func (rt *registerTestPayload) MarshalBinary() ([]byte, error) {
+	return json.Marshal(rt)
+}
+
+func (rt *registerTestPayload) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, rt)
+}
+
+func init() {
+	Register("registerTestPayload", func() Payload { return &registerTestPayload{} })
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register("registerTestPayload", func() Payload { return &registerTestPayload{} }); !errors.Is(err, ErrPayloadAlreadyRegistered) {
+		t.Fatal("Should not be able to Register the same name twice")
+	}
+
+	name, err := TypeName(&registerTestPayload{})
+	if err != nil {
+		t.Fatal(err)
+	} else if name != "registerTestPayload" {
+		t.Fatalf("Wrong type name: %s", name)
+	}
+
+	pay, err := NewPayload("registerTestPayload")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := pay.(*registerTestPayload); !ok {
+		t.Fatalf("Wrong Payload type: %T", pay)
+	}
+	if _, err := NewPayload("notRegistered"); !errors.Is(err, ErrPayloadNotRegistered) {
+		t.Fatal("Should fail to create a Payload that is not Registered")
+	}
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	type testCase struct {
+		Name    string
+		Payload Payload
+		Check   func(p Payload) bool
+	}
+
+	testCases := []testCase{
+		{Name: "BasePayload", Payload: &BasePayload{Payload: []byte("hello"), Source: "test"}, Check: func(p Payload) bool {
+			bp, ok := p.(*BasePayload)
+			return ok && string(bp.Payload) == "hello" && bp.Source == "test"
+		}},
+		{Name: "CsvPayload", Payload: NewCsvPayload("id,name", "1,percy", ",", nil), Check: func(p Payload) bool {
+			csv, ok := p.(*CsvPayload)
+			return ok && csv.Header == "id,name" && csv.Payload == "1,percy" && csv.Delimiter == ","
+		}},
+		{Name: "Custom", Payload: &registerTestPayload{Count: 3}, Check: func(p Payload) bool {
+			rt, ok := p.(*registerTestPayload)
+			return ok && rt.Count == 3
+		}},
+	}
+
+	for _, tc := range testCases {
+		data, err := Marshal(tc.Payload)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		pay, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !tc.Check(pay) {
+			t.Fatalf("%s: Payload was not rebuilt correctly: %#v", tc.Name, pay)
+		}
+	}
+}
+
+func TestMarshalNotRegistered(t *testing.T) {
+	if _, err := Marshal(&NetworkPayload{}); !errors.Is(err, ErrPayloadNotRegistered) {
+		t.Fatal("Should not be able to Marshal a Payload that is not Registered")
+	}
+	if _, err := Unmarshal([]byte(`{"type":"notRegistered","data":"e30="}`)); !errors.Is(err, ErrPayloadNotRegistered) {
+		t.Fatal("Should not be able to Unmarshal a Payload that is not Registered")
+	}
+}
+
+func TestUnmarshalLegacy(t *testing.T) {
+	// Payloads published before the Envelope was added are plain BasePayloads
+	data, err := (&BasePayload{Payload: []byte("old"), Source: "legacy"}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pay, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp, ok := pay.(*BasePayload)
+	if !ok || string(bp.Payload) != "old" || bp.Source != "legacy" {
+		t.Fatalf("Legacy Payload was not rebuilt: %#v", pay)
+	}
+	if _, err := Unmarshal([]byte("not json")); err == nil {
+		t.Fatal("Should fail on bad data")
+	}
+}
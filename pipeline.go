@@ -0,0 +1,666 @@
+package go4data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/percybolmer/go4data/pubsub"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	//ErrDuplicateID is when two processors in a pipeline has the same ID
+	ErrDuplicateID = errors.New("the processor ID is used by more than one processor")
+	//ErrCycle is when the topics of the processors forms a loop
+	ErrCycle = errors.New("the processors publish and subscribe in a cycle")
+	//ErrDanglingSubscription is when a processor subscribes to a topic that no processor in the pipeline publishes to
+	ErrDanglingSubscription = errors.New("no processor publishes to the subscribed topic")
+	//ErrTopicWithoutConsumers is when a processor publishes to a topic that no processor in the pipeline subscribes to
+	ErrTopicWithoutConsumers = errors.New("no processor subscribes to the topic")
+	//ErrNoSuchProcessor is when no processor with the ID exists in the Pipeline
+	ErrNoSuchProcessor = errors.New("no processor with that ID exists in the pipeline")
+
+	// ReloadDrainTimeout is how long Watch lets changed processors drain before they are replaced
+	ReloadDrainTimeout = 30 * time.Second
+)
+
+// TopologyError is a problem found when validating the topic graph of a Pipeline
+type TopologyError struct {
+	// Err is one of ErrDuplicateID, ErrCycle, ErrDanglingSubscription or ErrTopicWithoutConsumers
+	Err error
+	// Processor is the name of the processor that has the problem
+	Processor string
+	// ID is the ID of the processor that has the problem
+	ID uint
+	// Topic is the topic related to the problem, empty for ErrDuplicateID
+	Topic string
+}
+
+// Error is used to be part of error interface
+func (te *TopologyError) Error() string {
+	if te.Topic == "" {
+		return fmt.Sprintf("%s (%d): %s", te.Processor, te.ID, te.Err)
+	}
+	return fmt.Sprintf("%s (%d): %s: %s", te.Processor, te.ID, te.Err, te.Topic)
+}
+
+// Unwrap makes it possible to use errors.Is on TopologyErrors
+func (te *TopologyError) Unwrap() error {
+	return te.Err
+}
+
+// Pipeline owns a set of processors and knows how they are connected through their Topics and Subscriptions
+// It is used to start processors downstream-first, so that no payloads has to be buffered, and stop them upstream-first
+type Pipeline struct {
+	// Processors is all the processors in the pipeline, in the order they were added
+	Processors []*Processor
+	// Warnings is problems in the topology that does not stop the pipeline from running,
+	// such as dangling subscriptions and topics without consumers
+	Warnings []error
+	// order is the processors sorted from source to sink
+	order []*Processor
+	// definitions is the loader definition each processor was created from, used to find changes when reloading
+	definitions map[*Processor]*LoaderProccessor
+	// env is the Environment processors added by Reload are created in
+	env *Environment
+	// running is true after Start and false after Stop, processors added by Reload are only started if running
+	running bool
+	// reload makes sure only one Reload is applied at a time
+	reload sync.Mutex
+	sync.Mutex
+}
+
+// node is a processor in the topic graph, the processor might not be subscribed yet so topics are kept separate
+type node struct {
+	proc          *Processor
+	topics        []string
+	subscriptions []string
+}
+
+// NewPipeline will create a pipeline from processors and validate the topic graph
+// Duplicate IDs and cycles are returned as an error, other problems are stored in Warnings
+// The pipeline uses the Environment of the first processor
+func NewPipeline(procs ...*Processor) (*Pipeline, error) {
+	pl := &Pipeline{
+		Processors:  procs,
+		definitions: make(map[*Processor]*LoaderProccessor),
+		env:         defaultEnvironment,
+	}
+	if len(procs) != 0 {
+		pl.env = procs[0].Environment()
+	}
+	for _, proc := range procs {
+		pl.definitions[proc] = proc.ConvertToLoader()
+	}
+	warnings, order, err := validateTopology(nodesOf(procs))
+	if err != nil {
+		return nil, err
+	}
+	pl.Warnings = warnings
+	pl.order = order
+	return pl, nil
+}
+
+// LoadPipeline will load processors from a go4data yaml file into a Pipeline
+// Unlike Load no processors are started, use Pipeline.Start instead
+func LoadPipeline(path string) (*Pipeline, error) {
+	return defaultEnvironment.LoadPipeline(path)
+}
+
+// LoadPipeline will load processors from a go4data yaml file into a Pipeline in the Environment
+func (env *Environment) LoadPipeline(path string) (*Pipeline, error) {
+	loaders, err := LoadLoaders(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateIDs(loaders); err != nil {
+		return nil, err
+	}
+
+	var procs []*Processor
+	for _, la := range loaders {
+		proc, err := la.build(env)
+		if err != nil {
+			release(procs)
+			return nil, err
+		}
+		if err := proc.Subscribe(la.Subscriptions...); err != nil {
+			release(append(procs, proc))
+			return nil, err
+		}
+		procs = append(procs, proc)
+	}
+	pl, err := NewPipeline(procs...)
+	if err != nil {
+		release(procs)
+		return nil, err
+	}
+	pl.env = env
+	// Remember the file definitions, IDs are regenerated when converting so they are needed to match processors on reload
+	for i, proc := range procs {
+		pl.definitions[proc] = loaders[i]
+	}
+	return pl, nil
+}
+
+// checkDuplicateIDs makes sure no loaders share ID, IDs are regenerated when converting so duplicates has to be found in the file
+func checkDuplicateIDs(loaders []*LoaderProccessor) error {
+	seen := make(map[uint]string)
+	for _, la := range loaders {
+		if other, ok := seen[la.ID]; ok && la.ID != 0 {
+			return &TopologyError{Err: ErrDuplicateID, Processor: fmt.Sprintf("%s and %s", other, la.Name), ID: la.ID}
+		}
+		seen[la.ID] = la.Name
+	}
+	return nil
+}
+
+// Validate will go through the topic graph again, use it after changing Topics or Subscriptions
+func (pl *Pipeline) Validate() ([]error, error) {
+	pl.Lock()
+	defer pl.Unlock()
+	warnings, order, err := validateTopology(nodesOf(pl.Processors))
+	if err != nil {
+		return warnings, err
+	}
+	pl.Warnings = warnings
+	pl.order = order
+	return warnings, nil
+}
+
+// StartOrder returns the processors in the order they are started, sinks first and sources last
+func (pl *Pipeline) StartOrder() []*Processor {
+	pl.Lock()
+	defer pl.Unlock()
+	order := make([]*Processor, len(pl.order))
+	for i, proc := range pl.order {
+		order[len(pl.order)-1-i] = proc
+	}
+	return order
+}
+
+// StopOrder returns the processors in the order they are stopped, sources first and sinks last
+func (pl *Pipeline) StopOrder() []*Processor {
+	pl.Lock()
+	defer pl.Unlock()
+	order := make([]*Processor, len(pl.order))
+	copy(order, pl.order)
+	return order
+}
+
+// Start will start all processors downstream-first
+// If a processor fails to start the already started processors are stopped again
+func (pl *Pipeline) Start(ctx context.Context) error {
+	var started []*Processor
+	for _, proc := range pl.StartOrder() {
+		if err := proc.Start(ctx); err != nil {
+			for _, s := range started {
+				s.Stop()
+			}
+			return fmt.Errorf("%s: %w", proc.Name, err)
+		}
+		started = append(started, proc)
+	}
+	pl.Lock()
+	pl.running = true
+	pl.Unlock()
+	return nil
+}
+
+// Stop will gracefully stop all processors upstream-first, so that downstream processors can handle
+// what the upstream processors drained. ctx limits how long the whole pipeline is allowed to drain.
+// The returned int is the total amount of payloads that were left unhandled
+func (pl *Pipeline) Stop(ctx context.Context) (int, error) {
+	pl.Lock()
+	pl.running = false
+	pl.Unlock()
+	var dropped int
+	var firstErr error
+	for _, proc := range pl.StopOrder() {
+		d, err := proc.StopGraceful(ctx)
+		dropped += d
+		if err != nil && !errors.Is(err, ErrProcessorAlreadyStopped) && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", proc.Name, err)
+		}
+	}
+	return dropped, firstErr
+}
+
+// GetProcessor returns the processor with the given ID or nil
+func (pl *Pipeline) GetProcessor(id uint) *Processor {
+	pl.Lock()
+	defer pl.Unlock()
+	for _, proc := range pl.Processors {
+		if proc.ID == id {
+			return proc
+		}
+	}
+	return nil
+}
+
+// GetProcessorByName returns the first processor with the given name or nil
+func (pl *Pipeline) GetProcessorByName(name string) *Processor {
+	pl.Lock()
+	defer pl.Unlock()
+	for _, proc := range pl.Processors {
+		if proc.Name == name {
+			return proc
+		}
+	}
+	return nil
+}
+
+// ConvertToLoaders returns the current configuration of all processors in the pipeline, it can be saved as a go4data yaml file
+func (pl *Pipeline) ConvertToLoaders() []*LoaderProccessor {
+	pl.Lock()
+	defer pl.Unlock()
+	loaders := make([]*LoaderProccessor, 0, len(pl.Processors))
+	for _, proc := range pl.Processors {
+		loaders = append(loaders, proc.ConvertToLoader())
+	}
+	return loaders
+}
+
+// Pause will pause the processor with the given ID
+func (pl *Pipeline) Pause(id uint) error {
+	proc := pl.GetProcessor(id)
+	if proc == nil {
+		return ErrNoSuchProcessor
+	}
+	return proc.Pause()
+}
+
+// Resume will resume the paused processor with the given ID
+func (pl *Pipeline) Resume(id uint) error {
+	proc := pl.GetProcessor(id)
+	if proc == nil {
+		return ErrNoSuchProcessor
+	}
+	return proc.Resume()
+}
+
+// Reload will compare loaders against the definitions the processors were created from
+// Processors that are new are added, processors that are missing are removed, and processors whose
+// handler, configuration, topics or subscriptions has changed are replaced. Unchanged processors keeps running untouched.
+// Every new processor is built and validated, and the new topology checked, before anything is changed.
+// The old processors are then unsubscribed so that no payload is handled by both, the new processors are subscribed and started,
+// and the old processors handles what is left in their queues before they are stopped.
+// If anything is wrong the new processors are removed again, an error is returned and the old configuration keeps running.
+// ctx limits how long removed and changed processors are allowed to drain.
+func (pl *Pipeline) Reload(ctx context.Context, loaders []*LoaderProccessor) error {
+	pl.reload.Lock()
+	defer pl.reload.Unlock()
+
+	if err := checkDuplicateIDs(loaders); err != nil {
+		return err
+	}
+	pl.Lock()
+	current := make(map[string]*Processor)
+	for proc, la := range pl.definitions {
+		current[definitionKey(la)] = proc
+	}
+	running := pl.running
+	pl.Unlock()
+
+	var (
+		keep    []*Processor
+		added   []*Processor
+		removed []*Processor
+		nodes   []node
+		wanted  = make(map[string]bool)
+		defs    = make(map[*Processor]*LoaderProccessor)
+		paused  = make(map[*Processor]bool)
+	)
+	for _, loader := range loaders {
+		// Keep a copy so that changes to the loaders after the reload does not change the stored definition
+		def := *loader
+		la := &def
+		key := definitionKey(la)
+		wanted[key] = true
+		if old, ok := current[key]; ok {
+			same, err := sameDefinition(pl.definitions[old], la)
+			if err != nil {
+				return err
+			}
+			if same {
+				keep = append(keep, old)
+				if la.Paused != pl.definitions[old].Paused {
+					paused[old] = la.Paused
+				}
+				defs[old] = la
+				nodes = append(nodes, node{proc: old, topics: old.OutputTopics(), subscriptions: old.SubscribedTopics()})
+				continue
+			}
+			removed = append(removed, old)
+		}
+		proc, err := la.build(pl.env)
+		if err != nil {
+			return fmt.Errorf("%s: %w", la.Name, err)
+		}
+		added = append(added, proc)
+		defs[proc] = la
+		nodes = append(nodes, node{proc: proc, topics: proc.OutputTopics(), subscriptions: la.Subscriptions})
+	}
+	for key, proc := range current {
+		if !wanted[key] {
+			removed = append(removed, proc)
+		}
+	}
+
+	warnings, order, err := validateTopology(nodes)
+	if err != nil {
+		return err
+	}
+
+	for _, proc := range added {
+		if err := proc.validate(); err != nil {
+			return fmt.Errorf("%s: %w", proc.Name, err)
+		}
+	}
+
+	// Everything is valid, unsubscribe the old processors upstream-first so that they only handle what is already queued
+	removedSet := make(map[*Processor]bool)
+	for _, proc := range removed {
+		removedSet[proc] = true
+	}
+	var detached []*Processor
+	if running {
+		for _, proc := range pl.StopOrder() {
+			if removedSet[proc] && proc.IsRunning() {
+				proc.detach()
+				detached = append(detached, proc)
+			}
+		}
+	}
+
+	// Subscribe and start the new processors, if any of them fails the old ones are subscribed again
+	for i, proc := range added {
+		if err := proc.Subscribe(defs[proc].Subscriptions...); err != nil {
+			release(added[:i+1])
+			restore(ctx, detached)
+			return fmt.Errorf("%s: %w", proc.Name, err)
+		}
+	}
+	if running {
+		addedSet := make(map[*Processor]bool)
+		for _, proc := range added {
+			addedSet[proc] = true
+		}
+		// order is sources first, start the new processors downstream-first
+		for i := len(order) - 1; i >= 0; i-- {
+			proc := order[i]
+			if !addedSet[proc] {
+				continue
+			}
+			if err := proc.Start(ctx); err != nil {
+				release(added)
+				restore(ctx, detached)
+				return fmt.Errorf("%s: %w", proc.Name, err)
+			}
+		}
+	}
+
+	// The new processors are running, let the old processors empty their queues and stop them upstream-first
+	var stopErr error
+	for _, proc := range pl.StopOrder() {
+		if !removedSet[proc] {
+			continue
+		}
+		if _, err := proc.StopGraceful(ctx); err != nil && !errors.Is(err, ErrProcessorAlreadyStopped) && !errors.Is(err, context.DeadlineExceeded) && stopErr == nil {
+			stopErr = fmt.Errorf("%s: %w", proc.Name, err)
+		}
+		if err := proc.Unsubscribe(proc.SubscribedTopics()...); err != nil && stopErr == nil {
+			stopErr = fmt.Errorf("%s: %w", proc.Name, err)
+		}
+	}
+
+	// Processors that are kept can still have been paused or resumed in the file
+	for proc, pause := range paused {
+		if pause {
+			proc.Pause()
+		} else {
+			proc.Resume()
+		}
+	}
+
+	procs := append(keep, added...)
+	pl.Lock()
+	pl.Processors = procs
+	pl.Warnings = warnings
+	pl.order = order
+	pl.definitions = defs
+	pl.Unlock()
+	return stopErr
+}
+
+// release stops the processors if they are running and removes their subscriptions
+// It is used to undo processors that was only partly added
+func release(procs []*Processor) {
+	for _, proc := range procs {
+		if proc.IsRunning() {
+			proc.Stop()
+		}
+		proc.Unsubscribe(proc.SubscribedTopics()...)
+	}
+}
+
+// restore subscribes processors that was detached by a failed reload again
+// They are stopped gracefully first so that what was left in their queues is handled, and then started again
+func restore(ctx context.Context, procs []*Processor) {
+	for _, proc := range procs {
+		proc.StopGraceful(ctx)
+		proc.Start(ctx)
+	}
+}
+
+// Watch will check the file at path every interval and Reload the pipeline when it has been modified
+// Errors from loading or reloading are sent on the returned channel, the old configuration keeps running when that happens
+// Watching stops when ctx is done
+func (pl *Pipeline) Watch(ctx context.Context, path string, interval time.Duration) (chan error, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	errChan := make(chan error, 100)
+	lastMod := info.ModTime()
+	lastSize := info.Size()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil {
+					sendError(errChan, err)
+					continue
+				}
+				if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+					continue
+				}
+				lastMod = info.ModTime()
+				lastSize = info.Size()
+
+				loaders, err := LoadLoaders(path)
+				if err != nil {
+					sendError(errChan, err)
+					continue
+				}
+				reloadCtx, cancel := context.WithTimeout(ctx, ReloadDrainTimeout)
+				err = pl.Reload(reloadCtx, loaders)
+				cancel()
+				if err != nil {
+					sendError(errChan, err)
+				}
+			}
+		}
+	}()
+	return errChan, nil
+}
+
+// sendError will send an error without blocking if nobody reads the channel
+func sendError(errChan chan error, err error) {
+	select {
+	case errChan <- err:
+	default:
+	}
+}
+
+// definitionKey is what is used to match a loader against a running processor, the ID if set otherwise the name
+func definitionKey(la *LoaderProccessor) string {
+	if la.ID != 0 {
+		return fmt.Sprintf("id:%d", la.ID)
+	}
+	return "name:" + la.Name
+}
+
+// sameDefinition compares two loaders, the Running and Paused state is ignored
+func sameDefinition(a, b *LoaderProccessor) (bool, error) {
+	ac, bc := *a, *b
+	ac.Running, bc.Running = false, false
+	ac.Paused, bc.Paused = false, false
+	adata, err := yaml.Marshal(ac)
+	if err != nil {
+		return false, err
+	}
+	bdata, err := yaml.Marshal(bc)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(adata, bdata), nil
+}
+
+// nodesOf turns processors into nodes in the topic graph
+func nodesOf(procs []*Processor) []node {
+	nodes := make([]node, len(procs))
+	for i, proc := range procs {
+		nodes[i] = node{proc: proc, topics: proc.OutputTopics(), subscriptions: proc.SubscribedTopics()}
+	}
+	return nodes
+}
+
+// validateTopology builds the graph of processors connected by topics
+// It returns warnings, the processors sorted from source to sink, and an error if the graph cannot be used
+func validateTopology(nodes []node) ([]error, []*Processor, error) {
+	var warnings []error
+
+	ids := make(map[uint]*Processor)
+	publishers := make(map[string][]*Processor)
+	subscribers := make(map[string][]*Processor)
+	for _, n := range nodes {
+		if other, ok := ids[n.proc.ID]; ok {
+			return nil, nil, &TopologyError{Err: ErrDuplicateID, Processor: fmt.Sprintf("%s and %s", other.Name, n.proc.Name), ID: n.proc.ID}
+		}
+		ids[n.proc.ID] = n.proc
+		for _, topic := range n.topics {
+			publishers[topic] = append(publishers[topic], n.proc)
+		}
+	}
+	published := make([]string, 0, len(publishers))
+	for topic := range publishers {
+		published = append(published, topic)
+	}
+	sort.Strings(published)
+	for _, n := range nodes {
+		for _, subscription := range n.subscriptions {
+			for _, topic := range matchSubscription(subscription, published) {
+				subscribers[topic] = append(subscribers[topic], n.proc)
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		for _, topic := range n.subscriptions {
+			if len(matchSubscription(topic, published)) == 0 {
+				warnings = append(warnings, &TopologyError{Err: ErrDanglingSubscription, Processor: n.proc.Name, ID: n.proc.ID, Topic: topic})
+			}
+		}
+		for _, topic := range n.topics {
+			if len(subscribers[topic]) == 0 {
+				warnings = append(warnings, &TopologyError{Err: ErrTopicWithoutConsumers, Processor: n.proc.Name, ID: n.proc.ID, Topic: topic})
+			}
+		}
+	}
+
+	// Kahns algorithm, processors without any upstream goes first
+	indegree := make(map[uint]int)
+	downstream := make(map[uint][]*Processor)
+	for _, n := range nodes {
+		indegree[n.proc.ID] += 0
+		seen := make(map[uint]bool)
+		for _, topic := range n.topics {
+			for _, sub := range subscribers[topic] {
+				if seen[sub.ID] {
+					continue
+				}
+				seen[sub.ID] = true
+				downstream[n.proc.ID] = append(downstream[n.proc.ID], sub)
+				indegree[sub.ID]++
+			}
+		}
+	}
+
+	var queue []*Processor
+	for _, n := range nodes {
+		if indegree[n.proc.ID] == 0 {
+			queue = append(queue, n.proc)
+		}
+	}
+	order := make([]*Processor, 0, len(nodes))
+	for len(queue) != 0 {
+		proc := queue[0]
+		queue = queue[1:]
+		order = append(order, proc)
+		for _, sub := range downstream[proc.ID] {
+			indegree[sub.ID]--
+			if indegree[sub.ID] == 0 {
+				queue = append(queue, sub)
+			}
+		}
+	}
+
+	if len(order) != len(nodes) {
+		// Any processor left with upstreams is part of, or behind, a cycle
+		var left []node
+		for _, n := range nodes {
+			if indegree[n.proc.ID] > 0 {
+				left = append(left, n)
+			}
+		}
+		sort.Slice(left, func(i, j int) bool { return left[i].proc.ID < left[j].proc.ID })
+		cyclic := left[0]
+		topic := ""
+		for _, t := range cyclic.subscriptions {
+			for _, matched := range matchSubscription(t, published) {
+				for _, pub := range publishers[matched] {
+					if indegree[pub.ID] > 0 {
+						topic = t
+					}
+				}
+			}
+		}
+		return warnings, nil, &TopologyError{Err: ErrCycle, Processor: cyclic.proc.Name, ID: cyclic.proc.ID, Topic: topic}
+	}
+	return warnings, order, nil
+}
+
+// matchSubscription returns the published topics that a subscription receives payloads from
+// A pattern subscription can match many topics, a regular subscription only itself if its published
+func matchSubscription(subscription string, published []string) []string {
+	var matched []string
+	for _, topic := range published {
+		if topic == subscription || (pubsub.IsPattern(subscription) && pubsub.MatchTopic(subscription, topic)) {
+			matched = append(matched, topic)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,436 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data/handlers"
+	"github.com/percybolmer/go4data/handlers/terminal"
+	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/property"
+	"github.com/percybolmer/go4data/pubsub"
+)
+
+func newPipelineProc(t *testing.T, name string, subscriptions []string, topics ...string) *Processor {
+	p := NewProcessor(name, topics...)
+	p.SetHandler(terminal.NewStdoutHandler())
+	p.GetConfiguration().SetProperty("forward", false)
+	if err := p.Subscribe(subscriptions...); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNewPipeline(t *testing.T) {
+	sink := newPipelineProc(t, "sink", []string{"pl_middle"})
+	source := newPipelineProc(t, "source", nil, "pl_source")
+	middle := newPipelineProc(t, "middle", []string{"pl_source"}, "pl_middle", "pl_nowhere")
+	dangling := newPipelineProc(t, "dangling", []string{"pl_nobody_publishes"})
+
+	pl, err := NewPipeline(sink, source, middle, dangling)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	position := make(map[string]int)
+	for i, proc := range pl.StartOrder() {
+		position[proc.Name] = i
+	}
+	if !(position["sink"] < position["middle"] && position["middle"] < position["source"]) {
+		t.Fatal("processors should start downstream first: ", position)
+	}
+	position = make(map[string]int)
+	for i, proc := range pl.StopOrder() {
+		position[proc.Name] = i
+	}
+	if !(position["source"] < position["middle"] && position["middle"] < position["sink"]) {
+		t.Fatal("processors should stop upstream first: ", position)
+	}
+
+	var foundDangling, foundNoConsumer bool
+	for _, w := range pl.Warnings {
+		var te *TopologyError
+		if !errors.As(w, &te) {
+			t.Fatal("warnings should be topology errors")
+		}
+		if errors.Is(w, ErrDanglingSubscription) && te.Topic == "pl_nobody_publishes" {
+			foundDangling = true
+		}
+		if errors.Is(w, ErrTopicWithoutConsumers) && te.Topic == "pl_nowhere" {
+			foundNoConsumer = true
+		}
+	}
+	if !foundDangling || !foundNoConsumer {
+		t.Fatal("missing warnings: ", pl.Warnings)
+	}
+
+	if err := pl.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, proc := range pl.Processors {
+		if !proc.Running {
+			t.Fatal("all processors should be running")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := pl.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pl.GetProcessor(middle.ID) != middle || pl.GetProcessor(0) != nil {
+		t.Fatal("wrong processor returned")
+	}
+	if pl.GetProcessorByName(middle.Name) != middle || pl.GetProcessorByName("nobody") != nil {
+		t.Fatal("wrong processor returned by name")
+	}
+	loaders := pl.ConvertToLoaders()
+	if len(loaders) != len(pl.Processors) || loaders[0].Name != pl.Processors[0].Name {
+		t.Fatal("wrong loaders: ", loaders)
+	}
+}
+
+func TestPipelinePatterns(t *testing.T) {
+	archive := newPipelineProc(t, "archive", []string{"pl.raw.*"})
+	source := newPipelineProc(t, "source", nil, "pl.raw.sales", "pl.raw.hr")
+	unmatched := newPipelineProc(t, "unmatched", []string{"pl.parsed.*"})
+
+	pl, err := NewPipeline(archive, source, unmatched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := pl.StartOrder()
+	position := make(map[string]int)
+	for i, proc := range order {
+		position[proc.Name] = i
+	}
+	if position["archive"] > position["source"] {
+		t.Fatal("the pattern subscriber should start before the publisher: ", position)
+	}
+	if len(pl.Warnings) != 1 {
+		t.Fatal("only the unmatched pattern should be warned about: ", pl.Warnings)
+	}
+	var te *TopologyError
+	if !errors.As(pl.Warnings[0], &te) || !errors.Is(te, ErrDanglingSubscription) || te.Topic != "pl.parsed.*" {
+		t.Fatal("wrong warning: ", pl.Warnings[0])
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	first := newPipelineProc(t, "first", []string{"pl_cycle_b"}, "pl_cycle_a")
+	second := newPipelineProc(t, "second", []string{"pl_cycle_a"}, "pl_cycle_b")
+	if _, err := NewPipeline(first, second); !errors.Is(err, ErrCycle) {
+		t.Fatal("should detect the cycle: ", err)
+	}
+
+	dupe := newPipelineProc(t, "dupe", nil)
+	dupe.SetID(first.ID)
+	if _, err := NewPipeline(first, dupe); !errors.Is(err, ErrDuplicateID) {
+		t.Fatal("should detect the duplicate id: ", err)
+	}
+}
+
+func TestLoadPipeline(t *testing.T) {
+	pl, err := LoadPipeline("testing/loader/pipeline.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Warnings) != 0 {
+		t.Fatal("the pipeline should not have warnings: ", pl.Warnings)
+	}
+	order := pl.StartOrder()
+	if order[0].Name != "stdout" || order[2].Name != "listdir" {
+		t.Fatal("wrong start order")
+	}
+	if err := pl.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := pl.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicate IDs in the file should be caught
+	loaders := []*LoaderProccessor{pl.Processors[0].ConvertToLoader(), pl.Processors[1].ConvertToLoader()}
+	loaders[1].ID = loaders[0].ID
+	if err := Save("testing/loader/pipelinedupe.yml", loaders); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/pipelinedupe.yml")
+	if _, err := LoadPipeline("testing/loader/pipelinedupe.yml"); !errors.Is(err, ErrDuplicateID) {
+		t.Fatal("should detect duplicate ids in the file: ", err)
+	}
+
+	// Processors that was loaded before a broken one should not stay subscribed
+	loaders = []*LoaderProccessor{pl.Processors[2].ConvertToLoader(), pl.Processors[2].ConvertToLoader()}
+	loaders[0].Subscriptions = []string{"pipeline_broken_in"}
+	loaders[1].ID++
+	loaders[1].Handler.Name = "NoSuchHandler"
+	if err := Save("testing/loader/pipelinebroken.yml", loaders); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/pipelinebroken.yml")
+	if _, err := LoadPipeline("testing/loader/pipelinebroken.yml"); err == nil {
+		t.Fatal("should fail to load a broken handler")
+	}
+	engine, err := pubsub.EngineAsDefaultEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, ok := engine.Topics.Load("pipeline_broken_in")
+	if !ok {
+		t.Fatal("the topic should have been created by the first processor")
+	}
+	top := topic.(*pubsub.Topic)
+	top.Lock()
+	defer top.Unlock()
+	if len(top.Subscribers) != 0 {
+		t.Fatal("the loaded processors should have been unsubscribed: ", len(top.Subscribers))
+	}
+}
+
+func TestPipelineReload(t *testing.T) {
+	loaders, err := LoadLoaders("testing/loader/pipeline.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Use unique topics since the loaded processors stays subscribed
+	for _, la := range loaders {
+		for i := range la.Topics {
+			la.Topics[i] = "reload_" + la.Topics[i]
+		}
+		for i := range la.Subscriptions {
+			la.Subscriptions[i] = "reload_" + la.Subscriptions[i]
+		}
+	}
+	if err := Save("testing/loader/reload.yml", loaders); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/reload.yml")
+
+	pl, err := LoadPipeline("testing/loader/reload.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Stop(context.Background())
+	listdir, readfile, stdout := pl.Processors[0], pl.Processors[1], pl.Processors[2]
+
+	// A broken handler should keep the old configuration
+	broken, _ := LoadLoaders("testing/loader/reload.yml")
+	broken[2].Handler.Name = "NoSuchHandler"
+	if err := pl.Reload(context.Background(), broken); err == nil {
+		t.Fatal("reload with a broken handler should fail")
+	}
+	// So should a cycle
+	cycle, _ := LoadLoaders("testing/loader/reload.yml")
+	cycle[0].Subscriptions = []string{"reload_pipeline_file_data"}
+	if err := pl.Reload(context.Background(), cycle); !errors.Is(err, ErrCycle) {
+		t.Fatal("reload with a cycle should fail: ", err)
+	}
+	// And a processor that can not be started, it should be removed again
+	unstartable, _ := LoadLoaders("testing/loader/reload.yml")
+	unstartable[2].Ordered = true
+	unstartable[2].MaxWorkers = 2
+	if err := pl.Reload(context.Background(), unstartable); !errors.Is(err, ErrAutoscaleNotSupported) {
+		t.Fatal("reload with a processor that can not start should fail: ", err)
+	}
+	engine, err := pubsub.EngineAsDefaultEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, _ := engine.Topics.Load(unstartable[2].Subscriptions[0])
+	top := topic.(*pubsub.Topic)
+	top.Lock()
+	subscribers := len(top.Subscribers)
+	top.Unlock()
+	if subscribers != 1 {
+		t.Fatal("only the old processor should be subscribed after a failed reload: ", subscribers)
+	}
+	if len(pl.Processors) != 3 || pl.Processors[2] != stdout || !stdout.Running {
+		t.Fatal("failed reload should not change the running processors")
+	}
+
+	// Change stdout and add a new processor
+	changed, _ := LoadLoaders("testing/loader/reload.yml")
+	changed[2].Handler.Cfg.Properties[0].Value = true
+	changed[2].Topics = []string{"reload_printed"}
+	extra := *changed[2]
+	extra.ID = 4
+	extra.Name = "extra"
+	extra.Topics = nil
+	extra.Subscriptions = []string{"reload_printed"}
+	changed = append(changed, &extra)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pl.Reload(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Processors) != 4 {
+		t.Fatal("wrong amount of processors after reload: ", len(pl.Processors))
+	}
+	if pl.GetProcessor(listdir.ID) != listdir || pl.GetProcessor(readfile.ID) != readfile {
+		t.Fatal("unchanged processors should not be replaced")
+	}
+	if pl.GetProcessor(stdout.ID) != nil || stdout.Running {
+		t.Fatal("the changed processor should have been stopped and removed")
+	}
+	for _, proc := range pl.Processors {
+		if !proc.Running {
+			t.Fatal("all processors should be running after reload: ", proc.Name)
+		}
+	}
+	if len(pl.Warnings) != 0 {
+		t.Fatal("reloaded pipeline should not have warnings: ", pl.Warnings)
+	}
+
+	// Removing the extra processor again
+	if err := pl.Reload(ctx, changed[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Processors) != 3 {
+		t.Fatal("the extra processor should have been removed")
+	}
+
+	// Pausing in the file should pause the running processor without replacing it
+	changed[1].Paused = true
+	if err := pl.Reload(ctx, changed[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if pl.GetProcessor(readfile.ID) != readfile || !readfile.IsPaused() {
+		t.Fatal("readfile should have been paused without being replaced")
+	}
+	if err := pl.Resume(readfile.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Pause(999); !errors.Is(err, ErrNoSuchProcessor) {
+		t.Fatal("should not find a processor that does not exist: ", err)
+	}
+}
+
+func TestPipelineReloadHandlesOnce(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+	var handled int32
+	env.Registry.Register("ReloadCounter", handlers.Func("ReloadCounter", func(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+		time.Sleep(3 * time.Millisecond)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}))
+	loaders := []*LoaderProccessor{{
+		ID:            1,
+		Name:          "counter",
+		Subscriptions: []string{"reload_once_topic"},
+		QueueSize:     500,
+		Handler:       LoaderHandler{Name: "ReloadCounter", Cfg: &property.Configuration{}},
+	}}
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reload.yml")
+	if err := Save(path, loaders); err != nil {
+		t.Fatal(err)
+	}
+	pl, err := env.LoadPipeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Stop(context.Background())
+
+	// Replace the processor while the payloads are being published, each of them should be handled once
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < 400; i++ {
+			env.Publish("reload_once_topic", payload.NewBasePayload([]byte(`once`), "test", nil))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	loaders[0].Workers = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pl.Reload(ctx, loaders); err != nil {
+		t.Fatal(err)
+	}
+	<-published
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&handled) < 400 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give duplicates a chance to show up
+	time.Sleep(100 * time.Millisecond)
+	if count := atomic.LoadInt32(&handled); count != 400 {
+		t.Fatal("each payload should be handled once during a reload: ", count)
+	}
+}
+
+func TestPipelineWatch(t *testing.T) {
+	loaders, err := LoadLoaders("testing/loader/pipeline.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, la := range loaders {
+		for i := range la.Topics {
+			la.Topics[i] = "watch_" + la.Topics[i]
+		}
+		for i := range la.Subscriptions {
+			la.Subscriptions[i] = "watch_" + la.Subscriptions[i]
+		}
+	}
+	if err := Save("testing/loader/watch.yml", loaders); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testing/loader/watch.yml")
+
+	pl, err := LoadPipeline("testing/loader/watch.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := pl.Watch(ctx, "nosuchfile", time.Millisecond); err == nil {
+		t.Fatal("should not be able to watch a missing file")
+	}
+	errs, err := pl.Watch(ctx, "testing/loader/watch.yml", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaders[2].Name = "renamed_stdout"
+	if err := Save("testing/loader/watch.yml", loaders); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		default:
+		}
+		pl.Lock()
+		name := pl.Processors[len(pl.Processors)-1].Name
+		pl.Unlock()
+		if name == "renamed_stdout" {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("the pipeline was not reloaded")
+}
@@ -6,12 +6,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/metric"
+	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
 	"github.com/percybolmer/go4data/pubsub"
+	"github.com/percybolmer/go4data/ratelimit"
+	"github.com/percybolmer/go4data/schedule"
 
 	// Add shadow import to all known Handler categories?
 	_ "github.com/percybolmer/go4data/handlers/databases"
@@ -32,23 +38,86 @@ type Processor struct {
 	Name string `json:"name" yaml:"name"`
 	// Running is a boolean indicator if the processor is currently Running
 	Running bool `json:"running" yaml:"running"`
+	// Paused is true when the processor is paused, it stays subscribed but does not handle any payloads
+	Paused bool `json:"paused" yaml:"paused"`
 	// Workers is a int that determines how many Concurrent workers the processor should run
-	Workers int `json:"workers yaml:"workers"`
+	Workers int `json:"workers" yaml:"workers"`
+	// MinWorkers is the least amount of workers per subscription when autoscaling, defaults to 1
+	MinWorkers int `json:"min_workers" yaml:"min_workers"`
+	// MaxWorkers turns on autoscaling when set, the workers per subscription are then scaled between MinWorkers and MaxWorkers depending on how full the queue is
+	MaxWorkers int `json:"max_workers" yaml:"max_workers"`
 	// FailureHandler is the failurehandler to use with the Processor
 	FailureHandler func(f Failure) `json:"-" yaml:"-"`
+	// Group is the consumer group used when subscribing, processors in the same group share the payloads of a topic instead of each getting a copy
+	// Empty means that every payload on the subscribed topics is received
+	Group string `json:"group" yaml:"group"`
 	// Handler is the handler to Perform on the Payload  received
 	Handler handlers.Handler `json:"handler" yaml:"handler"`
 	// Subscriptions is a slice of all the current Subscriptions
 	// A Subscription will input data into the Processor
 	subscriptions []*pubsub.Pipe
-	// Topics is the Topics to publish payload onto
+	// Topics is the Topics to publish payload onto, they are used by the primary relationship of the Handler
 	Topics []string `json:"topics" yaml:"topics"`
+	// Relationships maps relationships that the Handler emits on to the topics they are published on
+	Relationships map[string][]string `json:"relationships" yaml:"relationships"`
+	// Unrouted decides what happens to payloads emitted on a relationship without topics, UnroutedDrop or UnroutedError
+	Unrouted string `json:"unrouted" yaml:"unrouted"`
 	// QueueSize is a integer of how many payloads are accepted on the Output channels to Subscribers
 	QueueSize int `json:"queuesize" yaml:"queuesize"`
 	// Metric is used to store metrics
 	Metric metric.Provider `json:"-" yaml:"-"`
+	// ExecutionInterval is how long to wait between executions of Subscriptionless Handlers
+	ExecutionInterval time.Duration `json:"executioninterval" yaml:"executioninterval"`
+	// Cron is a cron expression used to schedule Subscriptionless Handlers instead of ExecutionInterval
+	Cron string `json:"cron" yaml:"cron"`
+	// RunWindow limits executions of Subscriptionless Handlers to a certain time of the day
+	RunWindow *schedule.Window `json:"runwindow" yaml:"runwindow"`
+	// Retry is the policy used to retry payloads that fails, nil means that failed payloads goes straight to the FailureHandler
+	Retry *RetryPolicy `json:"retry" yaml:"retry"`
+	// HandleTimeout is the longest time a Handler may spend on one call, 0 means no limit
+	// The ctx given to the Handler gets a deadline and calls that fail after it are given to the FailureHandler
+	// The call is not interrupted, so it only works for Handlers that returns when their ctx is done
+	HandleTimeout time.Duration `json:"handle_timeout" yaml:"handle_timeout"`
+	// RateLimit is how many payloads per second the processor handles, 0 means no limit
+	RateLimit float64 `json:"rate_limit" yaml:"rate_limit"`
+	// Burst is how many payloads that can be handled at once before the RateLimit kicks in, 0 uses the RateLimit rounded up
+	Burst int `json:"burst" yaml:"burst"`
+	// Batch decides how payloads are collected into batches when the Handler is a BatchHandler, nil uses the defaults
+	Batch *BatchConfig `json:"batch" yaml:"batch"`
+	// Ordered makes a processor with many Workers publish its output in the same order as the payloads arrived
+	Ordered bool `json:"ordered" yaml:"ordered"`
+	// PartitionKey is a metadata property used in Ordered mode, the order is then only kept between payloads with the same value
+	PartitionKey string `json:"partitionkey" yaml:"partitionkey"`
+	// limiter is the token bucket built from RateLimit and Burst when the processor is started
+	limiter *ratelimit.Limiter
+	// resumed is closed when a paused processor is resumed
+	resumed chan struct{}
+	// env is the Environment the processor subscribes and publishes in, nil means the process-wide defaults
+	env *Environment
+	// failureHandler is the Registered FailureHandler used, nil if FailureHandler was set manually
+	failureHandler *LoaderFailureHandler
 	//cancel is used by the processor the handle cancellation
-	cancel     context.CancelFunc
+	cancel context.CancelFunc
+	// schedule is the parsed schedule used by Subscriptionless Handlers
+	schedule *schedule.Schedule
+	// drain is closed when the processor should stop taking new payloads and empty its queues
+	drain chan struct{}
+	// detached is true when Stop has removed the subscriptions from the Engine, Start subscribes them again
+	detached bool
+	// retired is the pipes that detach removed, the workers keeps reading them until they are empty when stopping gracefully
+	retired []*pubsub.Pipe
+	// workers keeps track of all running goroutines that executes the Handler
+	workers sync.WaitGroup
+	// inflight is how many payloads are currently being handled
+	inflight int64
+	// unhandled is how many payloads the workers has taken from the queues and then left because the processor stopped
+	unhandled int64
+	// running is how many workers are currently running
+	running int64
+	// hooks are the funcs added with OnStart, OnStop, OnFailure and the others, by EventType
+	hooks map[EventType][]func(e Event)
+	// hooksMu protects hooks so they can be added while the processor is running
+	hooksMu    sync.RWMutex
 	sync.Mutex `json:"-" yaml:"-"`
 }
 
@@ -57,6 +126,8 @@ var (
 	IDCounter uint = 1
 	// DefaultQueueSize is a limit set to define how many payloads can be sent in queue
 	DefaultQueueSize = 1000
+	// DefaultExecutionInterval is the interval used by Subscriptionless Handlers when no ExecutionInterval or Cron is set
+	DefaultExecutionInterval = 1 * time.Second
 
 	//ErrProcessorHasNoHandlerApplied is when starting a processor that has a nil Handler
 	ErrProcessorHasNoHandlerApplied = errors.New("the processor has no Handler set. Please assign a Handler to it before running")
@@ -64,6 +135,10 @@ var (
 	ErrNilContext = errors.New("nil context is not allowed when starting a processor")
 	//ErrProcessorAlreadyStopped is when trying to stop a processor that is alrady stopped
 	ErrProcessorAlreadyStopped = errors.New("the processor is already stopped")
+	//ErrProcessorAlreadyPaused is when trying to pause a processor that is already paused
+	ErrProcessorAlreadyPaused = errors.New("the processor is already paused")
+	//ErrProcessorNotPaused is when trying to resume a processor that is not paused
+	ErrProcessorNotPaused = errors.New("the processor is not paused")
 	//ErrRequiredPropertiesNotFulfilled is when trying to start a Handler but it needs additional properties
 	ErrRequiredPropertiesNotFulfilled = errors.New("the Handler needs additional properties to work, see the Handlers documentation")
 	//ErrHandlerDoesNotAcceptPublishers is when trying to register an publisher to a processor that has a selfpublishing Handler
@@ -72,6 +147,8 @@ var (
 	ErrDuplicateTopic = errors.New("the topic is already registered")
 	// ErrFailedToUnmarshal is thrown when trying to unmarshal go4datas but it fails
 	ErrFailedToUnmarshal = errors.New("failed to unmarshal since data provided is not correct")
+	//ErrProcessorRunning is when trying to change something that can only be changed while the processor is stopped
+	ErrProcessorRunning = errors.New("the processor has to be stopped first")
 )
 
 // NewID is used to generate a new ID
@@ -85,28 +162,21 @@ func NewID() uint {
 // Topics is a vararg that allows you to insert any topic you want the processor
 // to publish its payloads to
 func NewProcessor(name string, topics ...string) *Processor {
-	proc := &Processor{
-		ID:             NewID(),
-		Name:           name,
-		FailureHandler: PrintFailure,
-		Handler:        nil,
-		Workers:        1,
-		subscriptions:  make([]*pubsub.Pipe, 0),
-		Topics:         make([]string, 0),
-		QueueSize:      DefaultQueueSize,
-		Metric:         metric.NewPrometheusProvider(),
-	}
-	if len(topics) != 0 {
-		proc.Topics = append(proc.Topics, topics...)
-	}
+	return defaultEnvironment.NewProcessor(name, topics...)
+}
 
-	return proc
+// Environment returns the Environment that the processor belongs to
+func (p *Processor) Environment() *Environment {
+	if p.env == nil {
+		return defaultEnvironment
+	}
+	return p.env
 }
 
 // Start will run a Processor and execute the given Handler on any incomming payloads
 func (p *Processor) Start(ctx context.Context) error {
 	// IsRunning? Skip
-	if p.Running {
+	if p.IsRunning() {
 		return nil
 	}
 	// Validate Settings of Handler
@@ -116,32 +186,119 @@ func (p *Processor) Start(ctx context.Context) error {
 	if ctx == nil {
 		return ErrNilContext
 	}
-
-	if ok, _ := p.Handler.ValidateConfiguration(); !ok {
-		return ErrRequiredPropertiesNotFulfilled
+	if err := p.validate(); err != nil {
+		p.emitEvent(Event{Type: EventValidationFailed, Err: err})
+		return err
 	}
+	ordered := p.Ordered && p.Workers > 1 && !p.Handler.Subscriptionless()
 
-	c, cancel := context.WithCancel(ctx)
-	p.cancel = cancel
-
+	if err := p.addMetrics(); err != nil {
+		return err
+	}
 	err := p.Handler.SetMetricProvider(p.Metric, fmt.Sprintf("%s_%d", p.Name, p.ID))
 	if err != nil {
 		return err
 	}
 	if p.Handler.Subscriptionless() {
-		go p.HandleSubscriptionless(c)
+		sched, err := p.buildSchedule()
+		if err != nil {
+			return err
+		}
+		p.schedule = sched
+	}
+	// Subscribe last, so that a processor that fails to start is not left in the Engine
+	if err := p.attach(); err != nil {
+		return err
+	}
+
+	c, cancel := context.WithCancel(p.Environment().Context(ctx))
+	p.cancel = cancel
+	p.drain = make(chan struct{})
+	atomic.StoreInt64(&p.unhandled, 0)
+
+	if p.Handler.Subscriptionless() {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			defer p.trackWorker()()
+			p.HandleSubscriptionless(c)
+		}()
+	} else if ordered {
+		for _, sub := range p.subscriptions {
+			p.workers.Add(1)
+			if p.PartitionKey != "" {
+				go p.runPartitioned(c, sub)
+			} else {
+				go p.runOrdered(c, sub)
+			}
+		}
+	} else if p.autoscaling() {
+		for _, sub := range p.subscriptions {
+			p.workers.Add(1)
+			go p.runAutoscaled(c, sub)
+		}
+	} else if batcher, ok := p.Handler.(handlers.BatchHandler); ok {
+		for _, sub := range p.subscriptions {
+			for w := 1; w <= p.Workers; w++ {
+				p.workers.Add(1)
+				go p.runBatch(c, sub, batcher)
+			}
+		}
 	} else {
 		for _, sub := range p.subscriptions {
-			go p.handleSubscription(c, sub)
+			for w := 1; w <= p.Workers; w++ {
+				p.workers.Add(1)
+				go p.runHandle(c, sub)
+			}
 		}
 	}
 	// Start listening on Handler errorChannel and transform errors into Failures and apply Failurehandler on em
 	go p.MonitorErrChannel(c)
-	p.Running = true
+	p.setRunning(true)
+	p.emitEvent(Event{Type: EventStart})
 
 	return nil
 }
 
+// validate makes sure the Handler and the settings of the processor can be used before starting it
+func (p *Processor) validate() error {
+	if ok, _ := p.Handler.ValidateConfiguration(); !ok {
+		return ErrRequiredPropertiesNotFulfilled
+	}
+	if err := p.validateRelationships(); err != nil {
+		return err
+	}
+	if p.Retry != nil {
+		if err := p.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Batch != nil {
+		if err := p.Batch.Validate(); err != nil {
+			return err
+		}
+	}
+
+	limiter, err := ratelimit.New(p.RateLimit, p.Burst)
+	if err != nil {
+		return err
+	}
+	p.limiter = limiter
+
+	_, batching := p.Handler.(handlers.BatchHandler)
+	ordered := p.Ordered && p.Workers > 1 && !p.Handler.Subscriptionless()
+	if ordered && batching {
+		return ErrOrderedBatchHandler
+	}
+	if err := p.validateWorkerLimits(); err != nil {
+		return err
+	}
+	if p.autoscaling() && !p.Handler.Subscriptionless() && (p.Ordered || batching) {
+		return ErrAutoscaleNotSupported
+	}
+	return nil
+}
+
 // MonitorErrChannel is used to monitor errorchannel of a handler if its not nil
 func (p *Processor) MonitorErrChannel(ctx context.Context) {
 	p.Lock()
@@ -155,7 +312,7 @@ func (p *Processor) MonitorErrChannel(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case err := <-errChan:
-			p.FailureHandler(Failure{
+			p.fail(Failure{
 				Err:       err,
 				Payload:   nil,
 				Processor: p.ID,
@@ -165,17 +322,212 @@ func (p *Processor) MonitorErrChannel(ctx context.Context) {
 }
 
 // Stop will cancel the goroutines running
+// It waits for ongoing Handle calls to return, so that the processor can be started again right away
 func (p *Processor) Stop() error {
-	if !p.Running {
+	if !p.IsRunning() {
 		return ErrProcessorAlreadyStopped
 	} else if p.cancel == nil {
 		return ErrProcessorAlreadyStopped
 	}
 	p.cancel()
-	p.Running = false
+	p.workers.Wait()
+	p.detach()
+	p.setRunning(false)
+	p.emitEvent(Event{Type: EventStop})
+	return nil
+}
+
+// StopGraceful will make the processor stop taking new payloads and let the workers empty the queued payloads
+// before stopping. Payloads that are being handled are allowed to finish.
+// If ctx is done before the queues are drained the processor is stopped right away, and ctx.Err() is returned.
+// The returned int is how many payloads were left unhandled in the queues
+func (p *Processor) StopGraceful(ctx context.Context) (int, error) {
+	if !p.IsRunning() || p.cancel == nil {
+		return 0, ErrProcessorAlreadyStopped
+	}
+	if ctx == nil {
+		return 0, ErrNilContext
+	}
+	// Unsubscribe first, payloads that keeps arriving would otherwise stop the queues from ever being empty
+	p.detach()
+	if !p.startDrain() {
+		return 0, ErrProcessorAlreadyStopped
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Deadline reached, cancel the workers and wait for the ongoing Handle calls to return
+		err = ctx.Err()
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+
+	dropped := int(atomic.LoadInt64(&p.unhandled))
+	p.Lock()
+	for _, pipe := range p.retired {
+		dropped += len(pipe.Flow)
+	}
+	p.Unlock()
+	p.setRunning(false)
+	p.emitEvent(Event{Type: EventStop})
+	return dropped, err
+}
+
+// detach removes the subscriptions from the Engine so that a stopped processor does not fill up queues that nobody reads
+// The topics are kept, with empty pipes, so that Start can subscribe to them again
+func (p *Processor) detach() {
+	p.Lock()
+	defer p.Unlock()
+	if p.detached {
+		return
+	}
+	p.retired = nil
+	for i, sub := range p.subscriptions {
+		// The processor is stopped either way, a subscription that is already gone is not a problem
+		p.Environment().unsubscribe(sub.Topic, p.ID)
+		p.retired = append(p.retired, sub)
+		placeholder := pubsub.NewPipe(sub.Topic, p.ID, 0)
+		placeholder.Group = sub.Group
+		p.subscriptions[i] = placeholder
+	}
+	p.detached = true
+}
+
+// startDrain closes drain so that the workers empties their queues and returns
+// It returns false if the processor is already draining
+func (p *Processor) startDrain() bool {
+	p.Lock()
+	defer p.Unlock()
+	select {
+	case <-p.drain:
+		return false
+	default:
+	}
+	close(p.drain)
+	return true
+}
+
+// attach subscribes a stopped processor to its topics again
+func (p *Processor) attach() error {
+	p.Lock()
+	defer p.Unlock()
+	if !p.detached {
+		return nil
+	}
+	for i, sub := range p.subscriptions {
+		pipe, err := p.Environment().subscribe(sub.Topic, sub.Group, p.ID, p.QueueSize)
+		if err != nil {
+			// Remove the subscriptions that was made so the processor stays detached
+			for j := 0; j < i; j++ {
+				p.Environment().unsubscribe(p.subscriptions[j].Topic, p.ID)
+				placeholder := pubsub.NewPipe(p.subscriptions[j].Topic, p.ID, 0)
+				placeholder.Group = p.subscriptions[j].Group
+				p.subscriptions[j] = placeholder
+			}
+			return err
+		}
+		p.subscriptions[i] = pipe
+	}
+	p.detached = false
+	p.retired = nil
 	return nil
 }
 
+// Pause makes the processor stop handling payloads while staying subscribed
+// Payloads keeps queueing up to QueueSize, and payloads that are already being handled are allowed to finish
+// Only the in-memory queue buffers payloads while paused, nothing is spilled to the topic buffer. When it is full the DefaultEngine
+// drops new payloads with ErrProcessorQueueIsFull, or blocks the publishers when it uses DeliveryBlock
+// A processor can be paused before it is started, it will then start in a paused state
+func (p *Processor) Pause() error {
+	p.Lock()
+	defer p.Unlock()
+	if p.Paused {
+		return ErrProcessorAlreadyPaused
+	}
+	p.Paused = true
+	p.resumed = make(chan struct{})
+	return nil
+}
+
+// Resume makes a paused processor start handling the queued payloads again
+func (p *Processor) Resume() error {
+	p.Lock()
+	defer p.Unlock()
+	if !p.Paused {
+		return ErrProcessorNotPaused
+	}
+	p.Paused = false
+	close(p.resumed)
+	return nil
+}
+
+// IsPaused returns true if the processor is paused
+func (p *Processor) IsPaused() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.Paused
+}
+
+// IsRunning returns true if the processor is started
+func (p *Processor) IsRunning() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.Running
+}
+
+// setRunning changes Running while holding the lock, so that IsRunning can be used while the processor is started or stopped
+func (p *Processor) setRunning(running bool) {
+	p.Lock()
+	p.Running = running
+	p.Unlock()
+}
+
+// pauseGate returns nil if the processor is not paused, or a channel that is closed when the processor is resumed
+func (p *Processor) pauseGate() chan struct{} {
+	p.Lock()
+	defer p.Unlock()
+	if !p.Paused {
+		return nil
+	}
+	return p.resumed
+}
+
+// waitResumed blocks while the processor is paused
+// It returns false if the context is done or the processor is drained before it is resumed
+func (p *Processor) waitResumed(ctx context.Context) bool {
+	resumed := p.pauseGate()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-p.drain:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// InFlight returns how many payloads that are currently being handled by the processor
+func (p *Processor) InFlight() int64 {
+	return atomic.LoadInt64(&p.inflight)
+}
+
+// RunningWorkers returns how many workers the processor currently runs
+func (p *Processor) RunningWorkers() int64 {
+	return atomic.LoadInt64(&p.running)
+}
+
 // GetConfiguration is just an reacher for Handlers getcfg
 func (p *Processor) GetConfiguration() *property.Configuration {
 	return p.Handler.GetConfiguration()
@@ -199,55 +551,332 @@ func (p *Processor) SetHandler(a handlers.Handler) {
 	p.Unlock()
 }
 
-// HandleSubscriptionless is used to handle Handlers that has no requirement of subscriptions
-func (p *Processor) HandleSubscriptionless(ctx context.Context) {
-	err := p.Handler.Handle(ctx, nil, p.Topics...)
+// SetProperties will change properties in the configuration of the Handler and validate it
+// The processor has to be stopped, and if the new configuration is not valid the old values are put back
+func (p *Processor) SetProperties(values map[string]interface{}) error {
+	if p.IsRunning() {
+		return ErrProcessorRunning
+	}
+	if p.Handler == nil {
+		return ErrProcessorHasNoHandlerApplied
+	}
+	cfg := p.Handler.GetConfiguration()
+	old := make(map[string]interface{}, len(values))
+	for name := range values {
+		prop := cfg.GetProperty(name)
+		if prop == nil {
+			return fmt.Errorf("%s: %w", name, property.ErrNoSuchProperty)
+		}
+		old[name] = prop.Value
+	}
+	for name, value := range values {
+		cfg.SetProperty(name, value)
+	}
+	if ok, errs := p.Handler.ValidateConfiguration(); !ok {
+		for name, value := range old {
+			cfg.SetProperty(name, value)
+		}
+		p.Handler.ValidateConfiguration()
+		return fmt.Errorf("%w: %s", ErrRequiredPropertiesNotFulfilled, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// SetFailureHandler will change the FailureHandler into a Registered FailureHandler
+// The name and configuration is remembered so that it can be Saved by the Loader
+func (p *Processor) SetFailureHandler(name string, cfg *property.Configuration) error {
+	fh, err := p.Environment().GetFailureHandler(name, cfg)
 	if err != nil {
-		p.FailureHandler(Failure{
-			Err:       err,
-			Payload:   nil,
-			Processor: p.ID,
-		})
+		return err
 	}
+	p.Lock()
+	p.FailureHandler = fh
+	p.failureHandler = &LoaderFailureHandler{Name: name, Cfg: cfg}
+	p.Unlock()
+	return nil
 }
 
-// handleSubscription is used to run the
-// assigned Handler on incomming payloads
-func (p *Processor) handleSubscription(ctx context.Context, sub *pubsub.Pipe) {
-	for w := 1; w <= p.Workers; w++ {
-		go p.runHandle(ctx, sub)
+// buildSchedule will parse the ExecutionInterval, Cron and RunWindow into a Schedule
+// If neither ExecutionInterval or Cron is set the DefaultExecutionInterval is used
+func (p *Processor) buildSchedule() (*schedule.Schedule, error) {
+	interval := p.ExecutionInterval
+	if interval == 0 && p.Cron == "" {
+		interval = DefaultExecutionInterval
+	}
+	return schedule.New(interval, p.Cron, p.RunWindow)
+}
+
+// HandleSubscriptionless is used to handle Handlers that has no requirement of subscriptions
+// The Handler will be executed according to the processors schedule until the context is cancelled
+func (p *Processor) HandleSubscriptionless(ctx context.Context) {
+	sched := p.schedule
+	if sched == nil {
+		s, err := p.buildSchedule()
+		if err != nil {
+			p.fail(Failure{
+				Err:       err,
+				Payload:   nil,
+				Processor: p.ID,
+			})
+			return
+		}
+		sched = s
 	}
-	// Lock so we can close on ctx
+
+	next := sched.First(time.Now())
 	for {
+		if next.IsZero() {
+			// The schedule will never run again
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
+		case <-p.drain:
+			timer.Stop()
+			return
+		case <-timer.C:
 		}
+
+		// Paused processors skips the execution
+		if p.pauseGate() == nil && p.throttle(ctx, 1) {
+			err := p.guard(ctx, func(ctx context.Context) error {
+				return p.Handler.Handle(ctx, p.emitter(), nil)
+			})
+			if err != nil {
+				p.fail(Failure{
+					Err:       err,
+					Payload:   nil,
+					Processor: p.ID,
+					Stack:     stackOf(err),
+				})
+			}
+		}
+		next = sched.Next(time.Now())
 	}
 }
 
-// runHandle is used to execute the processors set handler on a payload, will be started concurrently by handleSubscription
+// runHandle is used to execute the processors set handler on payloads from a pipe, will be started concurrently for each Worker
+// When the processor is draining it will keep handling payloads until the pipe is empty
 func (p *Processor) runHandle(ctx context.Context, jobs *pubsub.Pipe) {
+	defer p.workers.Done()
+	defer p.trackWorker()()
+	p.consume(ctx, jobs, nil, func(pay payload.Payload) {
+		p.handlePayload(ctx, p.emitter(), pay)
+	})
+}
+
+// runBatch is used instead of runHandle when the Handler is a BatchHandler
+// Payloads are collected until the batch is full or the Linger time has passed since the first payload
+func (p *Processor) runBatch(ctx context.Context, jobs *pubsub.Pipe, batcher handlers.BatchHandler) {
+	defer p.workers.Done()
+	defer p.trackWorker()()
+	size, maxBytes, linger := p.Batch.size(), p.Batch.bytes(), p.Batch.linger()
+
+	batch := make([]payload.Payload, 0, size)
+	batchBytes := 0
+	var timer *time.Timer
+	var lingerC <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, lingerC = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		p.handleBatch(ctx, batcher, batch)
+		batch = make([]payload.Payload, 0, size)
+		batchBytes = 0
+	}
+	add := func(pay payload.Payload) {
+		if len(batch) == 0 {
+			timer = time.NewTimer(linger)
+			lingerC = timer.C
+		}
+		batch = append(batch, pay)
+		batchBytes += int(pay.GetPayloadLength())
+		if len(batch) >= size || (maxBytes != 0 && batchBytes >= maxBytes) {
+			flush()
+		}
+	}
+
 	for {
+		// While paused nothing is read from the pipe and the batch is kept until the processor is resumed
+		flow, linger, resumed := jobs.Flow, lingerC, p.pauseGate()
+		if resumed != nil {
+			flow, linger = nil, nil
+		}
 		select {
-		case payload := <-jobs.Flow:
-			err := p.Handler.Handle(ctx, payload, p.Topics...)
-			if err != nil {
-				p.Metric.IncrementMetric(fmt.Sprintf("%s_%d_failures", p.Name, p.ID), 1)
-				p.FailureHandler(Failure{
+		case payload, ok := <-flow:
+			if !ok {
+				flush()
+				return
+			}
+			add(payload)
+		case <-linger:
+			flush()
+		case <-resumed:
+		case <-p.drain:
+			if p.pauseGate() != nil {
+				// Paused processors leaves the queue as it is
+				return
+			}
+			for {
+				select {
+				case payload, ok := <-jobs.Flow:
+					if !ok {
+						flush()
+						return
+					}
+					add(payload)
+				case <-ctx.Done():
+					return
+				default:
+					// Queue is empty
+					flush()
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleBatch will run the BatchHandler on a batch and apply the FailureHandler on each payload if it fails
+func (p *Processor) handleBatch(ctx context.Context, batcher handlers.BatchHandler, batch []payload.Payload) {
+	if !p.throttle(ctx, len(batch)) {
+		return
+	}
+	atomic.AddInt64(&p.inflight, int64(len(batch)))
+	defer atomic.AddInt64(&p.inflight, -int64(len(batch)))
+
+	p.handleWithRetry(ctx, batch, func(ctx context.Context) error {
+		return batcher.HandleBatch(ctx, p.emitter(), batch)
+	})
+}
+
+// handlePayload will run the Handler on a single payload and apply the FailureHandler if it fails
+func (p *Processor) handlePayload(ctx context.Context, emitter handlers.Emitter, pay payload.Payload) {
+	if !p.throttle(ctx, 1) {
+		return
+	}
+	atomic.AddInt64(&p.inflight, 1)
+	defer atomic.AddInt64(&p.inflight, -1)
+
+	p.handleWithRetry(ctx, []payload.Payload{pay}, func(ctx context.Context) error {
+		if job, ok := emitter.(*orderedJob); ok {
+			job.reset()
+		}
+		return p.Handler.Handle(ctx, emitter, pay)
+	})
+}
+
+// throttle waits until the rate limit allows n more payloads to be handled, the time spent waiting is added to the throttled_seconds metric
+// It returns false if the context is done before that
+func (p *Processor) throttle(ctx context.Context, n int) bool {
+	waited, err := p.limiter.Wait(ctx, n)
+	if waited > 0 {
+		p.Metric.IncrementMetric(p.metricName("throttled_seconds"), waited.Seconds())
+	}
+	return err == nil
+}
+
+// handleWithRetry runs handle, guarded against panics and timeouts, and retries it according to the Retry policy
+// If it still fails each payload is given to the FailureHandler
+func (p *Processor) handleWithRetry(ctx context.Context, payloads []payload.Payload, handle func(ctx context.Context) error) {
+	attempt := 1
+	for {
+		handleCtx := ctx
+		if p.Retry != nil {
+			handleCtx = withAttempt(ctx, attempt)
+		}
+		started := time.Now()
+		err := p.guard(handleCtx, handle)
+		if err == nil {
+			if p.observed(EventPayloadProcessed) {
+				took := time.Since(started)
+				for _, payload := range payloads {
+					p.emitEvent(Event{Type: EventPayloadProcessed, Payload: payload, Duration: took})
+				}
+			}
+			p.acknowledge(payloads)
+			return
+		}
+		if p.Retry != nil && attempt < p.Retry.MaxAttempts && p.Retry.IsRetryable(err) {
+			p.Metric.IncrementMetric(p.metricName("retries"), 1)
+			if p.Retry.wait(ctx, attempt) {
+				attempt++
+				continue
+			}
+		}
+		// Engines that can deliver the payloads again are asked first, only the payloads they give up on are failures
+		failed := payloads
+		if !isPermanent(err) {
+			failed = p.nack(payloads)
+		}
+		if len(failed) == 0 {
+			return
+		}
+		p.Metric.IncrementMetric(p.metricName("failures"), float64(len(failed)))
+		routed := replaceFailed(err, failed)
+		if !p.routeFailure(ctx, routed) {
+			for _, payload := range routed {
+				p.fail(Failure{
 					Err:       err,
 					Payload:   payload,
 					Processor: p.ID,
+					Attempts:  attempt,
+					Stack:     stackOf(err),
 				})
 			}
-		case <-ctx.Done():
-			return
 		}
+		// The failures has been taken care of, so they should not be delivered again
+		p.acknowledge(failed)
+		return
 	}
 }
 
+// replaceFailed returns the payload of a handlers.FailedError instead of the failed payload, if the Handler returned one
+func replaceFailed(err error, failed []payload.Payload) []payload.Payload {
+	var fe *handlers.FailedError
+	if len(failed) != 1 || !errors.As(err, &fe) || fe.Payload == nil {
+		return failed
+	}
+	return []payload.Payload{fe.Payload}
+}
+
+// acknowledge tells Engines that implements pubsub.Acknowledger that the payloads are done with
+func (p *Processor) acknowledge(payloads []payload.Payload) {
+	if err := p.Environment().ack(payloads); err != nil {
+		p.fail(Failure{
+			Err:       err,
+			Payload:   payloads[0],
+			Processor: p.ID,
+		})
+	}
+}
+
+// nack tells Engines that implements pubsub.Acknowledger that the payloads failed, and returns the ones that will not be delivered again
+func (p *Processor) nack(payloads []payload.Payload) []payload.Payload {
+	failed, err := p.Environment().nack(payloads)
+	if err != nil {
+		p.fail(Failure{
+			Err:       err,
+			Payload:   payloads[0],
+			Processor: p.ID,
+		})
+	}
+	return failed
+}
+
 // Subscribe will subscribe to a certain topic and make the Processor
-// Ingest its payloads into it
+// Ingest its payloads into it. Topics with wildcards such as csv.raw.* are subscribed to as patterns, see pubsub.IsPattern
+// If Group is set the processor subscribes as a member of that consumer group
 func (p *Processor) Subscribe(topics ...string) error {
 	for _, sub := range p.subscriptions {
 		for _, topic := range topics {
@@ -257,9 +886,18 @@ func (p *Processor) Subscribe(topics ...string) error {
 		}
 	}
 	for _, topic := range topics {
-		pipe, err := pubsub.Subscribe(topic, p.ID, p.QueueSize)
-		if err != nil {
-			return err
+		p.Lock()
+		detached, group := p.detached, p.Group
+		p.Unlock()
+		// Stopped processors subscribes to the Engine when they are started again
+		pipe := pubsub.NewPipe(topic, p.ID, 0)
+		pipe.Group = group
+		if !detached {
+			var err error
+			pipe, err = p.Environment().subscribe(topic, group, p.ID, p.QueueSize)
+			if err != nil {
+				return err
+			}
 		}
 		p.Lock()
 		p.subscriptions = append(p.subscriptions, pipe)
@@ -268,6 +906,30 @@ func (p *Processor) Subscribe(topics ...string) error {
 	return nil
 }
 
+// Unsubscribe will remove the processors subscriptions to the topics
+// Payloads still in the queue of a removed subscription are lost, use StopGraceful before if they are needed
+func (p *Processor) Unsubscribe(topics ...string) error {
+	for _, topic := range topics {
+		p.Lock()
+		for i, sub := range p.subscriptions {
+			if sub.Topic == topic {
+				p.subscriptions = append(p.subscriptions[:i], p.subscriptions[i+1:]...)
+				break
+			}
+		}
+		detached := p.detached
+		p.Unlock()
+		if detached {
+			continue
+		}
+		err := p.Environment().unsubscribe(topic, p.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddTopics will add Topics to publish onto
 func (p *Processor) AddTopics(topics ...string) error {
 	for _, topic := range topics {
@@ -283,21 +945,57 @@ func (p *Processor) AddTopics(topics ...string) error {
 	return nil
 }
 
-// ConvertToLoader is actually just a way too convert into a savable format
-func (p *Processor) ConvertToLoader() *LoaderProccessor {
-	// Convert Subscription pipelines into []string
+// QueueDepths returns how many payloads that are queued on each subscribed topic
+func (p *Processor) QueueDepths() map[string]int {
+	p.Lock()
+	defer p.Unlock()
+	depths := make(map[string]int, len(p.subscriptions))
+	for _, sub := range p.subscriptions {
+		depths[sub.Topic] = len(sub.Flow)
+	}
+	return depths
+}
+
+// SubscribedTopics returns the names of all topics the processor is subscribed to
+func (p *Processor) SubscribedTopics() []string {
+	p.Lock()
+	defer p.Unlock()
 	var subnames []string
 	for _, sub := range p.subscriptions {
 		subnames = append(subnames, sub.Topic)
 	}
+	return subnames
+}
+
+// ConvertToLoader is actually just a way too convert into a savable format
+func (p *Processor) ConvertToLoader() *LoaderProccessor {
+	// Convert Subscription pipelines into []string
+	subnames := p.SubscribedTopics()
 	return &LoaderProccessor{
-		ID:            p.ID,
-		Name:          p.Name,
-		QueueSize:     p.QueueSize,
-		Workers:       p.Workers,
-		Running:       p.Running,
-		Topics:        p.Topics,
-		Subscriptions: subnames,
+		ID:                p.ID,
+		Name:              p.Name,
+		QueueSize:         p.QueueSize,
+		Workers:           p.Workers,
+		Running:           p.IsRunning(),
+		Paused:            p.IsPaused(),
+		Topics:            p.Topics,
+		Relationships:     p.Relationships,
+		Unrouted:          p.Unrouted,
+		Subscriptions:     subnames,
+		ExecutionInterval: p.ExecutionInterval,
+		Cron:              p.Cron,
+		RunWindow:         p.RunWindow,
+		Retry:             p.Retry,
+		HandleTimeout:     p.HandleTimeout,
+		MinWorkers:        p.MinWorkers,
+		MaxWorkers:        p.MaxWorkers,
+		RateLimit:         p.RateLimit,
+		Burst:             p.Burst,
+		Batch:             p.Batch,
+		Ordered:           p.Ordered,
+		PartitionKey:      p.PartitionKey,
+		Group:             p.Group,
+		FailureHandler:    p.failureHandler,
 		Handler: LoaderHandler{
 			Cfg:  p.Handler.GetConfiguration(),
 			Name: p.Handler.GetHandlerName(),
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
 	"github.com/percybolmer/go4data/handlers"
 	"github.com/percybolmer/go4data/handlers/files"
 	"github.com/percybolmer/go4data/handlers/filters"
@@ -16,6 +21,8 @@ import (
 	"github.com/percybolmer/go4data/payload"
 	"github.com/percybolmer/go4data/property"
 	"github.com/percybolmer/go4data/pubsub"
+	"github.com/percybolmer/go4data/ratelimit"
+	"github.com/percybolmer/go4data/schedule"
 )
 
 type testHandler struct {
@@ -44,6 +51,14 @@ func (th *testHandler) GetConfiguration() *property.Configuration {
 	}
 	return th.cfg
 }
+
+// newFuncHandler creates a Handler from fn with handlers.Func, so that tests does not need a whole Handler of their own
+func newFuncHandler(fn handlers.HandleFunc, subscriptionless bool) handlers.Handler {
+	if subscriptionless {
+		return handlers.SubscriptionlessFunc("test", fn)()
+	}
+	return handlers.Func("test", fn)()
+}
 func TestNewProcessor(t *testing.T) {
 
 	p1 := NewProcessor("test")
@@ -83,6 +98,13 @@ func TestStop(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// A stopped processor can be started again
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
 	p.SetID(1)
 	if p.ID != 1 {
 		t.Fatal("Couldnt assign ID")
@@ -143,6 +165,9 @@ func TestStart(t *testing.T) {
 		t.Fatal(err)
 	}
 	p.Stop()
+	if err := p.Subscribe("start_failed_topic"); err != nil {
+		t.Fatal(err)
+	}
 	// Try broken Handler
 	test := NewTestHandler()
 	p.SetHandler(test)
@@ -151,6 +176,11 @@ func TestStart(t *testing.T) {
 	if err == nil {
 		t.Fatal("Error should have failed since testhandler is broken")
 	}
+	// A processor that failed to start should not be left subscribed
+	if _, err := pubsub.Subscribe("start_failed_topic", p.ID, 1); err != nil {
+		t.Fatal("the failed processor is still subscribed: ", err)
+	}
+	pubsub.Unsubscribe("start_failed_topic", p.ID)
 }
 
 func TestPubSub(t *testing.T) {
@@ -283,3 +313,949 @@ func TestRealLifeCase(t *testing.T) {
 
 	// Compare metrics so that they Match
 }
+
+// countHandler is a subscriptionless handler that counts how many times it has been executed
+type countHandler struct {
+	handlers.Handler
+	calls int32
+}
+
+func newCountHandler() *countHandler {
+	ch := &countHandler{}
+	ch.Handler = newFuncHandler(ch.handle, true)
+	return ch
+}
+
+func (ch *countHandler) handle(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	atomic.AddInt32(&ch.calls, 1)
+	return nil
+}
+
+func TestHandleSubscriptionlessSchedule(t *testing.T) {
+	handler := newCountHandler()
+	p := NewProcessor("scheduled")
+	p.SetHandler(handler)
+	p.ExecutionInterval = 50 * time.Millisecond
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(275 * time.Millisecond)
+	p.Stop()
+
+	calls := atomic.LoadInt32(&handler.calls)
+	if calls < 4 || calls > 7 {
+		t.Fatal("wrong amount of executions: ", calls)
+	}
+
+	badCron := NewProcessor("badcron")
+	badCron.SetHandler(newCountHandler())
+	badCron.Cron = "not a cron"
+	if err := badCron.Start(context.Background()); !errors.Is(err, schedule.ErrBadCronExpression) {
+		t.Fatal("should not start with a bad cron expression: ", err)
+	}
+
+	both := NewProcessor("both")
+	both.SetHandler(newCountHandler())
+	both.Cron = "* * * * *"
+	both.ExecutionInterval = time.Second
+	if err := both.Start(context.Background()); !errors.Is(err, schedule.ErrIntervalAndCron) {
+		t.Fatal("should not start with both interval and cron: ", err)
+	}
+}
+
+// slowHandler sleeps on each payload to simulate work
+type slowHandler struct {
+	handlers.Handler
+	handled int32
+}
+
+func newSlowHandler() *slowHandler {
+	sh := &slowHandler{}
+	sh.Handler = newFuncHandler(sh.handle, false)
+	return sh
+}
+
+func (sh *slowHandler) handle(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	time.Sleep(20 * time.Millisecond)
+	atomic.AddInt32(&sh.handled, 1)
+	return nil
+}
+
+func TestStopGraceful(t *testing.T) {
+	handler := newSlowHandler()
+	p := NewProcessor("graceful")
+	p.SetHandler(handler)
+	p.Workers = 2
+	if err := p.Subscribe("graceful_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.StopGraceful(context.Background()); !errors.Is(err, ErrProcessorAlreadyStopped) {
+		t.Fatal("should not be able to stop a stopped processor")
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		pubsub.Publish("graceful_topic", payload.NewBasePayload([]byte(`drain me`), "test", nil))
+	}
+
+	dropped, err := p.StopGraceful(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 0 {
+		t.Fatal("no payloads should have been dropped: ", dropped)
+	}
+	if atomic.LoadInt32(&handler.handled) != 10 {
+		t.Fatal("all payloads should have been handled: ", handler.handled)
+	}
+	if p.Running || p.InFlight() != 0 {
+		t.Fatal("processor should be stopped and idle")
+	}
+
+	// Restart and make sure the deadline is respected
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		pubsub.Publish("graceful_topic", payload.NewBasePayload([]byte(`drain me`), "test", nil))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	dropped, err = p.StopGraceful(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("should have reached the deadline: ", err)
+	}
+	if dropped == 0 {
+		t.Fatal("payloads should have been dropped")
+	}
+	if int(atomic.LoadInt32(&handler.handled))+dropped != 30 {
+		t.Fatal("handled and dropped payloads does not add up: ", handler.handled, dropped)
+	}
+
+	// Stop should wait for the ongoing Handle calls so the processor can be restarted right away
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pubsub.Publish("graceful_topic", payload.NewBasePayload([]byte(`stop me`), "test", nil))
+	time.Sleep(5 * time.Millisecond)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if p.InFlight() != 0 {
+		t.Fatal("Stop should wait for the ongoing Handle calls")
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStopGracefulSteadyInput(t *testing.T) {
+	p := NewProcessor("graceful_steady")
+	p.SetHandler(newSlowHandler())
+	p.QueueSize = 50
+	if err := p.Subscribe("graceful_steady_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	publishing, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for publishing.Err() == nil {
+			pubsub.Publish("graceful_steady_topic", payload.NewBasePayload([]byte(`keep coming`), "test", nil))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Payloads that keeps arriving should not stop the processor from draining, and stopping twice should not panic
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := p.StopGraceful(context.Background())
+			errs <- err
+		}()
+	}
+	var stopped, already int
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err == nil {
+				stopped++
+			} else if errors.Is(err, ErrProcessorAlreadyStopped) {
+				already++
+			} else {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("StopGraceful never finished draining")
+		}
+	}
+	if stopped != 1 || already != 1 {
+		t.Fatalf("the processor should be stopped once, got %d stops and %d already stopped", stopped, already)
+	}
+}
+
+// flakyHandler fails a certain amount of times before succeeding
+type flakyHandler struct {
+	handlers.Handler
+	failures int32
+	calls    int32
+	attempts []int
+}
+
+func newFlakyHandler(failures int32) *flakyHandler {
+	fh := &flakyHandler{failures: failures}
+	fh.Handler = newFuncHandler(fh.handle, false)
+	return fh
+}
+
+func (fh *flakyHandler) handle(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	calls := atomic.AddInt32(&fh.calls, 1)
+	fh.attempts = append(fh.attempts, Attempt(ctx))
+	if calls <= fh.failures {
+		return errors.New("temporary failure")
+	}
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	type testCase struct {
+		Name             string
+		Failures         int32
+		Policy           *RetryPolicy
+		ExpectedCalls    int32
+		ExpectedAttempts int
+	}
+
+	testCases := []testCase{
+		{Name: "NoPolicy", Failures: 2, ExpectedCalls: 1, ExpectedAttempts: 1},
+		{Name: "RecoversOnThird", Failures: 2, Policy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, ExpectedCalls: 3},
+		{Name: "GivesUp", Failures: 5, Policy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, ExpectedCalls: 3, ExpectedAttempts: 3},
+		{Name: "NotRetryable", Failures: 5, Policy: &RetryPolicy{MaxAttempts: 3, RetryOn: []string{"timeout"}}, ExpectedCalls: 1, ExpectedAttempts: 1},
+	}
+
+	for _, tc := range testCases {
+		handler := newFlakyHandler(tc.Failures)
+		p := NewProcessor(tc.Name)
+		p.SetHandler(handler)
+		p.Retry = tc.Policy
+		var failure Failure
+		p.FailureHandler = func(f Failure) {
+			failure = f
+		}
+
+		pay := payload.NewBasePayload([]byte(`retry me`), "test", nil)
+		p.handlePayload(context.Background(), handlers.Discard, pay)
+
+		if handler.calls != tc.ExpectedCalls {
+			t.Fatalf("%s: expected %d calls, got %d", tc.Name, tc.ExpectedCalls, handler.calls)
+		}
+		if failure.Attempts != tc.ExpectedAttempts {
+			t.Fatalf("%s: expected failure after %d attempts, got %d", tc.Name, tc.ExpectedAttempts, failure.Attempts)
+		}
+		if tc.Policy != nil {
+			for i, attempt := range handler.attempts {
+				if attempt != i+1 {
+					t.Fatalf("%s: the handler got the wrong attempt %d, expected %d", tc.Name, attempt, i+1)
+				}
+			}
+		}
+	}
+
+	cancelled := NewProcessor("cancelled_retry")
+	cancelled.SetHandler(newFlakyHandler(5))
+	cancelled.Retry = &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	var failure Failure
+	cancelled.FailureHandler = func(f Failure) {
+		failure = f
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled.handlePayload(ctx, handlers.Discard, payload.NewBasePayload([]byte(`retry me`), "test", nil))
+	if failure.Attempts != 1 {
+		t.Fatal("a cancelled context should stop retrying: ", failure.Attempts)
+	}
+
+	// Processors that gets the same payload keeps track of their own attempts
+	shared := payload.NewBasePayload([]byte(`retry me`), "test", nil)
+	var wg sync.WaitGroup
+	var flaky []*flakyHandler
+	for i := 0; i < 2; i++ {
+		handler := newFlakyHandler(2)
+		flaky = append(flaky, handler)
+		p := NewProcessor("shared_retry")
+		p.SetHandler(handler)
+		p.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.handlePayload(context.Background(), handlers.Discard, shared)
+		}()
+	}
+	wg.Wait()
+	for _, handler := range flaky {
+		if len(handler.attempts) != 3 || handler.attempts[0] != 1 || handler.attempts[1] != 2 || handler.attempts[2] != 3 {
+			t.Fatal("each processor should count its own attempts: ", handler.attempts)
+		}
+	}
+	if shared.GetMetaData().GetProperty("attempt") != nil {
+		t.Fatal("the attempt should not be written to the shared payload")
+	}
+}
+
+// batchHandler records the size of each batch it gets
+type batchHandler struct {
+	handlers.Base
+	sync.Mutex
+	batches []int
+}
+
+func newBatchHandler() *batchHandler {
+	return &batchHandler{Base: handlers.NewBase("batch")}
+}
+
+func (bh *batchHandler) Handle(ctx context.Context, emitter handlers.Emitter, p payload.Payload) error {
+	return errors.New("Handle should not be used by a BatchHandler")
+}
+func (bh *batchHandler) HandleBatch(ctx context.Context, emitter handlers.Emitter, payloads []payload.Payload) error {
+	bh.Lock()
+	defer bh.Unlock()
+	bh.batches = append(bh.batches, len(payloads))
+	return nil
+}
+func (bh *batchHandler) getBatches() []int {
+	bh.Lock()
+	defer bh.Unlock()
+	return append([]int{}, bh.batches...)
+}
+
+func TestBatch(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Topic    string
+		Batch    *BatchConfig
+		Expected []int
+	}
+
+	testCases := []testCase{
+		{Name: "Size", Topic: "batch_size_topic", Batch: &BatchConfig{Size: 3, Linger: 50 * time.Millisecond}, Expected: []int{3, 3, 1}},
+		{Name: "Bytes", Topic: "batch_bytes_topic", Batch: &BatchConfig{Size: 100, Bytes: 10, Linger: 50 * time.Millisecond}, Expected: []int{2, 2, 2, 1}},
+	}
+
+	for _, tc := range testCases {
+		handler := newBatchHandler()
+		p := NewProcessor(tc.Name)
+		p.SetHandler(handler)
+		p.Batch = tc.Batch
+		if err := p.Subscribe(tc.Topic); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 7; i++ {
+			pubsub.Publish(tc.Topic, payload.NewBasePayload([]byte(`batch`), "test", nil))
+		}
+		time.Sleep(100 * time.Millisecond)
+		p.Stop()
+
+		batches := handler.getBatches()
+		if fmt.Sprint(batches) != fmt.Sprint(tc.Expected) {
+			t.Fatalf("%s: expected batches %v, got %v", tc.Name, tc.Expected, batches)
+		}
+	}
+
+	// Draining should flush a batch that is not full
+	handler := newBatchHandler()
+	p := NewProcessor("batch_drain")
+	p.SetHandler(handler)
+	p.Batch = &BatchConfig{Size: 100, Linger: time.Hour}
+	if err := p.Subscribe("batch_drain_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		pubsub.Publish("batch_drain_topic", payload.NewBasePayload([]byte(`batch`), "test", nil))
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(handler.getBatches()) != "[5]" {
+		t.Fatal("the batch was not flushed when draining: ", handler.getBatches())
+	}
+
+	bad := NewProcessor("batch_bad")
+	bad.SetHandler(newBatchHandler())
+	bad.Batch = &BatchConfig{Size: -1}
+	if err := bad.Start(context.Background()); !errors.Is(err, ErrBadBatchConfig) {
+		t.Fatal("should not start with a bad batch config: ", err)
+	}
+}
+
+// orderHandler sleeps a random time and forwards the payload, used to make workers finish out of order
+type orderHandler struct {
+	handlers.Handler
+	sync.Mutex
+	handled []string
+}
+
+func newOrderHandler() *orderHandler {
+	oh := &orderHandler{}
+	oh.Handler = newFuncHandler(oh.handle, false)
+	return oh
+}
+
+func (oh *orderHandler) handle(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+	oh.Lock()
+	oh.handled = append(oh.handled, string(p.GetPayload()))
+	oh.Unlock()
+	emitter.Emit(ctx, p)
+	return nil
+}
+
+func TestOrdered(t *testing.T) {
+	handler := newOrderHandler()
+	p := NewProcessor("ordered", "ordered_out")
+	p.SetHandler(handler)
+	p.Workers = 8
+	p.Ordered = true
+	if err := p.Subscribe("ordered_in"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := pubsub.Subscribe("ordered_out", NewID(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		pubsub.Publish("ordered_in", payload.NewBasePayload([]byte(fmt.Sprint(i)), "test", nil))
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Flow) != 100 {
+		t.Fatal("all payloads should have been published: ", len(out.Flow))
+	}
+	for i := 0; i < 100; i++ {
+		pay := <-out.Flow
+		if string(pay.GetPayload()) != fmt.Sprint(i) {
+			t.Fatalf("expected payload %d, got %s", i, pay.GetPayload())
+		}
+	}
+
+	// The handler should have run concurrently and out of order
+	handler.Lock()
+	defer handler.Unlock()
+	inOrder := true
+	for i, handled := range handler.handled {
+		if handled != fmt.Sprint(i) {
+			inOrder = false
+		}
+	}
+	if inOrder {
+		t.Fatal("the payloads should have been handled concurrently")
+	}
+
+	bad := NewProcessor("ordered_batch")
+	bad.SetHandler(newBatchHandler())
+	bad.Workers = 2
+	bad.Ordered = true
+	if err := bad.Start(context.Background()); !errors.Is(err, ErrOrderedBatchHandler) {
+		t.Fatal("ordered batch handlers should not start: ", err)
+	}
+}
+
+func TestOrderedPartitionKey(t *testing.T) {
+	handler := newOrderHandler()
+	p := NewProcessor("partitioned", "partitioned_out")
+	p.SetHandler(handler)
+	p.Workers = 4
+	p.Ordered = true
+	p.PartitionKey = "file"
+	if err := p.Subscribe("partitioned_in"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := pubsub.Subscribe("partitioned_out", NewID(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"a.csv", "b.csv", "c.csv"}
+	for i := 0; i < 90; i++ {
+		meta := property.NewConfiguration()
+		meta.AddProperty("file", "", false)
+		meta.SetProperty("file", files[i%len(files)])
+		pubsub.Publish("partitioned_in", payload.NewBasePayload([]byte(fmt.Sprint(i)), "test", meta))
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Flow) != 90 {
+		t.Fatal("all payloads should have been published: ", len(out.Flow))
+	}
+	last := make(map[string]int)
+	for i := 0; i < 90; i++ {
+		pay := <-out.Flow
+		file := pay.GetMetaData().GetProperty("file").String()
+		var n int
+		fmt.Sscan(string(pay.GetPayload()), &n)
+		if prev, ok := last[file]; ok && n < prev {
+			t.Fatalf("payload %d of %s came after %d", n, file, prev)
+		}
+		last[file] = n
+	}
+}
+
+func TestOrderedRetryOutput(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	handler := newFuncHandler(func(ctx context.Context, emitter handlers.Emitter, cfg *property.Configuration, p payload.Payload) error {
+		emitter.Emit(ctx, p)
+		mu.Lock()
+		defer mu.Unlock()
+		calls[string(p.GetPayload())]++
+		if calls[string(p.GetPayload())] < 3 {
+			return errors.New("emitted and then failed")
+		}
+		return nil
+	}, false)
+	p := NewProcessor("ordered_retry", "ordered_retry_out")
+	p.SetHandler(handler)
+	p.Workers = 2
+	p.Ordered = true
+	p.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	if err := p.Subscribe("ordered_retry_in"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := pubsub.Subscribe("ordered_retry_out", NewID(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		pubsub.Publish("ordered_retry_in", payload.NewBasePayload([]byte(fmt.Sprint(i)), "test", nil))
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Flow) != 5 {
+		t.Fatal("only the output of the last attempt should be published: ", len(out.Flow))
+	}
+}
+
+func TestOrderedPartitionKeyPausedStop(t *testing.T) {
+	handler := newSlowHandler()
+	p := NewProcessor("partitioned_paused")
+	p.SetHandler(handler)
+	p.Workers = 2
+	p.Ordered = true
+	p.PartitionKey = "file"
+	if err := p.Subscribe("partitioned_paused_in"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		pubsub.Publish("partitioned_paused_in", payload.NewBasePayload([]byte(fmt.Sprint(i)), "test", nil))
+	}
+	// The payloads are moved to the queue of one worker, which is busy with the first one when the processor is paused
+	time.Sleep(5 * time.Millisecond)
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := p.StopGraceful(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := int(atomic.LoadInt32(&handler.handled))
+	if dropped == 0 || handled+dropped != 6 {
+		t.Fatalf("the payloads left in the worker queues should be counted as dropped, %d handled and %d dropped", handled, dropped)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	handler := newSlowHandler()
+	p := NewProcessor("pausable")
+	p.SetHandler(handler)
+	p.Workers = 2
+	if err := p.Resume(); !errors.Is(err, ErrProcessorNotPaused) {
+		t.Fatal("should not be able to resume a processor that is not paused: ", err)
+	}
+	if err := p.Subscribe("pausable_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pause(); !errors.Is(err, ErrProcessorAlreadyPaused) {
+		t.Fatal("should not be able to pause twice: ", err)
+	}
+	// Let the workers see the pause before publishing
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		pubsub.Publish("pausable_topic", payload.NewBasePayload([]byte(`wait for me`), "test", nil))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if handled := atomic.LoadInt32(&handler.handled); handled > 2 {
+		t.Fatal("a paused processor should not handle payloads: ", handled)
+	}
+	if !p.IsPaused() {
+		t.Fatal("the processor should be paused")
+	}
+
+	if err := p.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handled := atomic.LoadInt32(&handler.handled); handled != 10 {
+		t.Fatal("all queued payloads should be handled after resuming: ", handled)
+	}
+
+	// Draining a paused processor should not handle the queue
+	p.Pause()
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		pubsub.Publish("pausable_topic", payload.NewBasePayload([]byte(`wait for me`), "test", nil))
+	}
+	dropped, err := p.StopGraceful(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 5 {
+		t.Fatal("the queued payloads should be dropped: ", dropped)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := newOrderHandler()
+	p := NewProcessor("ratelimited")
+	p.SetHandler(handler)
+	p.Workers = 4
+	p.RateLimit = -1
+	if err := p.Start(context.Background()); !errors.Is(err, ratelimit.ErrBadLimit) {
+		t.Fatal("expected ErrBadLimit: ", err)
+	}
+	p.RateLimit = 100
+	p.Burst = 2
+	if err := p.Subscribe("ratelimited_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		pubsub.Publish("ratelimited_topic", payload.NewBasePayload([]byte(`slow down`), "test", nil))
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 2 payloads in the burst, then 5 at 100/s, even with 4 workers
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatal("the rate limit should be shared by all workers, took ", elapsed)
+	}
+	handler.Lock()
+	defer handler.Unlock()
+	if len(handler.handled) != 7 {
+		t.Fatal("all payloads should be handled: ", len(handler.handled))
+	}
+	if throttled := p.Metric.GetMetric(p.metricName("throttled_seconds")); throttled == nil || throttled.Value <= 0 {
+		t.Fatal("the time spent throttled should be counted")
+	}
+}
+
+func TestSetProperties(t *testing.T) {
+	p := NewProcessor("setproperties")
+	if err := p.SetProperties(map[string]interface{}{"forward": false}); !errors.Is(err, ErrProcessorHasNoHandlerApplied) {
+		t.Fatal(err)
+	}
+	p.SetHandler(terminal.NewStdoutHandler())
+
+	type testCase struct {
+		Name          string
+		Values        map[string]interface{}
+		ExpectedErr   error
+		ExpectedValue interface{}
+	}
+	testCases := []testCase{
+		{Name: "Valid", Values: map[string]interface{}{"forward": false}, ExpectedValue: false},
+		{Name: "WrongType", Values: map[string]interface{}{"forward": "sometimes"}, ExpectedErr: ErrRequiredPropertiesNotFulfilled, ExpectedValue: false},
+		{Name: "NoSuchProperty", Values: map[string]interface{}{"forward": true, "backward": true}, ExpectedErr: property.ErrNoSuchProperty, ExpectedValue: false},
+	}
+	for _, tc := range testCases {
+		err := p.SetProperties(tc.Values)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+		if value := p.GetConfiguration().GetProperty("forward").Value; value != tc.ExpectedValue {
+			t.Fatalf("%s: forward should be %v, got %v", tc.Name, tc.ExpectedValue, value)
+		}
+	}
+
+	if err := p.Subscribe("setproperties_in"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if err := p.SetProperties(map[string]interface{}{"forward": true}); !errors.Is(err, ErrProcessorRunning) {
+		t.Fatal("should not change a running processor: ", err)
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	pubsub.Publish("setproperties_in", payload.NewBasePayload([]byte(`queued`), "test", nil))
+	if depths := p.QueueDepths(); depths["setproperties_in"] != 1 {
+		t.Fatal("wrong queue depths: ", depths)
+	}
+}
+
+func TestPatternSubscription(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	handler := newOrderHandler()
+	p := env.NewProcessor("archive")
+	p.SetHandler(handler)
+	p.QueueSize = 10
+	if err := p.Subscribe("patternsub.raw.*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	// The topics does not exist until they are published to
+	env.Publish("patternsub.raw.sales", payload.NewBasePayload([]byte(`sales`), "test", nil))
+	env.Publish("patternsub.raw.hr", payload.NewBasePayload([]byte(`hr`), "test", nil))
+	env.Publish("patternsub.parsed.hr", payload.NewBasePayload([]byte(`parsed`), "test", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	handler.Lock()
+	handled := len(handler.handled)
+	handler.Unlock()
+	if handled != 2 {
+		t.Fatalf("the pattern should match two topics, got %d payloads", handled)
+	}
+
+	// Stopping and starting should resubscribe the pattern
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	env.Publish("patternsub.raw.it", payload.NewBasePayload([]byte(`it`), "test", nil))
+	time.Sleep(100 * time.Millisecond)
+	handler.Lock()
+	handled = len(handler.handled)
+	handler.Unlock()
+	if handled != 3 {
+		t.Fatalf("the pattern should be subscribed after a restart, got %d payloads", handled)
+	}
+}
+
+func TestProcessorGroup(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+
+	var members []*orderHandler
+	for i := 0; i < 2; i++ {
+		handler := newOrderHandler()
+		p := env.NewProcessor("member")
+		p.SetHandler(handler)
+		p.QueueSize = 10
+		p.Group = "heavy"
+		if err := p.Subscribe("procgroup_in"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer p.Stop()
+		members = append(members, handler)
+	}
+	for i := 0; i < 10; i++ {
+		if errs := env.Publish("procgroup_in", payload.NewBasePayload([]byte(fmt.Sprintf("%d", i)), "test", nil)); len(errs) != 0 {
+			t.Fatal(errs[0].Err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	total := 0
+	for _, handler := range members {
+		handler.Lock()
+		if len(handler.handled) == 0 {
+			t.Fatal("both members should share the work")
+		}
+		total += len(handler.handled)
+		handler.Unlock()
+	}
+	if total != 10 {
+		t.Fatalf("each payload should be handled once by the group, got %d", total)
+	}
+}
+
+func TestProcessorAcknowledges(t *testing.T) {
+	type testCase struct {
+		Name          string
+		Failures      int32
+		MaxDeliveries int64
+		// ExpectedCalls is how many times the payload should be handled before it is acknowledged
+		ExpectedCalls int32
+		// ExpectedFailures is how many times the FailureHandler should be called
+		ExpectedFailures int32
+	}
+
+	testCases := []testCase{
+		// The first try fails, so the payload should stay pending until it is claimed and handled again
+		{Name: "Redelivered", Failures: 1, ExpectedCalls: 2},
+		// A payload that always fails should only reach the FailureHandler on its last delivery
+		{Name: "GivenUp", Failures: 100, MaxDeliveries: 3, ExpectedCalls: 3, ExpectedFailures: 1},
+	}
+
+	for _, tc := range testCases {
+		mr := miniredis.RunT(t)
+		env := NewEnvironment()
+		env.Engine.Cancel()
+		engine, err := pubsub.Dial(pubsub.WithRedisStreamsEngine(&redis.Options{Addr: mr.Addr()}), pubsub.WithClaimPending(200*time.Millisecond, 50*time.Millisecond, tc.MaxDeliveries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine.(*pubsub.RedisStreamsEngine).ReadBlock = 50 * time.Millisecond
+		env.Engine = engine
+
+		handler := newFlakyHandler(tc.Failures)
+		p := env.NewProcessor("acker")
+		p.SetHandler(handler)
+		var failures int32
+		p.FailureHandler = func(f Failure) {
+			atomic.AddInt32(&failures, 1)
+		}
+		p.QueueSize = 10
+		if err := p.Subscribe("procack_in"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		env.Publish("procack_in", payload.NewBasePayload([]byte(`ack me`), "test", nil))
+
+		client := engine.(*pubsub.RedisStreamsEngine).Client
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			pending, err := client.XPending(context.Background(), "procack_in", fmt.Sprintf("pid-%d", p.ID)).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if atomic.LoadInt32(&handler.calls) == tc.ExpectedCalls && pending.Count == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: the payload should be handled %d times and then acknowledged, got %d calls and %d pending", tc.Name, tc.ExpectedCalls, atomic.LoadInt32(&handler.calls), pending.Count)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		// Make sure it is not delivered again after being acknowledged
+		time.Sleep(300 * time.Millisecond)
+		p.Stop()
+		env.Close()
+		if calls := atomic.LoadInt32(&handler.calls); calls != tc.ExpectedCalls {
+			t.Fatalf("%s: the payload should not be delivered after it is acknowledged, got %d calls", tc.Name, calls)
+		}
+		if got := atomic.LoadInt32(&failures); got != tc.ExpectedFailures {
+			t.Fatalf("%s: expected %d failures, got %d", tc.Name, tc.ExpectedFailures, got)
+		}
+	}
+}
+
+func TestStopUnsubscribes(t *testing.T) {
+	env := NewEnvironment()
+	defer env.Close()
+	engine := env.Engine.(*pubsub.DefaultEngine)
+	subscribers := func() int {
+		topic, ok := engine.Topics.Load("stopunsub_in")
+		if !ok {
+			t.Fatal("the topic should exist")
+		}
+		top := topic.(*pubsub.Topic)
+		top.Lock()
+		defer top.Unlock()
+		return len(top.Subscribers)
+	}
+
+	p := env.NewProcessor("stopunsub")
+	p.SetHandler(newSlowHandler())
+	p.QueueSize = 1
+	if err := p.Subscribe("stopunsub_in"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if subscribers() != 0 {
+		t.Fatal("a stopped processor should not be subscribed")
+	}
+	// Nobody reads the queue of a stopped processor, so nothing should be queued for it
+	for i := 0; i < 5; i++ {
+		if errs := env.Publish("stopunsub_in", payload.NewBasePayload([]byte(`nobody home`), "test", nil)); len(errs) != 0 {
+			t.Fatal(errs[0].Err)
+		}
+	}
+	if topics := p.SubscribedTopics(); len(topics) != 1 || topics[0] != "stopunsub_in" {
+		t.Fatal("the topics should be kept when stopped: ", topics)
+	}
+
+	if err := p.Subscribe("stopunsub_other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if subscribers() != 1 || len(p.SubscribedTopics()) != 2 {
+		t.Fatal("starting again should subscribe to the topics")
+	}
+	if _, err := p.StopGraceful(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if subscribers() != 0 {
+		t.Fatal("a gracefully stopped processor should not be subscribed")
+	}
+	if err := p.Unsubscribe("stopunsub_in"); err != nil {
+		t.Fatal(err)
+	}
+	if topics := p.SubscribedTopics(); len(topics) != 1 || topics[0] != "stopunsub_other" {
+		t.Fatal("wrong topics after unsubscribing: ", topics)
+	}
+}
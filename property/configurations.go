@@ -75,3 +75,18 @@ func (a *Configuration) RemoveProperty(name string) {
 		}
 	}
 }
+
+// Copy returns a new Configuration with copies of all the properties
+// Values are not deep copied, so slices and maps are still shared
+func (a *Configuration) Copy() *Configuration {
+	a.Lock()
+	defer a.Unlock()
+	cfg := &Configuration{
+		Properties: make([]*Property, 0, len(a.Properties)),
+	}
+	for _, prop := range a.Properties {
+		p := *prop
+		cfg.Properties = append(cfg.Properties, &p)
+	}
+	return cfg
+}
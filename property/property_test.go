@@ -34,6 +34,26 @@ func TestAddingRemovingProperties(t *testing.T) {
 		t.Fatal("Shouldnt have found any config after removal")
 	}
 }
+func TestCopy(t *testing.T) {
+	p := NewConfiguration()
+	p.AddProperty("file", "test", true)
+	p.SetProperty("file", "a.csv")
+
+	c := p.Copy()
+	c.SetProperty("file", "b.csv")
+	c.AddProperty("extra", "test", false)
+
+	if p.GetProperty("file").String() != "a.csv" {
+		t.Fatal("changing the copy should not change the original")
+	}
+	if p.GetProperty("extra") != nil {
+		t.Fatal("adding to the copy should not add to the original")
+	}
+	if !c.GetProperty("file").Required {
+		t.Fatal("the copy should keep all fields")
+	}
+}
+
 func TestValidation(t *testing.T) {
 	p := &Configuration{
 		Properties: make([]*Property, 0),
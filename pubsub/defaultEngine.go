@@ -3,11 +3,13 @@
 package pubsub
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
 	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/ratelimit"
 )
 
 var (
@@ -26,9 +28,30 @@ var (
 	ErrProcessorQueueIsFull = errors.New("cannot push new payload since queue is full")
 	//ErrTopicBufferIsFull is when a Publisher is trying to publish to a Topic that has a full buffer
 	ErrTopicBufferIsFull = errors.New("cannot push new payload since topic queue is full")
+	//ErrPublishTimeout is when a Publisher using blocking delivery has waited too long for room in a queue
+	ErrPublishTimeout = errors.New("timed out waiting for room in the queue")
+	//ErrNotDefaultEngine is when trying to configure DefaultEngine settings on another engine
+	ErrNotDefaultEngine = errors.New("the option can only be used on the DefaultEngine")
+
+	// BufferRetryInterval is how often a blocked Publisher checks if there is room in a topic buffer
+	BufferRetryInterval = 10 * time.Millisecond
 
 	//IDCounter is used to make sure no Topic are generated with a ID that already exists
 	IDCounter uint = 1
+	// idMu protects IDCounter since Topics can be created concurrently
+	idMu sync.Mutex
+)
+
+// DeliveryMode decides what happens when a Publisher tries to publish to a full queue
+type DeliveryMode int
+
+const (
+	// DeliveryDefault is used on topics to use the same DeliveryMode as the engine, for the engine its the same as DeliveryDrop
+	DeliveryDefault DeliveryMode = iota
+	// DeliveryDrop will drop the payload and return a PublishingError if the queue is full
+	DeliveryDrop
+	// DeliveryBlock will make the Publisher wait until there is room in the queue, or until the timeout or context is done
+	DeliveryBlock
 )
 
 // DefaultEngine is the default Pub/Sub engine that Go4Data uses
@@ -37,6 +60,16 @@ type DefaultEngine struct {
 	// Topics is a container for topics that has been created.
 	// A topic is automatically created when a Processor registers as a Subscriber to it
 	Topics sync.Map
+	// Delivery is the DeliveryMode used for all topics that has not set their own
+	Delivery DeliveryMode
+	// BlockTimeout is the longest time a Publisher waits when using DeliveryBlock, 0 means it waits until the context is done
+	BlockTimeout time.Duration
+	// stop is closed by Cancel to stop draining the buffers
+	stop     chan struct{}
+	stopOnce sync.Once
+	// patterns is the Pipes of pattern subscriptions, they are added to each Topic that matches, also Topics created later
+	patterns   []*Pipe
+	patternsMu sync.Mutex
 }
 
 // Topic is a topic that processors can publish or subscribe to
@@ -49,11 +82,23 @@ type Topic struct {
 	Subscribers []*Pipe
 	// Buffer is a data pipe containing our Buffer data. It will empty as soon as a subscriber registers
 	Buffer *Pipe
+	// Delivery is the DeliveryMode of the topic, DeliveryDefault uses the DeliveryMode of the engine
+	Delivery DeliveryMode
+	// BlockTimeout overrides the BlockTimeout of the engine if set
+	BlockTimeout time.Duration
+	// limiter caps how fast payloads are delivered on the topic, nil means no limit
+	limiter *ratelimit.Limiter
+	// pipes is the Subscribers by pid, it is read without the lock when unsubscribing since blocked Publishers are holding it
+	pipes sync.Map
+	// turns is used to take turns between members of a consumer group that have the same amount of room in their queues
+	turns map[string]int
 	sync.Mutex
 }
 
 // newID is used to generate a new ID
 func newID() uint {
+	idMu.Lock()
+	defer idMu.Unlock()
 	IDCounter++
 	return IDCounter - 1
 }
@@ -72,28 +117,83 @@ func EngineAsDefaultEngine() (*DefaultEngine, error) {
 // Drain the Buffer each X Second in the background
 func WithDefaultEngine(seconds int) DialOptions {
 	return func(e Engine) (Engine, error) {
-		de := &DefaultEngine{
-			Topics: sync.Map{},
-		}
-		go func() {
-			timer := time.NewTicker(time.Duration(seconds) * time.Second)
-			for {
-				select {
-				case <-timer.C:
-					de.DrainTopicsBuffer()
-				}
+		return NewDefaultEngine(seconds), nil
+	}
+}
+
+// NewDefaultEngine creates a DefaultEngine that drains the Buffer each X Second in the background
+// until Cancel is called
+func NewDefaultEngine(seconds int) *DefaultEngine {
+	de := &DefaultEngine{
+		Topics: sync.Map{},
+		stop:   make(chan struct{}),
+	}
+	go func() {
+		timer := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				de.DrainTopicsBuffer()
+			case <-de.stop:
+				return
 			}
-		}()
-		engine = de
+		}
+	}()
+	return de
+}
+
+// WithBlockingDelivery is a DialOption that makes the DefaultEngine block Publishers
+// until there is room in the queues instead of dropping payloads
+// The timeout is the longest time to wait, 0 means waiting until the context used when publishing is done
+// It has to be used after WithDefaultEngine
+func WithBlockingDelivery(timeout time.Duration) DialOptions {
+	return func(e Engine) (Engine, error) {
+		de, ok := e.(*DefaultEngine)
+		if !ok {
+			return nil, ErrNotDefaultEngine
+		}
+		de.Delivery = DeliveryBlock
+		de.BlockTimeout = timeout
 		return de, nil
 	}
 }
 
+// SetTopicDelivery changes the DeliveryMode of a single topic, the topic is created if it does not exist
+func (de *DefaultEngine) SetTopicDelivery(key string, mode DeliveryMode, timeout time.Duration) error {
+	top, err := de.getOrCreateTopic(key)
+	if err != nil {
+		return err
+	}
+	top.Lock()
+	top.Delivery = mode
+	top.BlockTimeout = timeout
+	top.Unlock()
+	return nil
+}
+
+// SetTopicRateLimit caps how many payloads per second the topic delivers to its subscribers, the topic is created if it does not exist
+// Publishers wait until the payloads are allowed, a rate of 0 removes the limit
+func (de *DefaultEngine) SetTopicRateLimit(key string, rate float64, burst int) error {
+	limiter, err := ratelimit.New(rate, burst)
+	if err != nil {
+		return err
+	}
+	top, err := de.getOrCreateTopic(key)
+	if err != nil {
+		return err
+	}
+	top.Lock()
+	top.limiter = limiter
+	if rate == 0 {
+		top.limiter = nil
+	}
+	top.Unlock()
+	return nil
+}
+
 // NewTopic will generate a new Topic and assign it into the Topics map, it will also return it
 func (de *DefaultEngine) NewTopic(key string) (*Topic, error) {
-	if de.TopicExists(key) {
-		return nil, ErrTopicAlreadyExists
-	}
 	t := &Topic{
 		Key:         key,
 		ID:          newID(),
@@ -102,8 +202,18 @@ func (de *DefaultEngine) NewTopic(key string) (*Topic, error) {
 			Flow: make(chan payload.Payload, 1000),
 		},
 	}
-	de.Topics.Store(key, t)
-
+	// Hold the patterns while storing so a pattern subscription cannot miss the Topic
+	de.patternsMu.Lock()
+	defer de.patternsMu.Unlock()
+	for _, sub := range de.patterns {
+		if MatchTopic(sub.Topic, key) {
+			t.Subscribers = append(t.Subscribers, sub)
+		}
+	}
+	// LoadOrStore so that two callers creating the same Topic at once cannot replace each other
+	if _, loaded := de.Topics.LoadOrStore(key, t); loaded {
+		return nil, ErrTopicAlreadyExists
+	}
 	return t, nil
 }
 
@@ -133,30 +243,44 @@ func (de *DefaultEngine) getTopic(key string) (*Topic, error) {
 // Subscribe will take a key and a Pid (processor ID) and Add a new Subscription to a topic
 // It will also return the topic used
 func (de *DefaultEngine) Subscribe(key string, pid uint, queueSize int) (*Pipe, error) {
-	top, err := de.NewTopic(key)
-	if errors.Is(err, ErrTopicAlreadyExists) {
-		// Topic exists, see if PID is not duplicate
-		topic, err := de.getTopic(key)
-		if err != nil {
-			return nil, err
-		}
-		for _, sub := range topic.Subscribers {
-			if sub.Pid == pid {
-				return nil, ErrPidAlreadyRegistered
-			}
+	return de.subscribe(key, "", pid, queueSize)
+}
+
+// SubscribeGroup subscribes to a Topic as a member of a consumer group
+// Each payload goes to one member of the group, the one with the most room in its queue, and members with the same room take turns
+func (de *DefaultEngine) SubscribeGroup(key, group string, pid uint, queueSize int) (*Pipe, error) {
+	return de.subscribe(key, group, pid, queueSize)
+}
+
+// subscribe adds a Pipe to the Topic, or to all Topics matching a pattern
+func (de *DefaultEngine) subscribe(key, group string, pid uint, queueSize int) (*Pipe, error) {
+	if IsPattern(key) {
+		return de.subscribePattern(key, group, pid, queueSize)
+	}
+	top, err := de.getOrCreateTopic(key)
+	if err != nil {
+		return nil, err
+	}
+	top.Lock()
+	defer top.Unlock()
+	// The PID is checked while holding the lock so that the same PID cannot subscribe twice at once
+	for _, sub := range top.Subscribers {
+		if sub.Pid == pid && sub.Topic == key {
+			return nil, ErrPidAlreadyRegistered
 		}
-		top = topic
 	}
-	// Topic is new , add subscription
 	sub := NewPipe(key, pid, queueSize)
-	top.Lock()
+	sub.Group = group
 	top.Subscribers = append(top.Subscribers, sub)
-	top.Unlock()
+	top.pipes.Store(pid, sub)
 	return sub, nil
 }
 
 // Unsubscribe will remove and close a channel related to a subscription
 func (de *DefaultEngine) Unsubscribe(key string, pid uint) error {
+	if IsPattern(key) {
+		return de.unsubscribePattern(key, pid)
+	}
 	if !de.TopicExists(key) {
 		return ErrNoSuchTopic
 	}
@@ -164,6 +288,10 @@ func (de *DefaultEngine) Unsubscribe(key string, pid uint) error {
 	if err != nil {
 		return err
 	}
+	// Publishers blocked on a full queue keeps the topic locked, wake them up so the lock can be taken
+	if pipe, ok := topic.pipes.Load(pid); ok {
+		pipe.(*Pipe).stop()
+	}
 	topic.Lock()
 	defer topic.Unlock()
 	pipeline, err := de.removePipeIfExist(key, pid, topic.Subscribers)
@@ -173,6 +301,7 @@ func (de *DefaultEngine) Unsubscribe(key string, pid uint) error {
 	if pipeline != nil {
 		topic.Subscribers = pipeline
 	}
+	topic.pipes.Delete(pid)
 
 	return nil
 }
@@ -180,7 +309,8 @@ func (de *DefaultEngine) Unsubscribe(key string, pid uint) error {
 // removePipeIfExist is used to delete a index from a pipe slice and return a new slice without it
 func (de *DefaultEngine) removePipeIfExist(key string, pid uint, pipes []*Pipe) ([]*Pipe, error) {
 	for i, p := range pipes {
-		if p.Pid == pid {
+		// Pattern subscriptions on the topic can have the same pid, so the key has to match as well
+		if p.Pid == pid && p.Topic == key {
 			close(p.Flow)
 			pipes[i] = pipes[len(pipes)-1]
 			return pipes[:len(pipes)-1], nil
@@ -189,6 +319,76 @@ func (de *DefaultEngine) removePipeIfExist(key string, pid uint, pipes []*Pipe)
 	return nil, ErrNoSuchPid
 }
 
+// subscribePattern adds a Pipe to all Topics that matches the pattern, Topics created later are matched in NewTopic
+func (de *DefaultEngine) subscribePattern(pattern, group string, pid uint, queueSize int) (*Pipe, error) {
+	de.patternsMu.Lock()
+	defer de.patternsMu.Unlock()
+	for _, sub := range de.patterns {
+		if sub.Pid == pid && sub.Topic == pattern {
+			return nil, ErrPidAlreadyRegistered
+		}
+	}
+	sub := NewPipe(pattern, pid, queueSize)
+	sub.Group = group
+	de.patterns = append(de.patterns, sub)
+	de.Topics.Range(func(key, value interface{}) bool {
+		top, ok := value.(*Topic)
+		if !ok || !MatchTopic(pattern, top.Key) {
+			return true
+		}
+		top.Lock()
+		top.Subscribers = append(top.Subscribers, sub)
+		top.Unlock()
+		return true
+	})
+	return sub, nil
+}
+
+// unsubscribePattern removes the Pipe of a pattern subscription from all Topics it was added to
+func (de *DefaultEngine) unsubscribePattern(pattern string, pid uint) error {
+	de.patternsMu.Lock()
+	defer de.patternsMu.Unlock()
+	index := -1
+	found := false
+	for i, sub := range de.patterns {
+		if sub.Topic != pattern {
+			continue
+		}
+		found = true
+		if sub.Pid == pid {
+			index = i
+		}
+	}
+	if !found {
+		return ErrNoSuchTopic
+	}
+	if index == -1 {
+		return ErrNoSuchPid
+	}
+	sub := de.patterns[index]
+	// Publishers blocked on a full queue keeps the topics locked, wake them up so the locks can be taken
+	sub.stop()
+	de.Topics.Range(func(key, value interface{}) bool {
+		top, ok := value.(*Topic)
+		if !ok {
+			return true
+		}
+		top.Lock()
+		for i, p := range top.Subscribers {
+			if p == sub {
+				top.Subscribers = append(top.Subscribers[:i], top.Subscribers[i+1:]...)
+				break
+			}
+		}
+		top.Unlock()
+		return true
+	})
+	de.patterns = append(de.patterns[:index], de.patterns[index+1:]...)
+	// The pipe is shared by the topics so it can only be closed once it has been removed from all of them
+	close(sub.Flow)
+	return nil
+}
+
 // DrainTopicsBuffer will itterate all topics and drain their buffer if there is any subscribers
 func (de *DefaultEngine) DrainTopicsBuffer() {
 	de.Topics.Range(func(key, value interface{}) bool {
@@ -205,7 +405,7 @@ func (de *DefaultEngine) DrainTopicsBuffer() {
 				break
 			}
 			payload := <-top.Buffer.Flow
-			for _, sub := range top.Subscribers {
+			for _, sub := range top.receivers() {
 				select {
 				case sub.Flow <- payload:
 					// Managed to send item
@@ -220,25 +420,204 @@ func (de *DefaultEngine) DrainTopicsBuffer() {
 	})
 }
 
+// getOrCreateTopic returns the topic, it is created if it does not exist
+func (de *DefaultEngine) getOrCreateTopic(key string) (*Topic, error) {
+	if top, err := de.getTopic(key); !errors.Is(err, ErrNoSuchTopic) {
+		return top, err
+	}
+	top, err := de.NewTopic(key)
+	if errors.Is(err, ErrTopicAlreadyExists) {
+		// Someone else created it in between
+		return de.getTopic(key)
+	}
+	return top, err
+}
+
+// deliveryOf returns the DeliveryMode and timeout used by a topic
+func (de *DefaultEngine) deliveryOf(top *Topic) (DeliveryMode, time.Duration) {
+	top.Lock()
+	defer top.Unlock()
+	mode, timeout := top.Delivery, top.BlockTimeout
+	if mode == DeliveryDefault {
+		mode = de.Delivery
+	}
+	if timeout == 0 {
+		timeout = de.BlockTimeout
+	}
+	return mode, timeout
+}
+
 // Publish is used to publish a payload onto a Topic
 // If there is no Subscribers it will push the Payloads onto a Topic Buffer which will be drained as soon
 // As there is a subscriber
 func (de *DefaultEngine) Publish(key string, payloads ...payload.Payload) []PublishingError {
+	return de.PublishContext(context.Background(), key, payloads...)
+}
+
+// PublishContext is the same as Publish, but when the topic uses DeliveryBlock the context
+// is used to stop waiting for room in the queues
+func (de *DefaultEngine) PublishContext(ctx context.Context, key string, payloads ...payload.Payload) []PublishingError {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	top, err := de.getOrCreateTopic(key)
+	if err != nil {
+		return []PublishingError{{
+			Err:     err,
+			Payload: nil,
+		}}
+	}
+	mode, timeout := de.deliveryOf(top)
+	limiter := de.limiterOf(top)
+	if mode != DeliveryBlock && limiter == nil {
+		return de.publishDrop(top, payloads...)
+	}
+	if mode == DeliveryBlock && timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	var errors []PublishingError
-	var top *Topic
-	if de.TopicExists(key) {
-		topic, err := de.getTopic(key)
-		if err != nil {
-			return append(errors, PublishingError{
-				Err:     err,
-				Payload: nil,
+	for _, payload := range payloads {
+		if _, err := limiter.Wait(ctx, 1); err != nil {
+			errors = append(errors, PublishingError{
+				Err:     contextError(ctx),
+				Payload: payload,
+				Tid:     top.ID,
 			})
+			continue
+		}
+		if mode == DeliveryBlock {
+			errors = append(errors, de.publishBlock(ctx, top, payload)...)
+		} else {
+			errors = append(errors, de.publishDrop(top, payload)...)
 		}
-		top = topic
-	} else {
-		top, _ = de.NewTopic(key)
 	}
+	return errors
+}
+
+// limiterOf returns the rate limit of a topic, nil if it has none
+func (de *DefaultEngine) limiterOf(top *Topic) *ratelimit.Limiter {
+	top.Lock()
+	defer top.Unlock()
+	return top.limiter
+}
 
+// publishBlock will wait until the payload fits into the buffer or all subscriber queues
+// A blocked Publisher keeps the topic locked while waiting on subscribers, the context decides how long
+func (de *DefaultEngine) publishBlock(ctx context.Context, top *Topic, payload payload.Payload) []PublishingError {
+	top.Lock()
+	defer top.Unlock()
+	for len(top.Subscribers) == 0 {
+		select {
+		case top.Buffer.Flow <- payload:
+			return nil
+		default:
+		}
+		// Unlock while waiting so that the buffer can be drained and subscribers can be added
+		top.Unlock()
+		timer := time.NewTimer(BufferRetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			top.Lock()
+			return []PublishingError{{
+				Err:     contextError(ctx),
+				Payload: payload,
+				Tid:     top.ID,
+			}}
+		case <-timer.C:
+		}
+		top.Lock()
+	}
+
+	var errors []PublishingError
+	for _, sub := range top.receivers() {
+		for sub != nil {
+			select {
+			case sub.Flow <- payload:
+				sub = nil
+			case <-sub.done:
+				// The subscriber is being unsubscribed, another member of its group can take the payload instead
+				var member *Pipe
+				if sub.Group != "" {
+					member = top.pickMember(sub.Group)
+				}
+				sub = member
+			case <-ctx.Done():
+				errors = append(errors, PublishingError{
+					Err:     contextError(ctx),
+					Pid:     sub.Pid,
+					Tid:     top.ID,
+					Payload: payload,
+				})
+				sub = nil
+			}
+		}
+	}
+	return errors
+}
+
+// receivers returns the Subscribers that should get the next payload, all Subscribers without a group and one member of each group
+// The topic has to be locked
+func (top *Topic) receivers() []*Pipe {
+	var pipes []*Pipe
+	picked := make(map[string]bool)
+	for _, sub := range top.Subscribers {
+		if sub.Group == "" {
+			pipes = append(pipes, sub)
+			continue
+		}
+		if picked[sub.Group] {
+			continue
+		}
+		picked[sub.Group] = true
+		if member := top.pickMember(sub.Group); member != nil {
+			pipes = append(pipes, member)
+		}
+	}
+	return pipes
+}
+
+// pickMember returns the member of the group with the most room in its queue, members with the same room take turns
+// Members that are being unsubscribed are skipped, nil is returned if there is no member left. The topic has to be locked
+func (top *Topic) pickMember(group string) *Pipe {
+	var members []*Pipe
+	for _, sub := range top.Subscribers {
+		if sub.Group == group && !sub.stopped() {
+			members = append(members, sub)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	if top.turns == nil {
+		top.turns = make(map[string]int)
+	}
+	start := top.turns[group]
+	top.turns[group] = (start + 1) % len(members)
+	var picked *Pipe
+	most := -1
+	for i := range members {
+		member := members[(start+i)%len(members)]
+		if room := cap(member.Flow) - len(member.Flow); room > most {
+			picked, most = member, room
+		}
+	}
+	return picked
+}
+
+// contextError converts a deadline into ErrPublishTimeout
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrPublishTimeout
+	}
+	return ctx.Err()
+}
+
+// publishDrop will push the payloads without waiting, payloads that does not fit are returned as PublishingErrors
+func (de *DefaultEngine) publishDrop(top *Topic, payloads ...payload.Payload) []PublishingError {
+	var errors []PublishingError
 	// If Subscribers is empty, add to Buffer
 	top.Lock()
 	defer top.Unlock()
@@ -257,7 +636,7 @@ func (de *DefaultEngine) Publish(key string, payloads ...payload.Payload) []Publ
 				})
 			}
 		} else {
-			for _, sub := range top.Subscribers {
+			for _, sub := range top.receivers() {
 				select {
 				case sub.Flow <- payload:
 					// Managed to send
@@ -283,11 +662,16 @@ func (de *DefaultEngine) Publish(key string, payloads ...payload.Payload) []Publ
 
 // PublishTopics is used to publish to many topics at once
 func (de *DefaultEngine) PublishTopics(topics []string, payloads ...payload.Payload) []PublishingError {
+	return de.PublishTopicsContext(context.Background(), topics, payloads...)
+}
+
+// PublishTopicsContext is the same as PublishTopics, but the context is used to stop blocking Publishers
+func (de *DefaultEngine) PublishTopicsContext(ctx context.Context, topics []string, payloads ...payload.Payload) []PublishingError {
 	var errors []PublishingError
 
 	for _, topic := range topics {
 		t := topic
-		errs := de.Publish(t, payloads...)
+		errs := de.PublishContext(ctx, t, payloads...)
 		if errs != nil {
 			errors = append(errors, errs...)
 		}
@@ -299,7 +683,11 @@ func (de *DefaultEngine) PublishTopics(topics []string, payloads ...payload.Payl
 	return errors
 }
 
-// Cancel stops the Subscriptions
+// Cancel stops draining the topic buffers in the background
 func (de *DefaultEngine) Cancel() {
-	//Make it stop drainbuffer
+	de.stopOnce.Do(func() {
+		if de.stop != nil {
+			close(de.stop)
+		}
+	})
 }
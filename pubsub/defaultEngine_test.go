@@ -1,11 +1,14 @@
 package pubsub
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/percybolmer/go4data/payload"
+	"github.com/percybolmer/go4data/ratelimit"
 )
 
 func TestWithDefaultEngine(t *testing.T) {
@@ -46,6 +49,58 @@ func TestNewTopic(t *testing.T) {
 	}
 }
 
+func TestNewTopicConcurrent(t *testing.T) {
+	de := &DefaultEngine{
+		Topics: sync.Map{},
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var created []*Topic
+	start := make(chan struct{})
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if top, err := de.NewTopic("contended"); err == nil {
+				mu.Lock()
+				created = append(created, top)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	stored, err := de.getTopic("contended")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0] != stored {
+		t.Fatal("only one of the callers should create the Topic: ", len(created))
+	}
+
+	// Subscribers to a Topic that does not exist yet should all end up in the same Topic
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(pid uint) {
+			defer wg.Done()
+			if _, err := de.Subscribe("contended_subscribe", pid, 1); err != nil {
+				t.Error(err)
+			}
+		}(uint(i))
+	}
+	wg.Wait()
+	top, err := de.getTopic("contended_subscribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	top.Lock()
+	defer top.Unlock()
+	if len(top.Subscribers) != 50 {
+		t.Fatal("subscribers was lost when the Topic was created: ", len(top.Subscribers))
+	}
+}
+
 func TestGetTopic(t *testing.T) {
 	de := &DefaultEngine{
 		Topics: sync.Map{},
@@ -147,6 +202,183 @@ func TestUnsubscribe(t *testing.T) {
 	}
 }
 
+func TestUnsubscribeBlockedPublisher(t *testing.T) {
+	de := &DefaultEngine{Topics: sync.Map{}}
+	if _, err := WithBlockingDelivery(0)(de); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := de.Subscribe("unsubblocked", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The second payload waits forever on the full queue while keeping the topic locked
+	published := make(chan []PublishingError)
+	go func() {
+		published <- de.Publish("unsubblocked", payload.NewBasePayload([]byte(`1`), "test", nil), payload.NewBasePayload([]byte(`2`), "test", nil))
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	unsubscribed := make(chan error)
+	go func() {
+		unsubscribed <- de.Unsubscribe("unsubblocked", 1)
+	}()
+	select {
+	case err := <-unsubscribed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unsubscribing should wake up the blocked publisher")
+	}
+	if errs := <-published; len(errs) != 0 {
+		t.Fatal("payloads to a removed subscriber are not errors: ", errs)
+	}
+}
+
+func TestPatternSubscribe(t *testing.T) {
+	de := &DefaultEngine{Topics: sync.Map{}}
+	if _, err := de.NewTopic("csv.raw.sales"); err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := de.Subscribe("csv.raw.*", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := de.Subscribe("csv.raw.*", 1, 10); !errors.Is(err, ErrPidAlreadyRegistered) {
+		t.Fatal("should not subscribe the same pid twice: ", err)
+	}
+	// The same processor can subscribe to a topic that its pattern matches
+	exact, err := de.Subscribe("csv.raw.sales", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de.TopicExists("csv.raw.*") {
+		t.Fatal("a pattern should not create a topic")
+	}
+
+	// csv.raw.hr is created after the subscription and should still be matched
+	de.Publish("csv.raw.sales", payload.NewBasePayload([]byte(`sales`), "test", nil))
+	de.Publish("csv.raw.hr", payload.NewBasePayload([]byte(`hr`), "test", nil))
+	de.Publish("csv.parsed.hr", payload.NewBasePayload([]byte(`parsed`), "test", nil))
+	if len(pattern.Flow) != 2 || len(exact.Flow) != 1 {
+		t.Fatalf("wrong amount of payloads, pattern got %d and exact got %d", len(pattern.Flow), len(exact.Flow))
+	}
+
+	if err := de.Unsubscribe("csv.other.*", 1); !errors.Is(err, ErrNoSuchTopic) {
+		t.Fatal(err)
+	}
+	if err := de.Unsubscribe("csv.raw.*", 2); !errors.Is(err, ErrNoSuchPid) {
+		t.Fatal(err)
+	}
+	if err := de.Unsubscribe("csv.raw.*", 1); err != nil {
+		t.Fatal(err)
+	}
+	de.Publish("csv.raw.sales", payload.NewBasePayload([]byte(`sales`), "test", nil))
+	if len(exact.Flow) != 2 {
+		t.Fatal("removing the pattern should not remove the exact subscription")
+	}
+	for range pattern.Flow {
+		// The pipe should be closed so this ends after the two payloads
+	}
+	top, err := de.getTopic("csv.raw.hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top.Subscribers) != 0 {
+		t.Fatal("the pattern should be removed from all topics")
+	}
+}
+
+func TestSubscribeGroup(t *testing.T) {
+	de := &DefaultEngine{Topics: sync.Map{}}
+	first, err := de.SubscribeGroup("groups", "workers", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := de.SubscribeGroup("groups", "workers", 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := de.SubscribeGroup("groups", "archive", 3, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broadcast, err := de.Subscribe("groups", 4, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if errs := de.Publish("groups", payload.NewBasePayload([]byte(`work`), "test", nil)); len(errs) != 0 {
+			t.Fatal(errs[0].Err)
+		}
+	}
+	if len(first.Flow) != 5 || len(second.Flow) != 5 {
+		t.Fatalf("the members should take turns, got %d and %d", len(first.Flow), len(second.Flow))
+	}
+	if len(other.Flow) != 10 || len(broadcast.Flow) != 10 {
+		t.Fatalf("each group and subscriber without group should get all payloads, got %d and %d", len(other.Flow), len(broadcast.Flow))
+	}
+
+	// The member with the most room in its queue is picked
+	for i := 0; i < 4; i++ {
+		<-first.Flow
+	}
+	for i := 0; i < 4; i++ {
+		de.Publish("groups", payload.NewBasePayload([]byte(`work`), "test", nil))
+	}
+	if len(first.Flow) != 5 || len(second.Flow) != 5 {
+		t.Fatalf("the least loaded member should get the payloads, got %d and %d", len(first.Flow), len(second.Flow))
+	}
+
+	if _, err := SubscribeGroupTo(&RedisEngine{}, "groups", "workers", 5, 10); !errors.Is(err, ErrGroupsNotSupported) {
+		t.Fatal("should not subscribe with a group on an engine without groups: ", err)
+	}
+}
+
+func TestSubscribeGroupBlocked(t *testing.T) {
+	de := &DefaultEngine{Topics: sync.Map{}}
+	if _, err := WithBlockingDelivery(0)(de); err != nil {
+		t.Fatal(err)
+	}
+	first, err := de.SubscribeGroup("groupblocked", "workers", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := de.SubscribeGroup("groupblocked", "workers", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The third payload waits for the first member, which is unsubscribed
+	published := make(chan []PublishingError)
+	go func() {
+		published <- de.Publish("groupblocked", payload.NewBasePayload([]byte(`1`), "test", nil), payload.NewBasePayload([]byte(`2`), "test", nil), payload.NewBasePayload([]byte(`3`), "test", nil))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// The publisher moves over to the second member and keeps the topic locked until there is room
+	unsubscribed := make(chan error)
+	go func() {
+		unsubscribed <- de.Unsubscribe("groupblocked", 1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if string((<-second.Flow).GetPayload()) != "2" {
+		t.Fatal("the second member should have the second payload")
+	}
+	select {
+	case errs := <-published:
+		if len(errs) != 0 {
+			t.Fatal(errs[0].Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the payload should be given to the second member")
+	}
+	if err := <-unsubscribed; err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Flow) != 1 || len(first.Flow) != 1 {
+		t.Fatal("the second member should have received the payload of the unsubscribed member")
+	}
+}
+
 func TestPublish(t *testing.T) {
 	de := &DefaultEngine{Topics: sync.Map{}}
 	perr := de.Publish("test", nil)
@@ -259,3 +491,166 @@ func TestDrainBuffer(t *testing.T) {
 		t.Fatal("Bad amount of items in SUB2 and 3")
 	}
 }
+
+func TestBlockingDelivery(t *testing.T) {
+	de := &DefaultEngine{
+		Topics: sync.Map{},
+	}
+	if _, err := WithBlockingDelivery(50 * time.Millisecond)(de); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WithBlockingDelivery(time.Second)(nil); !errors.Is(err, ErrNotDefaultEngine) {
+		t.Fatal("should only work on the DefaultEngine: ", err)
+	}
+
+	pipe, err := de.Subscribe("blocking", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty the queue after a while, the publisher should wait for it instead of dropping
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-pipe.Flow
+	}()
+	errs := de.Publish("blocking", payload.NewBasePayload([]byte(`1`), "test", nil), payload.NewBasePayload([]byte(`2`), "test", nil))
+	if len(errs) != 0 {
+		t.Fatal("blocking publish should wait for room: ", errs)
+	}
+
+	// Nobody reads, the timeout should be reached
+	errs = de.Publish("blocking", payload.NewBasePayload([]byte(`3`), "test", nil))
+	if len(errs) != 1 || !errors.Is(errs[0].Err, ErrPublishTimeout) {
+		t.Fatal("expected a timeout: ", errs)
+	}
+
+	// A cancelled context should stop waiting right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs = de.PublishContext(ctx, "blocking", payload.NewBasePayload([]byte(`4`), "test", nil))
+	if len(errs) != 1 || !errors.Is(errs[0].Err, context.Canceled) {
+		t.Fatal("expected a cancelled context: ", errs)
+	}
+
+	// Topics can override the engine
+	if err := de.SetTopicDelivery("dropping", DeliveryDrop, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := de.Subscribe("dropping", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	errs = de.Publish("dropping", payload.NewBasePayload([]byte(`1`), "test", nil), payload.NewBasePayload([]byte(`2`), "test", nil))
+	if len(errs) != 1 || !errors.Is(errs[0].Err, ErrProcessorQueueIsFull) {
+		t.Fatal("the dropping topic should drop: ", errs)
+	}
+}
+
+func TestBlockingDeliveryBuffer(t *testing.T) {
+	de := &DefaultEngine{
+		Topics: sync.Map{},
+	}
+	if err := de.SetTopicDelivery("blockbuffer", DeliveryBlock, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	top, err := de.getTopic("blockbuffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cap(top.Buffer.Flow); i++ {
+		top.Buffer.Flow <- payload.NewBasePayload([]byte(`fill`), "test", nil)
+	}
+	// Add a subscriber and drain the buffer while the publisher waits
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		de.Subscribe("blockbuffer", 1, cap(top.Buffer.Flow)+1)
+		de.DrainTopicsBuffer()
+	}()
+	errs := de.Publish("blockbuffer", payload.NewBasePayload([]byte(`wait`), "test", nil))
+	if len(errs) != 0 {
+		t.Fatal("publisher should have waited for the buffer: ", errs)
+	}
+}
+
+func TestTopicRateLimit(t *testing.T) {
+	de := &DefaultEngine{
+		Topics: sync.Map{},
+	}
+	if err := de.SetTopicRateLimit("limited", -1, 0); !errors.Is(err, ratelimit.ErrBadLimit) {
+		t.Fatal("expected ErrBadLimit: ", err)
+	}
+	if err := de.SetTopicRateLimit("limited", 100, 1); err != nil {
+		t.Fatal(err)
+	}
+	pipe, err := de.Subscribe("limited", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if errs := de.Publish("limited", payload.NewBasePayload([]byte(`1`), "test", nil)); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatal("5 payloads at 100/s with a burst of 1 should take about 40ms, took ", elapsed)
+	}
+	if len(pipe.Flow) != 5 {
+		t.Fatal("all payloads should be delivered, got ", len(pipe.Flow))
+	}
+
+	// A cancelled publisher gives up waiting
+	de.SetTopicRateLimit("limited", 1, 1)
+	de.Publish("limited", payload.NewBasePayload([]byte(`1`), "test", nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs := de.PublishContext(ctx, "limited", payload.NewBasePayload([]byte(`2`), "test", nil))
+	if len(errs) != 1 || !errors.Is(errs[0].Err, context.Canceled) {
+		t.Fatal("expected a cancelled context: ", errs)
+	}
+
+	// A rate of 0 removes the limit
+	de.SetTopicRateLimit("limited", 0, 0)
+	if errs := de.Publish("limited", payload.NewBasePayload([]byte(`3`), "test", nil)); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestWithEngine(t *testing.T) {
+	isolated, err := Dial(WithDefaultEngine(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer isolated.Cancel()
+	if EngineFrom(context.Background()) == isolated {
+		t.Fatal("Dial should not change the selected engine")
+	}
+
+	global, err := Subscribe("isolated_topic", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := isolated.Subscribe("isolated_topic", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithEngine(context.Background(), isolated)
+	if EngineFrom(ctx) != isolated {
+		t.Fatal("the engine in the context should be used")
+	}
+	PublishContext(ctx, "isolated_topic", payload.NewBasePayload([]byte(`local`), "test", nil))
+	PublishTopicsContext(ctx, []string{"isolated_topic"}, payload.NewBasePayload([]byte(`local`), "test", nil))
+
+	if len(global.Flow) != 0 {
+		t.Fatal("payloads published with an engine in the context should not reach the selected engine")
+	}
+	if len(local.Flow) != 2 {
+		t.Fatal("payloads should reach the engine in the context, got ", len(local.Flow))
+	}
+
+	if err := isolated.Unsubscribe("isolated_topic", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-local.Flow; !ok {
+		t.Fatal("payloads in the queue should not be lost when unsubscribing")
+	}
+}
@@ -0,0 +1,78 @@
+package pubsub
+
+import "strings"
+
+// IsPattern returns true if the topic contains any of the wildcards *, ? or [ and should be treated as a pattern
+func IsPattern(topic string) bool {
+	return strings.ContainsAny(topic, "*?[")
+}
+
+// MatchTopic reports if the topic matches the pattern. It uses the same glob style as Redis PSUBSCRIBE
+// * matches any sequence of characters, ? matches any single character, [abc], [a-c] and [^a] matches a set of characters
+// and \ escapes the next character
+func MatchTopic(pattern, topic string) bool {
+	p, t := 0, 0
+	// star is the position of the last * and next is where it should continue matching the topic if we need to backtrack
+	star, next := -1, 0
+	for t < len(topic) {
+		if p < len(pattern) && pattern[p] == '*' {
+			star, next = p, t
+			p++
+			continue
+		}
+		if p < len(pattern) {
+			if end, ok := matchOne(pattern, p, topic[t]); ok {
+				p, t = end, t+1
+				continue
+			}
+		}
+		if star == -1 {
+			return false
+		}
+		// Let the last * swallow one more character and try again
+		next++
+		p, t = star+1, next
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchOne matches a character against the token at p in the pattern, it returns where the next token starts
+func matchOne(pattern string, p int, c byte) (int, bool) {
+	switch pattern[p] {
+	case '?':
+		return p + 1, true
+	case '\\':
+		if p+1 < len(pattern) {
+			return p + 2, pattern[p+1] == c
+		}
+	case '[':
+		end := strings.IndexByte(pattern[p+1:], ']')
+		if end == -1 {
+			// Not a set, treat it as a regular character
+			break
+		}
+		set := pattern[p+1 : p+1+end]
+		negate := strings.HasPrefix(set, "^")
+		if negate {
+			set = set[1:]
+		}
+		matched := false
+		for i := 0; i < len(set); i++ {
+			if i+2 < len(set) && set[i+1] == '-' {
+				if set[i] <= c && c <= set[i+2] {
+					matched = true
+				}
+				i += 2
+				continue
+			}
+			if set[i] == c {
+				matched = true
+			}
+		}
+		return p + end + 2, matched != negate
+	}
+	return p + 1, pattern[p] == c
+}
@@ -0,0 +1,37 @@
+package pubsub
+
+import "testing"
+
+func TestMatchTopic(t *testing.T) {
+	type testCase struct {
+		Pattern  string
+		Topic    string
+		Expected bool
+	}
+	testCases := []testCase{
+		{Pattern: "csv.raw.*", Topic: "csv.raw.sales", Expected: true},
+		{Pattern: "csv.raw.*", Topic: "csv.raw.sales.eu", Expected: true},
+		{Pattern: "csv.raw.*", Topic: "csv.raw.", Expected: true},
+		{Pattern: "csv.raw.*", Topic: "csv.parsed.sales", Expected: false},
+		{Pattern: "*.sales", Topic: "csv.raw.sales", Expected: true},
+		{Pattern: "csv.*.sales", Topic: "csv.raw.hr", Expected: false},
+		{Pattern: "csv.ra?.hr", Topic: "csv.raw.hr", Expected: true},
+		{Pattern: "csv.ra?.hr", Topic: "csv.ra.hr", Expected: false},
+		{Pattern: "csv.[rp]aw", Topic: "csv.paw", Expected: true},
+		{Pattern: "csv.[a-c]aw", Topic: "csv.raw", Expected: false},
+		{Pattern: "csv.[^r]aw", Topic: "csv.raw", Expected: false},
+		{Pattern: "csv.[^r]aw", Topic: "csv.paw", Expected: true},
+		{Pattern: `csv.\*`, Topic: "csv.*", Expected: true},
+		{Pattern: `csv.\*`, Topic: "csv.raw", Expected: false},
+		{Pattern: "csv.[raw", Topic: "csv.[raw", Expected: true},
+		{Pattern: "csv.raw.sales", Topic: "csv.raw.sales", Expected: true},
+	}
+	for _, tc := range testCases {
+		if MatchTopic(tc.Pattern, tc.Topic) != tc.Expected {
+			t.Fatalf("%s matching %s should be %v", tc.Pattern, tc.Topic, tc.Expected)
+		}
+	}
+	if !IsPattern("csv.raw.*") || IsPattern("csv.raw.sales") {
+		t.Fatal("only topics with wildcards are patterns")
+	}
+}
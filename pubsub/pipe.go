@@ -1,12 +1,21 @@
 package pubsub
 
-import "github.com/percybolmer/go4data/payload"
+import (
+	"sync"
+
+	"github.com/percybolmer/go4data/payload"
+)
 
 // Pipe is PUB/SUB output/input Struct used for publishing or Subscribing to data flows
 type Pipe struct {
 	Pid   uint   `json:"pid" yaml:"pid"`
 	Topic string `json:"topic" yaml:"topic"`
+	// Group is the consumer group of the subscription, empty means that all payloads on the topic are received
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
 	Flow  chan payload.Payload
+	// done is closed when the Pipe is being unsubscribed, it wakes up Publishers that are blocked on a full Flow
+	done     chan struct{}
+	doneOnce sync.Once
 }
 
 // NewPipe creates a new data pipe
@@ -15,5 +24,25 @@ func NewPipe(topic string, pid uint, queueSize int) *Pipe {
 		Pid:   pid,
 		Topic: topic,
 		Flow:  make(chan payload.Payload, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// stop marks the Pipe as being unsubscribed
+func (p *Pipe) stop() {
+	p.doneOnce.Do(func() {
+		if p.done != nil {
+			close(p.done)
+		}
+	})
+}
+
+// stopped returns true if the Pipe is being unsubscribed
+func (p *Pipe) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
 	}
 }
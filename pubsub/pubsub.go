@@ -1,6 +1,9 @@
 package pubsub
 
 import (
+	"context"
+	"errors"
+
 	"github.com/percybolmer/go4data/payload"
 )
 
@@ -9,9 +12,52 @@ type Engine interface {
 	Publish(key string, payloads ...payload.Payload) []PublishingError
 	PublishTopics(topics []string, payloads ...payload.Payload) []PublishingError
 	Subscribe(key string, pid uint, queueSize int) (*Pipe, error)
+	Unsubscribe(key string, pid uint) error
 	Cancel()
 }
 
+// GroupSubscriber is implemented by engines that support consumer groups
+// A payload on a topic is given to all Subscribers without a group, and to one member of each group
+type GroupSubscriber interface {
+	SubscribeGroup(key, group string, pid uint, queueSize int) (*Pipe, error)
+}
+
+// Acknowledger is implemented by engines that needs to know when a payload has been handled
+// Ack is used after the Handler succeeds and Nack when it has failed, so the Engine can deliver the payload again later
+// Nack returns false if the Engine has given up on the payload, it is then given to the FailureHandler and Acked after that
+type Acknowledger interface {
+	Ack(p payload.Payload) error
+	Nack(p payload.Payload) (bool, error)
+}
+
+// ErrGroupsNotSupported is when subscribing with a consumer group on an Engine that does not implement GroupSubscriber
+var ErrGroupsNotSupported = errors.New("the engine does not support consumer groups")
+
+// ContextPublisher is implemented by engines that can use a context to stop Publishers that are waiting on full queues
+type ContextPublisher interface {
+	PublishContext(ctx context.Context, key string, payloads ...payload.Payload) []PublishingError
+	PublishTopicsContext(ctx context.Context, topics []string, payloads ...payload.Payload) []PublishingError
+}
+
+// engineKey is the context key used to store an Engine
+type engineKey struct{}
+
+// WithEngine returns a context that makes PublishContext and PublishTopicsContext use the Engine
+// instead of the one selected with NewEngine
+func WithEngine(ctx context.Context, e Engine) context.Context {
+	return context.WithValue(ctx, engineKey{}, e)
+}
+
+// EngineFrom returns the Engine in the context, or the currently selected Engine if there is none
+func EngineFrom(ctx context.Context) Engine {
+	if ctx != nil {
+		if e, ok := ctx.Value(engineKey{}).(Engine); ok && e != nil {
+			return e
+		}
+	}
+	return engine
+}
+
 // DialOptions are used to configure with variable amount of Options
 type DialOptions func(Engine) (Engine, error)
 
@@ -24,7 +70,19 @@ func init() {
 }
 
 // NewEngine is used to startup a new Engine based on the Options used
+// The Engine becomes the one used by the package level functions such as Publish and Subscribe
 func NewEngine(opts ...DialOptions) (Engine, error) {
+	e, err := Dial(opts...)
+	if err != nil {
+		return nil, err
+	}
+	engine = e
+	return e, nil
+}
+
+// Dial is used to startup a new Engine based on the Options used without selecting it
+// Use it together with WithEngine, or a go4data.Environment, to run isolated flows
+func Dial(opts ...DialOptions) (Engine, error) {
 	var e Engine
 	// ForEach Option passed in run the configuration
 	for _, opt := range opts {
@@ -44,6 +102,31 @@ func Subscribe(key string, pid uint, queueSize int) (*Pipe, error) {
 	return engine.Subscribe(key, pid, queueSize)
 }
 
+// SubscribeGroup will use the currently selected Pub/Sub engine
+// And subscribe to a topic as a member of a consumer group
+func SubscribeGroup(key, group string, pid uint, queueSize int) (*Pipe, error) {
+	return SubscribeGroupTo(engine, key, group, pid, queueSize)
+}
+
+// SubscribeGroupTo subscribes to a topic on the Engine as a member of a consumer group
+// An empty group is a regular Subscribe, so the payloads are broadcasted
+func SubscribeGroupTo(e Engine, key, group string, pid uint, queueSize int) (*Pipe, error) {
+	if group == "" {
+		return e.Subscribe(key, pid, queueSize)
+	}
+	gs, ok := e.(GroupSubscriber)
+	if !ok {
+		return nil, ErrGroupsNotSupported
+	}
+	return gs.SubscribeGroup(key, group, pid, queueSize)
+}
+
+// Unsubscribe will use the currently selected Pub/Sub engine
+// And remove the subscription of a processor on a topic
+func Unsubscribe(key string, pid uint) error {
+	return engine.Unsubscribe(key, pid)
+}
+
 // Publish is used to publish payloads onto the currently selected Pub/Sub engine
 func Publish(key string, payloads ...payload.Payload) []PublishingError {
 	return engine.Publish(key, payloads...)
@@ -53,3 +136,23 @@ func Publish(key string, payloads ...payload.Payload) []PublishingError {
 func PublishTopics(topics []string, payloads ...payload.Payload) []PublishingError {
 	return engine.PublishTopics(topics, payloads...)
 }
+
+// PublishContext is used to publish payloads onto the Engine in the context, or the currently selected Pub/Sub engine
+// Engines that block Publishers stop waiting when the context is done
+func PublishContext(ctx context.Context, key string, payloads ...payload.Payload) []PublishingError {
+	e := EngineFrom(ctx)
+	if cp, ok := e.(ContextPublisher); ok {
+		return cp.PublishContext(ctx, key, payloads...)
+	}
+	return e.Publish(key, payloads...)
+}
+
+// PublishTopicsContext will push payloads onto many Topics
+// Engines that block Publishers stop waiting when the context is done
+func PublishTopicsContext(ctx context.Context, topics []string, payloads ...payload.Payload) []PublishingError {
+	e := EngineFrom(ctx)
+	if cp, ok := e.(ContextPublisher); ok {
+		return cp.PublishTopicsContext(ctx, topics, payloads...)
+	}
+	return e.PublishTopics(topics, payloads...)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/percybolmer/go4data/payload"
@@ -15,7 +16,9 @@ import (
 type RedisEngine struct {
 	Options *redis.Options
 	Client  *redis.Client
-	cancel  context.CancelFunc
+	// subscriptions is the cancel func of each subscription, by topic and pid
+	subscriptions map[string]map[uint]context.CancelFunc
+	sync.Mutex
 }
 
 var (
@@ -28,69 +31,128 @@ var (
 // WithRedisEngine will configure the Pub/Sub to use Redis instead
 func WithRedisEngine(opts *redis.Options) DialOptions {
 	return func(e Engine) (Engine, error) {
-		re := &RedisEngine{}
-		// Connect to Redis
-		client := redis.NewClient(opts)
-		// Ping to make sure connection works
-		err := client.Ping(context.Background()).Err()
-		if err != nil {
-			return nil, err
-		}
-		re.Client = client
-		engine = re
-		return re, nil
+		return NewRedisEngine(opts)
 	}
 }
 
-// Cancel stops the Subscriptions
+// NewRedisEngine connects to Redis and returns a RedisEngine using that connection
+func NewRedisEngine(opts *redis.Options) (*RedisEngine, error) {
+	re := &RedisEngine{
+		Options:       opts,
+		subscriptions: make(map[string]map[uint]context.CancelFunc),
+	}
+	// Connect to Redis
+	client := redis.NewClient(opts)
+	// Ping to make sure connection works
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		return nil, err
+	}
+	re.Client = client
+	return re, nil
+}
+
+// Cancel stops all Subscriptions
 func (re *RedisEngine) Cancel() {
-	re.cancel()
+	re.Lock()
+	defer re.Unlock()
+	for key, pids := range re.subscriptions {
+		for _, cancel := range pids {
+			cancel()
+		}
+		delete(re.subscriptions, key)
+	}
+}
+
+// Unsubscribe stops the Subscription of a processor on a Redis channel
+// The Flow of the Pipe is closed once the Subscription has been closed
+func (re *RedisEngine) Unsubscribe(key string, pid uint) error {
+	re.Lock()
+	defer re.Unlock()
+	pids, ok := re.subscriptions[key]
+	if !ok {
+		return ErrNoSuchTopic
+	}
+	cancel, ok := pids[pid]
+	if !ok {
+		return ErrNoSuchPid
+	}
+	cancel()
+	delete(pids, pid)
+	if len(pids) == 0 {
+		delete(re.subscriptions, key)
+	}
+	return nil
 }
 
 // Subscribe will subscribe to a certain Redis channel
+// Keys containing wildcards are subscribed to with PSUBSCRIBE, see IsPattern
 func (re *RedisEngine) Subscribe(key string, pid uint, queueSize int) (*Pipe, error) {
 	if re.Client == nil {
 		return nil, ErrNoRedisClientConfigured
 	}
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	re.cancel = cancel
-	subscription := re.Client.Subscribe(ctx, key)
+	re.Lock()
+	defer re.Unlock()
+	if _, ok := re.subscriptions[key][pid]; ok {
+		return nil, ErrPidAlreadyRegistered
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var subscription *redis.PubSub
+	if IsPattern(key) {
+		subscription = re.Client.PSubscribe(ctx, key)
+	} else {
+		subscription = re.Client.Subscribe(ctx, key)
+	}
 	if subscription == nil {
+		cancel()
 		return nil, ErrRedisSubscriptionIsNil
 	}
 
 	// Force wakeup
 	if _, err := subscription.Receive(ctx); err != nil {
+		cancel()
+		subscription.Close()
 		return nil, err
 	}
+	if re.subscriptions == nil {
+		re.subscriptions = make(map[string]map[uint]context.CancelFunc)
+	}
+	if re.subscriptions[key] == nil {
+		re.subscriptions[key] = make(map[uint]context.CancelFunc)
+	}
+	re.subscriptions[key][pid] = cancel
 	// Grab the Channel that we will use for our Pipe
 	channel := subscription.ChannelSize(queueSize)
 
 	// This needs some trick to it, Channel will return a []byte, but we want Payloads
 	// Best solution I can come up with is a Goroutine that transfers from one channel to another..
-	// This isn't optimal, since we need to force BasePayload...
 	// Maybe Another refactor is needed in the future
 	// Where Instead of returnning a Pipe we return a Chan interface
-	pipe := &Pipe{
-		Flow:  make(chan payload.Payload, queueSize),
-		Topic: key,
-	}
+	pipe := NewPipe(key, pid, queueSize)
 	go func() {
+		// The goroutine is the only one sending on the Flow, so it closes it once the subscription is torn down
+		defer close(pipe.Flow)
+		defer subscription.Close()
 		for {
 			select {
 			case msg := <-channel:
-				bp := &payload.BasePayload{}
-
-				err := bp.UnmarshalBinary([]byte(msg.Payload))
+				// select picks at random if the subscription was cancelled at the same time, so check before forwarding
+				if ctx.Err() != nil {
+					return
+				}
+				// The Envelope tells which Payload type to rebuild
+				pay, err := payload.Unmarshal([]byte(msg.Payload))
 				if err != nil {
 					// Bad Payloads? Send Errors as Payloads?.... Add ErrorHandler to Engine?
 					fmt.Println(err.Error())
 				} else {
-					pipe.Flow <- bp
+					select {
+					case pipe.Flow <- pay:
+					case <-ctx.Done():
+						return
+					}
 				}
 			case <-ctx.Done():
-				subscription.Close()
 				return
 			}
 		}
@@ -99,7 +161,7 @@ func (re *RedisEngine) Subscribe(key string, pid uint, queueSize int) (*Pipe, er
 
 }
 
-// Publish will push payloads onto the Redis topic
+// Publish will push payloads onto the Redis topic, each Payload is wrapped in a payload.Envelope so its type has to be Registered
 func (re *RedisEngine) Publish(key string, payloads ...payload.Payload) []PublishingError {
 	var errors []PublishingError
 	if re.Client == nil {
@@ -109,7 +171,7 @@ func (re *RedisEngine) Publish(key string, payloads ...payload.Payload) []Publis
 		return errors
 	}
 	for _, pay := range payloads {
-		data, err := pay.MarshalBinary()
+		data, err := payload.Marshal(pay)
 		if err != nil {
 			errors = append(errors, PublishingError{
 				Err:     err,
@@ -1,9 +1,11 @@
 package pubsub
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/percybolmer/go4data/payload"
 )
@@ -76,3 +78,116 @@ func TestRedisPublishTopics(t *testing.T) {
 	}
 
 }
+
+func TestRedisUnsubscribe(t *testing.T) {
+	re, err := NewRedisEngine(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "",
+		DB:       0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := re.Subscribe("redisunsub", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := re.Subscribe("redisunsub", 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := re.Subscribe("redisunsub", 2, 10); !errors.Is(err, ErrPidAlreadyRegistered) {
+		t.Fatal("should not subscribe the same pid twice: ", err)
+	}
+	if err := re.Unsubscribe("nosuchtopic", 1); !errors.Is(err, ErrNoSuchTopic) {
+		t.Fatal(err)
+	}
+	if err := re.Unsubscribe("redisunsub", 3); !errors.Is(err, ErrNoSuchPid) {
+		t.Fatal(err)
+	}
+	if err := re.Unsubscribe("redisunsub", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	re.Publish("redisunsub", payload.NewBasePayload([]byte(`only for the second`), "test", nil))
+	time.Sleep(1 * time.Second)
+	if len(first.Flow) != 0 || len(second.Flow) != 1 {
+		t.Fatalf("only the remaining subscription should get payloads, got %d and %d", len(first.Flow), len(second.Flow))
+	}
+	select {
+	case _, ok := <-first.Flow:
+		if ok {
+			t.Fatal("the unsubscribed pipe should not get payloads")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the Flow of an unsubscribed pipe should be closed")
+	}
+
+	// Cancel should stop all subscriptions, not only the last one
+	third, err := re.Subscribe("redisunsub_other", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re.Cancel()
+	re.PublishTopics([]string{"redisunsub", "redisunsub_other"}, payload.NewBasePayload([]byte(`nobody`), "test", nil))
+	time.Sleep(1 * time.Second)
+	if len(second.Flow) != 1 || len(third.Flow) != 0 {
+		t.Fatalf("cancelled subscriptions should not get payloads, got %d and %d", len(second.Flow), len(third.Flow))
+	}
+	if err := re.Unsubscribe("redisunsub", 2); !errors.Is(err, ErrNoSuchTopic) {
+		t.Fatal("cancelled subscriptions should be removed: ", err)
+	}
+}
+
+func TestRedisPatternSubscribe(t *testing.T) {
+	re, err := NewRedisEngine(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "",
+		DB:       0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer re.Cancel()
+
+	pipe, err := re.Subscribe("redispattern.raw.*", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re.PublishTopics([]string{"redispattern.raw.sales", "redispattern.raw.hr", "redispattern.parsed.hr"}, payload.NewBasePayload([]byte(`hi`), "test", nil))
+	time.Sleep(1 * time.Second)
+	if len(pipe.Flow) != 2 {
+		t.Fatalf("the pattern should match two of the topics, got %d", len(pipe.Flow))
+	}
+	if err := re.Unsubscribe("redispattern.raw.*", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisPayloadTypes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re, err := NewRedisEngine(&redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer re.Cancel()
+
+	pipe, err := re.Subscribe("redis_csv", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := re.Publish("redis_csv", payload.NewCsvPayload("id,name", "1,percy", ",", nil)); len(errs) != 0 {
+		t.Fatal(errs[0].Err)
+	}
+	csv, ok := receive(t, pipe).(*payload.CsvPayload)
+	if !ok {
+		t.Fatal("the CsvPayload was not rebuilt")
+	}
+	if csv.Header != "id,name" || csv.Delimiter != "," {
+		t.Fatal("the CsvPayload lost its fields: ", csv)
+	}
+	if errs := re.Publish("redis_csv", &payload.NetworkPayload{}); len(errs) != 1 || !errors.Is(errs[0].Err, payload.ErrPayloadNotRegistered) {
+		t.Fatal("should not publish Payloads that are not Registered")
+	}
+}
@@ -0,0 +1,589 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/percybolmer/go4data/payload"
+)
+
+// RedisStreamsEngine uses Redis Streams instead of Redis Pub/Sub
+// Each topic is a stream that payloads are added to with XADD, and subscribers read them with XREADGROUP.
+// Payloads published while nobody is subscribed are kept in the stream and delivered when a subscriber joins.
+// A payload is only acknowledged with XACK when it has been handled, see Acknowledger, and entries that has been
+// pending for too long, forexample because they failed or the consumer crashed, are claimed and delivered again.
+type RedisStreamsEngine struct {
+	Options *redis.Options
+	Client  *redis.Client
+	// Consumer is the name of this node in the consumer groups, the pid of the subscriber is added to it. Defaults to the hostname and process id
+	// Keep the same name between restarts to get the entries that was pending before the restart right away instead of waiting for them to be claimed
+	Consumer string
+	// MaxLen trims the streams to about this many entries when publishing, 0 keeps all entries
+	MaxLen int64
+	// ClaimMinIdle is how long an entry can be pending without being acknowledged before it is claimed and delivered again
+	ClaimMinIdle time.Duration
+	// ClaimInterval is how often each subscription looks for entries to claim
+	ClaimInterval time.Duration
+	// MaxDeliveries is how many times an entry is delivered before it is given up on, 0 means no limit
+	// A failed payload is only given to the FailureHandler on its last delivery, so with no limit it is never given up on
+	MaxDeliveries int64
+	// DeadLetter is the stream that entries are moved to when they reach MaxDeliveries without being given to a FailureHandler,
+	// forexample because the consumer crashed while handling their last delivery. The entries are added with the stream, group and ID they came from
+	// An empty DeadLetter leaves them pending so that they can be found with XPENDING
+	DeadLetter string
+	// ReadBlock is the longest time each XREADGROUP waits for new entries
+	ReadBlock time.Duration
+
+	// subscriptions is the subscriptions by topic and pid
+	subscriptions map[string]map[uint]*streamSubscription
+	// delivered is the entries that has been delivered but not acknowledged, by stream, group and ID
+	// They are not claimed while they are being handled
+	delivered map[string]*streamEntry
+	sync.Mutex
+}
+
+// streamSubscription is a subscriber reading a stream as a consumer in a group
+type streamSubscription struct {
+	stream   string
+	group    string
+	consumer string
+	pipe     *Pipe
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// streamEntry is a delivered entry that is waiting to be acknowledged
+type streamEntry struct {
+	sub *streamSubscription
+	id  string
+}
+
+// key returns the key of an entry of the subscription in the delivered map
+func (sub *streamSubscription) key(id string) string {
+	return sub.stream + "\x00" + sub.group + "\x00" + id
+}
+
+var (
+	//ErrNotRedisStreamsEngine is when trying to configure RedisStreamsEngine settings on another engine
+	ErrNotRedisStreamsEngine = errors.New("the option can only be used on the RedisStreamsEngine")
+	//ErrPatternsNotSupported is when subscribing to a pattern on an Engine that cannot match topics
+	ErrPatternsNotSupported = errors.New("the engine does not support pattern subscriptions")
+
+	// streamPayloadField is the field in the stream entries that holds the payload
+	streamPayloadField = "payload"
+	// streamClaimCount is how many pending entries are looked at each time entries are claimed, besides the ones being handled
+	streamClaimCount int64 = 100
+	// streamDeadLetter is the default DeadLetter stream
+	streamDeadLetter = "go4data_dead_letter"
+	// StreamEntryProperty is the name of the metadata property that tells which stream entry a payload was delivered from
+	// It is used to find the entry when the payload is acknowledged
+	StreamEntryProperty = "stream_entry"
+)
+
+// WithRedisStreamsEngine will configure the Pub/Sub to use Redis Streams
+func WithRedisStreamsEngine(opts *redis.Options) DialOptions {
+	return func(e Engine) (Engine, error) {
+		return NewRedisStreamsEngine(opts)
+	}
+}
+
+// WithClaimPending is a DialOption that changes how pending entries are claimed by the RedisStreamsEngine
+// Entries pending longer than minIdle are claimed, it is checked each interval, and entries delivered maxDeliveries times are given up on
+// It has to be used after WithRedisStreamsEngine
+func WithClaimPending(minIdle, interval time.Duration, maxDeliveries int64) DialOptions {
+	return func(e Engine) (Engine, error) {
+		re, ok := e.(*RedisStreamsEngine)
+		if !ok {
+			return nil, ErrNotRedisStreamsEngine
+		}
+		re.ClaimMinIdle = minIdle
+		re.ClaimInterval = interval
+		re.MaxDeliveries = maxDeliveries
+		return re, nil
+	}
+}
+
+// WithDeadLetter is a DialOption that changes the stream the RedisStreamsEngine moves entries that reaches MaxDeliveries to
+// It has to be used after WithRedisStreamsEngine
+func WithDeadLetter(stream string) DialOptions {
+	return func(e Engine) (Engine, error) {
+		re, ok := e.(*RedisStreamsEngine)
+		if !ok {
+			return nil, ErrNotRedisStreamsEngine
+		}
+		re.DeadLetter = stream
+		return re, nil
+	}
+}
+
+// NewRedisStreamsEngine connects to Redis and returns a RedisStreamsEngine using that connection
+func NewRedisStreamsEngine(opts *redis.Options) (*RedisStreamsEngine, error) {
+	hostname, _ := os.Hostname()
+	re := &RedisStreamsEngine{
+		Options:       opts,
+		Consumer:      fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ClaimMinIdle:  30 * time.Second,
+		ClaimInterval: 5 * time.Second,
+		MaxDeliveries: 5,
+		DeadLetter:    streamDeadLetter,
+		ReadBlock:     time.Second,
+		subscriptions: make(map[string]map[uint]*streamSubscription),
+		delivered:     make(map[string]*streamEntry),
+	}
+	client := redis.NewClient(opts)
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		return nil, err
+	}
+	re.Client = client
+	return re, nil
+}
+
+// Subscribe will read the stream of the topic in a consumer group of its own
+// The group is named after the pid, so the same processor running on many nodes shares the entries
+func (re *RedisStreamsEngine) Subscribe(key string, pid uint, queueSize int) (*Pipe, error) {
+	return re.subscribe(key, "", fmt.Sprintf("pid-%d", pid), pid, queueSize)
+}
+
+// SubscribeGroup will read the stream of the topic as a member of the consumer group
+// Each entry is only delivered to one of the members, on this node or any other
+func (re *RedisStreamsEngine) SubscribeGroup(key, group string, pid uint, queueSize int) (*Pipe, error) {
+	return re.subscribe(key, group, group, pid, queueSize)
+}
+
+// subscribe creates the consumer group if needed and starts reading the stream into a Pipe
+func (re *RedisStreamsEngine) subscribe(key, group, streamGroup string, pid uint, queueSize int) (*Pipe, error) {
+	if re.Client == nil {
+		return nil, ErrNoRedisClientConfigured
+	}
+	if IsPattern(key) {
+		return nil, ErrPatternsNotSupported
+	}
+	re.Lock()
+	defer re.Unlock()
+	if _, ok := re.subscriptions[key][pid]; ok {
+		return nil, ErrPidAlreadyRegistered
+	}
+	// A new group starts at the beginning of the stream so payloads published before anyone subscribed are delivered
+	err := re.Client.XGroupCreateMkStream(context.Background(), key, streamGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &streamSubscription{
+		stream:   key,
+		group:    streamGroup,
+		consumer: fmt.Sprintf("%s-%d", re.Consumer, pid),
+		pipe:     NewPipe(key, pid, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	sub.pipe.Group = group
+	if re.subscriptions == nil {
+		re.subscriptions = make(map[string]map[uint]*streamSubscription)
+	}
+	if re.subscriptions[key] == nil {
+		re.subscriptions[key] = make(map[uint]*streamSubscription)
+	}
+	re.subscriptions[key][pid] = sub
+
+	count := int64(queueSize)
+	if count < 1 {
+		count = 1
+	}
+	go re.consume(sub, count)
+	return sub.pipe, nil
+}
+
+// consume reads the entries of a subscription into its Pipe until it is unsubscribed
+// Entries that was delivered to the consumer earlier but never acknowledged are read first
+// The Pipe is closed when it returns
+func (re *RedisStreamsEngine) consume(sub *streamSubscription, count int64) {
+	defer close(sub.pipe.Flow)
+	defer re.forget(sub)
+	claim := time.NewTicker(re.ClaimInterval)
+	defer claim.Stop()
+	last := "0"
+	for sub.ctx.Err() == nil {
+		select {
+		case <-claim.C:
+			if !re.claim(sub) {
+				return
+			}
+		default:
+		}
+		streams, err := re.Client.XReadGroup(sub.ctx, &redis.XReadGroupArgs{
+			Group:    sub.group,
+			Consumer: sub.consumer,
+			Streams:  []string{sub.stream, last},
+			Count:    count,
+			Block:    re.ReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if sub.ctx.Err() != nil {
+				return
+			}
+			// Bad connection? Send Errors as Payloads?.... Add ErrorHandler to Engine?
+			fmt.Println(err.Error())
+			select {
+			case <-time.After(re.ReadBlock):
+			case <-sub.ctx.Done():
+			}
+			continue
+		}
+		var messages []redis.XMessage
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+		if last != ">" {
+			// Keep reading the old entries until there is none left, then switch over to new entries
+			if len(messages) == 0 {
+				last = ">"
+			} else {
+				last = messages[len(messages)-1].ID
+			}
+		}
+		for _, msg := range messages {
+			if !re.deliver(sub, msg) {
+				return
+			}
+		}
+	}
+}
+
+// claim takes over the entries in the group that has been pending longer than ClaimMinIdle and delivers them again
+// Entries that are being handled by this engine are left alone. It returns false if the subscription is stopped
+func (re *RedisStreamsEngine) claim(sub *streamSubscription) bool {
+	re.Lock()
+	count := streamClaimCount
+	for _, entry := range re.delivered {
+		if entry.sub.stream == sub.stream && entry.sub.group == sub.group {
+			count++
+		}
+	}
+	re.Unlock()
+	pending, err := re.Client.XPendingExt(sub.ctx, &redis.XPendingExtArgs{
+		Stream: sub.stream,
+		Group:  sub.group,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil {
+		return sub.ctx.Err() == nil
+	}
+	var ids []string
+	for _, entry := range pending {
+		if entry.Idle < re.ClaimMinIdle || re.isInflight(sub, entry.ID) {
+			continue
+		}
+		if re.MaxDeliveries > 0 && entry.RetryCount >= re.MaxDeliveries {
+			// The entry has been delivered too many times without reaching a FailureHandler, give up on it
+			if re.DeadLetter == "" {
+				continue
+			}
+			if err := re.deadLetter(sub, entry); err != nil {
+				if sub.ctx.Err() != nil {
+					return false
+				}
+				fmt.Println(err.Error())
+			}
+			continue
+		}
+		ids = append(ids, entry.ID)
+	}
+	if len(ids) == 0 {
+		return true
+	}
+	messages, err := re.Client.XClaim(sub.ctx, &redis.XClaimArgs{
+		Stream:   sub.stream,
+		Group:    sub.group,
+		Consumer: sub.consumer,
+		MinIdle:  re.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return sub.ctx.Err() == nil
+	}
+	for _, msg := range messages {
+		if !re.deliver(sub, msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// deadLetter adds a pending entry to the DeadLetter stream and acknowledges it
+// If it fails the entry stays pending and is tried again the next time entries are claimed
+func (re *RedisStreamsEngine) deadLetter(sub *streamSubscription, entry redis.XPendingExt) error {
+	values := map[string]interface{}{
+		"stream":     sub.stream,
+		"group":      sub.group,
+		"id":         entry.ID,
+		"deliveries": entry.RetryCount,
+	}
+	// The entry might have been trimmed away by MaxLen, it is still moved so that it is not lost without a trace
+	messages, err := re.Client.XRangeN(sub.ctx, sub.stream, entry.ID, entry.ID, 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(messages) == 1 {
+		values[streamPayloadField] = messages[0].Values[streamPayloadField]
+	}
+	err = re.Client.XAdd(sub.ctx, &redis.XAddArgs{
+		Stream: re.DeadLetter,
+		Values: values,
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return re.Client.XAck(sub.ctx, sub.stream, sub.group, entry.ID).Err()
+}
+
+// deliver decodes an entry and sends it on the Pipe of the subscription, it returns false if the subscription is stopped
+func (re *RedisStreamsEngine) deliver(sub *streamSubscription, msg redis.XMessage) bool {
+	data, _ := msg.Values[streamPayloadField].(string)
+	pay, err := payload.Unmarshal([]byte(data))
+	if err != nil {
+		// The entry can never be handled, acknowledge it so it is not claimed over and over
+		fmt.Println(err.Error())
+		re.Client.XAck(sub.ctx, sub.stream, sub.group, msg.ID)
+		return true
+	}
+	meta := pay.GetMetaData()
+	if meta == nil {
+		// There is nowhere to keep the entry, so it cannot be acknowledged later. Acknowledge it now so it is not delivered over and over
+		re.Client.XAck(sub.ctx, sub.stream, sub.group, msg.ID)
+		return re.send(sub, pay)
+	}
+	key := sub.key(msg.ID)
+	if meta.GetProperty(StreamEntryProperty) == nil {
+		meta.AddProperty(StreamEntryProperty, "the stream entry the payload was delivered from", false)
+	}
+	meta.SetProperty(StreamEntryProperty, key)
+	re.Lock()
+	if sub.ctx.Err() != nil {
+		re.Unlock()
+		return false
+	}
+	re.delivered[key] = &streamEntry{sub: sub, id: msg.ID}
+	re.Unlock()
+
+	if !re.send(sub, pay) {
+		re.release(pay)
+		return false
+	}
+	return true
+}
+
+// send puts the payload on the Pipe of the subscription, it returns false if the subscription is stopped first
+func (re *RedisStreamsEngine) send(sub *streamSubscription, pay payload.Payload) bool {
+
+	select {
+	case sub.pipe.Flow <- pay:
+		return true
+	case <-sub.ctx.Done():
+		return false
+	}
+}
+
+// isInflight returns true if the entry is delivered by this engine and not yet acknowledged
+func (re *RedisStreamsEngine) isInflight(sub *streamSubscription, id string) bool {
+	re.Lock()
+	defer re.Unlock()
+	_, ok := re.delivered[sub.key(id)]
+	return ok
+}
+
+// entryKey returns the key of the entry a payload was delivered from, and false if it was not delivered by the engine
+func entryKey(p payload.Payload) (string, bool) {
+	if p == nil || p.GetMetaData() == nil {
+		return "", false
+	}
+	prop := p.GetMetaData().GetProperty(StreamEntryProperty)
+	if prop == nil {
+		return "", false
+	}
+	key, ok := prop.Value.(string)
+	return key, ok
+}
+
+// parseEntryKey splits the key of an entry into the stream, group and ID of the entry
+func parseEntryKey(key string) (stream, group, id string, ok bool) {
+	parts := strings.SplitN(key, "\x00", 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// release stops tracking the entry of a payload and returns it, nil if the payload is not tracked
+func (re *RedisStreamsEngine) release(p payload.Payload) *streamEntry {
+	key, ok := entryKey(p)
+	if !ok {
+		return nil
+	}
+	re.Lock()
+	defer re.Unlock()
+	entry, ok := re.delivered[key]
+	if !ok {
+		return nil
+	}
+	delete(re.delivered, key)
+	return entry
+}
+
+// forget stops tracking all entries of a subscription, they stay pending and are claimed by another consumer
+func (re *RedisStreamsEngine) forget(sub *streamSubscription) {
+	re.Lock()
+	defer re.Unlock()
+	for key, entry := range re.delivered {
+		if entry.sub == sub {
+			delete(re.delivered, key)
+		}
+	}
+}
+
+// Ack acknowledges the entry of a handled payload with XACK, payloads that was not delivered by the engine are ignored
+// The entry is found from the payload, so payloads that was left in the Pipe after Unsubscribe can still be acknowledged
+func (re *RedisStreamsEngine) Ack(p payload.Payload) error {
+	key, ok := entryKey(p)
+	if !ok {
+		return nil
+	}
+	stream, group, id, ok := parseEntryKey(key)
+	if !ok {
+		return nil
+	}
+	re.release(p)
+	return re.Client.XAck(context.Background(), stream, group, id).Err()
+}
+
+// Nack releases the entry of a payload that could not be handled
+// It stays pending and is claimed and delivered again when it has been idle for ClaimMinIdle
+// If the entry has been delivered MaxDeliveries times false is returned, the entry is then kept until it is Acked
+func (re *RedisStreamsEngine) Nack(p payload.Payload) (bool, error) {
+	key, ok := entryKey(p)
+	if !ok {
+		return false, nil
+	}
+	stream, group, id, ok := parseEntryKey(key)
+	if !ok {
+		return false, nil
+	}
+	if re.MaxDeliveries > 0 {
+		pending, err := re.Client.XPendingExt(context.Background(), &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  group,
+			Start:  id,
+			End:    id,
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return false, err
+		}
+		if len(pending) == 0 || pending[0].RetryCount >= re.MaxDeliveries {
+			return false, nil
+		}
+	}
+	re.release(p)
+	return true, nil
+}
+
+// Unsubscribe stops reading the stream for a processor, entries that it has not acknowledged are claimed by other consumers
+// The Pipe is closed when the reading has stopped, payloads that are left in it can still be read and acknowledged
+func (re *RedisStreamsEngine) Unsubscribe(key string, pid uint) error {
+	re.Lock()
+	pids, ok := re.subscriptions[key]
+	if !ok {
+		re.Unlock()
+		return ErrNoSuchTopic
+	}
+	sub, ok := pids[pid]
+	if !ok {
+		re.Unlock()
+		return ErrNoSuchPid
+	}
+	sub.cancel()
+	delete(pids, pid)
+	if len(pids) == 0 {
+		delete(re.subscriptions, key)
+	}
+	re.Unlock()
+	re.forget(sub)
+	return nil
+}
+
+// Cancel stops all Subscriptions
+func (re *RedisStreamsEngine) Cancel() {
+	re.Lock()
+	var subs []*streamSubscription
+	for key, pids := range re.subscriptions {
+		for _, sub := range pids {
+			sub.cancel()
+			subs = append(subs, sub)
+		}
+		delete(re.subscriptions, key)
+	}
+	re.Unlock()
+	for _, sub := range subs {
+		re.forget(sub)
+	}
+}
+
+// Publish will add the payloads to the stream of the topic, each Payload is wrapped in a payload.Envelope so its type has to be Registered
+func (re *RedisStreamsEngine) Publish(key string, payloads ...payload.Payload) []PublishingError {
+	var errors []PublishingError
+	if re.Client == nil {
+		errors := append(errors, PublishingError{
+			Err: ErrNoRedisClientConfigured,
+		})
+		return errors
+	}
+	for _, pay := range payloads {
+		data, err := payload.Marshal(pay)
+		if err != nil {
+			errors = append(errors, PublishingError{
+				Err:     err,
+				Payload: pay,
+			})
+			continue
+		}
+		err = re.Client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream:       key,
+			MaxLenApprox: re.MaxLen,
+			Values:       map[string]interface{}{streamPayloadField: data},
+		}).Err()
+		if err != nil {
+			errors = append(errors, PublishingError{
+				Err:     err,
+				Payload: pay,
+			})
+		}
+	}
+	return errors
+}
+
+// PublishTopics is used to publish to many topics at the same time
+func (re *RedisStreamsEngine) PublishTopics(topics []string, payloads ...payload.Payload) []PublishingError {
+	var errors []PublishingError
+	for _, topic := range topics {
+		errs := re.Publish(topic, payloads...)
+		if errs != nil {
+			errors = append(errors, errs...)
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	}
+	return errors
+}
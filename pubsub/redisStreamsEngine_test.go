@@ -0,0 +1,324 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/percybolmer/go4data/payload"
+)
+
+// newStreamsEngine starts an in-process Redis and connects a RedisStreamsEngine to it
+func newStreamsEngine(t *testing.T, mr *miniredis.Miniredis, consumer string) *RedisStreamsEngine {
+	e, err := Dial(WithRedisStreamsEngine(&redis.Options{Addr: mr.Addr()}), WithClaimPending(200*time.Millisecond, 50*time.Millisecond, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := e.(*RedisStreamsEngine)
+	re.Consumer = consumer
+	re.ReadBlock = 50 * time.Millisecond
+	return re
+}
+
+// receive waits for a payload on the pipe
+func receive(t *testing.T, pipe *Pipe) payload.Payload {
+	select {
+	case p := <-pipe.Flow:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("no payload was received on ", pipe.Topic)
+	}
+	return nil
+}
+
+// pendingCount returns how many entries that has not been acknowledged in the group
+func pendingCount(t *testing.T, re *RedisStreamsEngine, stream, group string) int64 {
+	pending, err := re.Client.XPending(context.Background(), stream, group).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending.Count
+}
+
+func TestWithClaimPending(t *testing.T) {
+	if _, err := Dial(WithDefaultEngine(2), WithClaimPending(time.Second, time.Second, 0)); !errors.Is(err, ErrNotRedisStreamsEngine) {
+		t.Fatal("should only configure the streams engine: ", err)
+	}
+	if _, err := Dial(WithDefaultEngine(2), WithDeadLetter("dead")); !errors.Is(err, ErrNotRedisStreamsEngine) {
+		t.Fatal("should only configure the streams engine: ", err)
+	}
+}
+
+func TestRedisStreamsPublishBeforeSubscribe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re := newStreamsEngine(t, mr, "node")
+	defer re.Cancel()
+
+	if errs := re.Publish("streams_early", payload.NewBasePayload([]byte(`early`), "test", nil)); len(errs) != 0 {
+		t.Fatal(errs[0].Err)
+	}
+	pipe, err := re.Subscribe("streams_early", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := re.Subscribe("streams_early", 1, 10); !errors.Is(err, ErrPidAlreadyRegistered) {
+		t.Fatal("should not subscribe the same pid twice: ", err)
+	}
+	if _, err := re.Subscribe("streams.*", 2, 10); !errors.Is(err, ErrPatternsNotSupported) {
+		t.Fatal("patterns should not be supported: ", err)
+	}
+	if string(receive(t, pipe).GetPayload()) != "early" {
+		t.Fatal("wrong payload")
+	}
+	if err := re.Unsubscribe("streams_early", 2); !errors.Is(err, ErrNoSuchPid) {
+		t.Fatal(err)
+	}
+	if err := re.Unsubscribe("streams_nosuchtopic", 1); !errors.Is(err, ErrNoSuchTopic) {
+		t.Fatal(err)
+	}
+	if err := re.Unsubscribe("streams_early", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisStreamsGroups(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re := newStreamsEngine(t, mr, "node")
+	defer re.Cancel()
+
+	first, err := re.SubscribeGroup("streams_groups", "workers", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := re.SubscribeGroup("streams_groups", "workers", 2, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := re.Subscribe("streams_groups", 3, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		re.Publish("streams_groups", payload.NewBasePayload([]byte(`work`), "test", nil))
+	}
+	for i := 0; i < 10; i++ {
+		re.Ack(receive(t, all))
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(first.Flow)+len(second.Flow) != 10 {
+		t.Fatalf("each payload should go to one member, got %d and %d", len(first.Flow), len(second.Flow))
+	}
+	if pendingCount(t, re, "streams_groups", "pid-3") != 0 || pendingCount(t, re, "streams_groups", "workers") != 10 {
+		t.Fatal("only acknowledged payloads should be removed from pending")
+	}
+}
+
+func TestRedisStreamsClaim(t *testing.T) {
+	mr := miniredis.RunT(t)
+	crashed := newStreamsEngine(t, mr, "crashed")
+	survivor := newStreamsEngine(t, mr, "survivor")
+	defer survivor.Cancel()
+
+	lost, err := crashed.SubscribeGroup("streams_claim", "workers", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.Publish("streams_claim", payload.NewBasePayload([]byte(`claim me`), "test", nil))
+	receive(t, lost)
+	// The consumer dies without acknowledging the payload
+	crashed.Cancel()
+
+	pipe, err := survivor.SubscribeGroup("streams_claim", "workers", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed := receive(t, pipe)
+	if string(claimed.GetPayload()) != "claim me" {
+		t.Fatal("wrong payload claimed")
+	}
+
+	// A failed payload is delivered again, until MaxDeliveries is reached
+	if again, err := survivor.Nack(claimed); err != nil || !again {
+		t.Fatal("the payload should be delivered again: ", err)
+	}
+	retried := receive(t, pipe)
+	if again, err := survivor.Nack(retried); err != nil || again {
+		t.Fatal("the payload should be given up on after 3 deliveries: ", err)
+	}
+	// The entry is kept until the failure has been handled and the payload Acked
+	time.Sleep(500 * time.Millisecond)
+	if len(pipe.Flow) != 0 || pendingCount(t, survivor, "streams_claim", "workers") != 1 {
+		t.Fatal("a payload that is given up on should not be claimed before it is Acked")
+	}
+	if err := survivor.Ack(retried); err != nil {
+		t.Fatal(err)
+	}
+	if pendingCount(t, survivor, "streams_claim", "workers") != 0 {
+		t.Fatal("the payload that was given up on should be acknowledged")
+	}
+
+	// Acknowledged payloads are not claimed
+	survivor.Publish("streams_claim", payload.NewBasePayload([]byte(`done`), "test", nil))
+	if err := survivor.Ack(receive(t, pipe)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if len(pipe.Flow) != 0 || pendingCount(t, survivor, "streams_claim", "workers") != 0 {
+		t.Fatal("an acknowledged payload should not be delivered again")
+	}
+}
+
+func TestRedisStreamsDeadLetter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	crashed := newStreamsEngine(t, mr, "crashed")
+	survivor := newStreamsEngine(t, mr, "survivor")
+	survivor.DeadLetter = "streams_dead"
+	defer survivor.Cancel()
+
+	lost, err := crashed.SubscribeGroup("streams_deadletter", "workers", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.Publish("streams_deadletter", payload.NewBasePayload([]byte(`poison`), "test", nil))
+	key, _ := entryKey(receive(t, lost))
+	_, _, id, _ := parseEntryKey(key)
+	crashed.Cancel()
+	// The entry keeps crashing its consumers until it has been delivered MaxDeliveries times
+	for i := 0; i < 2; i++ {
+		err := crashed.Client.XClaim(context.Background(), &redis.XClaimArgs{
+			Stream:   "streams_deadletter",
+			Group:    "workers",
+			Consumer: "crashed-1",
+			Messages: []string{id},
+		}).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pipe, err := survivor.SubscribeGroup("streams_deadletter", "workers", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pendingCount(t, survivor, "streams_deadletter", "workers") != 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(pipe.Flow) != 0 || pendingCount(t, survivor, "streams_deadletter", "workers") != 0 {
+		t.Fatal("the entry should have been given up on without being delivered")
+	}
+	dead, err := survivor.Client.XRange(context.Background(), "streams_dead", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Values["id"] != id || dead[0].Values["stream"] != "streams_deadletter" || dead[0].Values["group"] != "workers" {
+		t.Fatal("the entry should have been moved to the dead letter stream: ", dead)
+	}
+	data, _ := dead[0].Values[streamPayloadField].(string)
+	pay, err := payload.Unmarshal([]byte(data))
+	if err != nil || string(pay.GetPayload()) != "poison" {
+		t.Fatal("the dead letter should keep the payload: ", err)
+	}
+}
+
+func TestRedisStreamsUnsubscribeClosesPipe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re := newStreamsEngine(t, mr, "node")
+	defer re.Cancel()
+
+	pipe, err := re.Subscribe("streams_unsubscribe", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re.Publish("streams_unsubscribe", payload.NewBasePayload([]byte(`left`), "test", nil), payload.NewBasePayload([]byte(`behind`), "test", nil))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pipe.Flow) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := re.Unsubscribe("streams_unsubscribe", 1); err != nil {
+		t.Fatal(err)
+	}
+	// The payloads left in the Pipe can still be read and acknowledged, and then the Pipe is closed
+	for i := 0; i < 2; i++ {
+		if err := re.Ack(receive(t, pipe)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case _, ok := <-pipe.Flow:
+		if ok {
+			t.Fatal("no more payloads should be delivered after Unsubscribe")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the pipe should be closed after Unsubscribe")
+	}
+	if pendingCount(t, re, "streams_unsubscribe", "pid-1") != 0 {
+		t.Fatal("payloads read after Unsubscribe should be acknowledged")
+	}
+}
+
+func TestRedisStreamsPayloadTypes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re := newStreamsEngine(t, mr, "node")
+	defer re.Cancel()
+
+	if errs := re.Publish("streams_csv", payload.NewCsvPayload("id,name", "1,percy", ",", nil)); len(errs) != 0 {
+		t.Fatal(errs[0].Err)
+	}
+	pipe, err := re.Subscribe("streams_csv", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pay := receive(t, pipe)
+	csv, ok := pay.(*payload.CsvPayload)
+	if !ok {
+		t.Fatal("the CsvPayload was not rebuilt")
+	}
+	if csv.Header != "id,name" || csv.Delimiter != "," {
+		t.Fatal("the CsvPayload lost its fields: ", csv)
+	}
+	if err := re.Ack(pay); err != nil {
+		t.Fatal(err)
+	}
+	if pendingCount(t, re, "streams_csv", "pid-1") != 0 {
+		t.Fatal("the CsvPayload was not acknowledged")
+	}
+}
+
+// partsPayload is a Payload that cannot be compared, since it is a struct with a slice in it
+type partsPayload struct {
+	*payload.BasePayload
+	Parts []string
+}
+
+func init() {
+	payload.Register("partsPayload", func() payload.Payload { return partsPayload{BasePayload: &payload.BasePayload{}} })
+}
+
+func TestRedisStreamsUncomparablePayload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	re := newStreamsEngine(t, mr, "node")
+	defer re.Cancel()
+
+	pipe, err := re.Subscribe("streams_parts", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := partsPayload{BasePayload: payload.NewBasePayload([]byte(`a,b`), "test", nil), Parts: []string{"a", "b"}}
+	if errs := re.Publish("streams_parts", parts); len(errs) != 0 {
+		t.Fatal(errs[0].Err)
+	}
+	pay := receive(t, pipe)
+	if _, ok := pay.(partsPayload); !ok {
+		t.Fatalf("the partsPayload was not rebuilt: %T", pay)
+	}
+	if err := re.Ack(pay); err != nil {
+		t.Fatal(err)
+	}
+	if pendingCount(t, re, "streams_parts", "pid-1") != 0 {
+		t.Fatal("the partsPayload was not acknowledged")
+	}
+}
@@ -0,0 +1,101 @@
+// Package ratelimit is used to limit how many payloads per second that processors handle and topics deliver
+// It is a token bucket, tokens are added at a fixed rate up to the burst size and each payload takes one token
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	//ErrBadLimit is thrown when the rate or burst is negative
+	ErrBadLimit = errors.New("the rate limit and burst cannot be negative")
+)
+
+// Limiter is a token bucket that is safe to share between goroutines
+type Limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// now is used to get the current time, replaced in tests
+	now func() time.Time
+	sync.Mutex
+}
+
+// New creates a Limiter that allows rate payloads per second, with bursts of up to burst payloads
+// A burst of 0 defaults to the rate rounded up, but never less than 1
+// The Limiter starts full so the first burst is allowed right away
+func New(rate float64, burst int) (*Limiter, error) {
+	if rate < 0 || burst < 0 {
+		return nil, ErrBadLimit
+	}
+	b := float64(burst)
+	if b == 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		now:    time.Now,
+	}, nil
+}
+
+// Rate returns the amount of payloads per second that are allowed
+func (l *Limiter) Rate() float64 {
+	return l.rate
+}
+
+// Burst returns the amount of payloads that are allowed at once
+func (l *Limiter) Burst() int {
+	return int(l.burst)
+}
+
+// reserve takes n tokens and returns how long to wait before they can be used
+// The tokens are taken right away, so concurrent callers waits in line
+func (l *Limiter) reserve(n int) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel gives back n tokens that was reserved but not used
+func (l *Limiter) cancel(n int) {
+	l.Lock()
+	l.tokens = math.Min(l.burst, l.tokens+float64(n))
+	l.Unlock()
+}
+
+// Wait blocks until n payloads are allowed, or until the context is done
+// It returns how long it waited, a rate of 0 means no limit and never waits
+func (l *Limiter) Wait(ctx context.Context, n int) (time.Duration, error) {
+	if l == nil || l.rate == 0 || n <= 0 {
+		return 0, nil
+	}
+	delay := l.reserve(n)
+	if delay == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		l.cancel(n)
+		return 0, ctx.Err()
+	}
+}
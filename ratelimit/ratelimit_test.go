@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	type testCase struct {
+		Name          string
+		Rate          float64
+		Burst         int
+		ExpectedBurst int
+		ExpectedErr   error
+	}
+
+	testCases := []testCase{
+		{Name: "Burst", Rate: 10, Burst: 5, ExpectedBurst: 5},
+		{Name: "DefaultBurst", Rate: 10, ExpectedBurst: 10},
+		{Name: "SlowDefaultBurst", Rate: 0.5, ExpectedBurst: 1},
+		{Name: "NegativeRate", Rate: -1, ExpectedErr: ErrBadLimit},
+		{Name: "NegativeBurst", Rate: 1, Burst: -1, ExpectedErr: ErrBadLimit},
+	}
+
+	for _, tc := range testCases {
+		l, err := New(tc.Rate, tc.Burst)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+		if err == nil && l.Burst() != tc.ExpectedBurst {
+			t.Fatalf("%s: expected burst %d, got %d", tc.Name, tc.ExpectedBurst, l.Burst())
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	l, _ := New(10, 2)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	if l.reserve(1) != 0 || l.reserve(1) != 0 {
+		t.Fatal("the burst should be allowed right away")
+	}
+	if delay := l.reserve(1); delay != 100*time.Millisecond {
+		t.Fatal("expected to wait for one token, got ", delay)
+	}
+	if delay := l.reserve(1); delay != 200*time.Millisecond {
+		t.Fatal("callers should wait in line, got ", delay)
+	}
+	now = now.Add(time.Hour)
+	if l.reserve(2) != 0 {
+		t.Fatal("the tokens should be refilled up to the burst")
+	}
+	if l.reserve(1) == 0 {
+		t.Fatal("the tokens should never be more than the burst")
+	}
+}
+
+func TestWait(t *testing.T) {
+	var unlimited *Limiter
+	if waited, err := unlimited.Wait(context.Background(), 10); waited != 0 || err != nil {
+		t.Fatal("a nil Limiter should never wait")
+	}
+
+	l, _ := New(100, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := l.Wait(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatal("5 payloads at 100/s with a burst of 1 should take about 40ms, took ", elapsed)
+	}
+
+	slow, _ := New(1, 1)
+	slow.Wait(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := slow.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the context error, got ", err)
+	}
+}
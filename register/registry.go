@@ -0,0 +1,50 @@
+package register
+
+import (
+	"sync"
+
+	"github.com/percybolmer/go4data/handlers"
+)
+
+// Registry is a set of Handlers that a processor can use, kept apart from the HandlerRegister
+// It is used to give isolated flows their own Handlers
+type Registry struct {
+	handlers map[string]func() handlers.Handler
+	sync.RWMutex
+}
+
+// NewRegistry creates a Registry that starts with all Handlers currently in the HandlerRegister
+func NewRegistry() *Registry {
+	r := &Registry{
+		handlers: make(map[string]func() handlers.Handler, len(HandlerRegister)),
+	}
+	for name, f := range HandlerRegister {
+		r.handlers[name] = f
+	}
+	return r
+}
+
+// Register is used to register an Handler in the Registry. If a Handler with that name already exists it will return an ErrHandlerAlreadyRegistered
+func (r *Registry) Register(name string, f func() handlers.Handler) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.handlers == nil {
+		r.handlers = make(map[string]func() handlers.Handler)
+	}
+	if _, ok := r.handlers[name]; ok {
+		return ErrHandlerAlreadyRegistered
+	}
+	r.handlers[name] = f
+	return nil
+}
+
+// GetHandler is used to extract a Handler from the Registry, returns a NEW Copy of the Handler
+func (r *Registry) GetHandler(name string) (handlers.Handler, error) {
+	r.RLock()
+	f, ok := r.handlers[name]
+	r.RUnlock()
+	if !ok {
+		return nil, ErrHandlerNotRegistered
+	}
+	return f(), nil
+}
@@ -0,0 +1,55 @@
+package register
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/percybolmer/go4data/handlers"
+)
+
+func TestRegistry(t *testing.T) {
+	HandlerRegister = make(map[string]func() handlers.Handler)
+	if err := Register("globalprinter", NewTestHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	if _, err := r.GetHandler("globalprinter"); err != nil {
+		t.Fatal("the Registry should start with the globally Registered Handlers: ", err)
+	}
+
+	if err := r.Register("localprinter", NewTestHandler); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("localprinter", NewTestHandler); !errors.Is(err, ErrHandlerAlreadyRegistered) {
+		t.Fatalf("Expected ErrHandlerAlreadyRegistered, not this: %v", err)
+	}
+	if _, err := GetHandler("localprinter"); !errors.Is(err, ErrHandlerNotRegistered) {
+		t.Fatal("a Handler Registered in a Registry should not leak into the HandlerRegister")
+	}
+
+	// Handlers Registered globally after the Registry is created should not show up in it
+	if err := Register("lateprinter", NewTestHandler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetHandler("lateprinter"); !errors.Is(err, ErrHandlerNotRegistered) {
+		t.Fatalf("Expected ErrHandlerNotRegistered, not this: %v", err)
+	}
+
+	first, err := r.GetHandler("localprinter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := r.GetHandler("localprinter")
+	if first == second {
+		t.Fatal("the Registry should return a new copy of the Handler each time")
+	}
+
+	empty := &Registry{}
+	if _, err := empty.GetHandler("globalprinter"); !errors.Is(err, ErrHandlerNotRegistered) {
+		t.Fatalf("Expected ErrHandlerNotRegistered, not this: %v", err)
+	}
+	if err := empty.Register("printer", NewTestHandler); err != nil {
+		t.Fatal(err)
+	}
+}
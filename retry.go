@@ -0,0 +1,151 @@
+package go4data
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrBadRetryPolicy is when a RetryPolicy has values that cannot be used
+	ErrBadRetryPolicy = errors.New("the retry policy is not valid, attempts and backoffs cannot be negative, jitter has to be between 0 and 1 and maxbackoff cannot be lower than initialbackoff")
+
+	// DefaultBackoffMultiplier is how much the backoff grows for each attempt if no Multiplier is set
+	DefaultBackoffMultiplier = 2.0
+)
+
+// attemptKey is the context key used to store the attempt a processor is on
+type attemptKey struct{}
+
+// RetryPolicy decides if a payload that failed in Handler.Handle should be handled again, and how long to wait before doing so
+// After the last attempt the payload is sent to the FailureHandler
+type RetryPolicy struct {
+	// MaxAttempts is the total amount of times a payload is handled, including the first one. 0 or 1 means no retries
+	MaxAttempts int `json:"maxattempts" yaml:"maxattempts"`
+	// InitialBackoff is how long to wait before the first retry
+	InitialBackoff time.Duration `json:"initialbackoff" yaml:"initialbackoff"`
+	// MaxBackoff is the longest time to wait between two attempts, 0 means no limit
+	MaxBackoff time.Duration `json:"maxbackoff" yaml:"maxbackoff"`
+	// Multiplier is how much the backoff grows each attempt, defaults to DefaultBackoffMultiplier
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+	// Jitter is a fraction between 0 and 1 of the backoff that is randomized, used to avoid retrying in lockstep
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+	// RetryOn is a list of strings, an error is only retried if its message contains one of them
+	// An empty list means that all errors are retried
+	RetryOn []string `json:"retryon" yaml:"retryon"`
+}
+
+// permanentError is an error that should never be retried
+type permanentError struct {
+	err error
+}
+
+// Error is used to be part of error interface
+func (pe *permanentError) Error() string {
+	return pe.err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (pe *permanentError) Unwrap() error {
+	return pe.err
+}
+
+// Permanent wraps an error so that it is never retried, Handlers can use it to report errors that will not go away by retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent returns true if the error has been wrapped with Permanent
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// Validate is used to make sure the policy can be used
+func (rp *RetryPolicy) Validate() error {
+	if rp.MaxAttempts < 0 || rp.InitialBackoff < 0 || rp.MaxBackoff < 0 || rp.Multiplier < 0 {
+		return ErrBadRetryPolicy
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return ErrBadRetryPolicy
+	}
+	if rp.MaxBackoff != 0 && rp.MaxBackoff < rp.InitialBackoff {
+		return ErrBadRetryPolicy
+	}
+	return nil
+}
+
+// IsRetryable returns true if the error should be retried
+func (rp *RetryPolicy) IsRetryable(err error) bool {
+	if isPermanent(err) {
+		return false
+	}
+	if len(rp.RetryOn) == 0 {
+		return true
+	}
+	for _, match := range rp.RetryOn {
+		if strings.Contains(err.Error(), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait after the given attempt failed, attempt starts at 1
+func (rp *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultBackoffMultiplier
+	}
+	backoff := float64(rp.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if math.IsNaN(backoff) {
+		// Many attempts makes the multiplier +Inf, and 0 * +Inf is NaN
+		backoff = 0
+	}
+	if rp.Jitter != 0 {
+		// Spread the backoff evenly between -jitter and +jitter
+		backoff = backoff * (1 - rp.Jitter + 2*rp.Jitter*rand.Float64())
+	}
+	if rp.MaxBackoff != 0 && backoff > float64(rp.MaxBackoff) {
+		backoff = float64(rp.MaxBackoff)
+	}
+	// Converting a float that does not fit in a Duration is undefined, so clamp it to the longest Duration
+	if backoff >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(backoff)
+}
+
+// wait will sleep for the backoff of an attempt, returns false if ctx was cancelled while waiting
+func (rp *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(rp.Backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// withAttempt returns a context that tells the Handler what attempt it is on
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// Attempt returns what attempt the processor is on, starting at 1, when it called the Handler with ctx
+// It is kept in the context and not in the payload since the same payload can be handled by many processors at the same time
+func Attempt(ctx context.Context) int {
+	if ctx != nil {
+		if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+			return attempt
+		}
+	}
+	return 1
+}
@@ -0,0 +1,85 @@
+package go4data
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Policy      RetryPolicy
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Empty", Policy: RetryPolicy{}},
+		{Name: "Full", Policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5}},
+		{Name: "NegativeAttempts", Policy: RetryPolicy{MaxAttempts: -1}, ExpectedErr: ErrBadRetryPolicy},
+		{Name: "NegativeBackoff", Policy: RetryPolicy{InitialBackoff: -time.Second}, ExpectedErr: ErrBadRetryPolicy},
+		{Name: "MaxLowerThanInitial", Policy: RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Millisecond}, ExpectedErr: ErrBadRetryPolicy},
+		{Name: "BadJitter", Policy: RetryPolicy{Jitter: 1.5}, ExpectedErr: ErrBadRetryPolicy},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.Policy.Validate(); !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	rp := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, exp := range expected {
+		if got := rp.Backoff(i + 1); got != exp {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, exp, got)
+		}
+	}
+
+	rp.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		got := rp.Backoff(1)
+		if got < 80*time.Millisecond || got > 120*time.Millisecond {
+			t.Fatal("jitter is outside the allowed range: ", got)
+		}
+	}
+	// The jitter should not push the backoff past MaxBackoff
+	for i := 0; i < 100; i++ {
+		if got := rp.Backoff(10); got > time.Second || got < 800*time.Millisecond {
+			t.Fatal("the jittered backoff should be clamped to MaxBackoff: ", got)
+		}
+	}
+	// Without a MaxBackoff many attempts should not overflow
+	unlimited := &RetryPolicy{InitialBackoff: time.Second}
+	if got := unlimited.Backoff(1100); got != time.Duration(math.MaxInt64) {
+		t.Fatal("the backoff should be clamped to the longest duration: ", got)
+	}
+	unlimited.Jitter = 0.5
+	if got := unlimited.Backoff(64); got <= 0 {
+		t.Fatal("the backoff overflowed: ", got)
+	}
+	if got := (&RetryPolicy{}).Backoff(2000); got != 0 {
+		t.Fatal("no InitialBackoff should not wait: ", got)
+	}
+}
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	all := &RetryPolicy{}
+	if !all.IsRetryable(errors.New("anything")) {
+		t.Fatal("an empty RetryOn should retry all errors")
+	}
+	if all.IsRetryable(Permanent(errors.New("anything"))) {
+		t.Fatal("permanent errors should never be retried")
+	}
+
+	some := &RetryPolicy{RetryOn: []string{"connection refused", "timeout"}}
+	if !some.IsRetryable(errors.New("dial tcp: connection refused")) {
+		t.Fatal("connection refused should be retried")
+	}
+	if some.IsRetryable(errors.New("bad input")) {
+		t.Fatal("bad input should not be retried")
+	}
+}
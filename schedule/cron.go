@@ -0,0 +1,199 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrBadCronExpression is thrown when a cron expression cannot be parsed
+	ErrBadCronExpression = errors.New("the cron expression is not valid, expected 5 fields: minute hour day-of-month month day-of-week")
+	//ErrCronNeverMatches is thrown when a cron expression has no upcomming execution time
+	ErrCronNeverMatches = errors.New("the cron expression does not match any time")
+)
+
+// descriptors is the shorthands that can be used instead of the 5 fields
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// bounds is the allowed range of a cron field
+type bounds struct {
+	min, max uint
+}
+
+var (
+	minuteBounds = bounds{0, 59}
+	hourBounds   = bounds{0, 23}
+	domBounds    = bounds{1, 31}
+	monthBounds  = bounds{1, 12}
+	// Both 0 and 7 is sunday, 7 is folded into 0 when parsing
+	dowBounds = bounds{0, 7}
+)
+
+// Cron is a parsed cron expression
+// Each field is stored as a bitset where bit N is set if the value N is allowed
+type Cron struct {
+	// Expression is the expression that was parsed
+	Expression string
+	minute     uint64
+	hour       uint64
+	dom        uint64
+	month      uint64
+	dow        uint64
+	// domStar and dowStar is used to know if day-of-month and day-of-week is restricted
+	// If both are restricted a time matches if any of them matches, just like regular cron
+	domStar bool
+	dowStar bool
+}
+
+// ParseCron will parse a standard 5 field cron expression
+// minute hour day-of-month month day-of-week
+// Each field supports *, lists (1,2), ranges (1-5) and steps (*/5, 1-30/2)
+// The descriptors @yearly, @monthly, @weekly, @daily, @midnight and @hourly are also supported
+func ParseCron(expression string) (*Cron, error) {
+	expr := strings.TrimSpace(expression)
+	if desc, ok := descriptors[expr]; ok {
+		expr = desc
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%s: %w", expression, ErrBadCronExpression)
+	}
+	c := &Cron{
+		Expression: expression,
+		domStar:    fields[2] == "*" || fields[2] == "?",
+		dowStar:    fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if c.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+	// Sunday can be both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+		c.dow &^= 1 << 7
+	}
+	return c, nil
+}
+
+// parseField parses a single comma separated cron field into a bitset
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart := part
+		var step uint = 1
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("%s: %w", field, ErrBadCronExpression)
+			}
+			step = uint(s)
+			rangePart = part[:i]
+		}
+
+		var start, end uint
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			start, end = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			limits := strings.SplitN(rangePart, "-", 2)
+			s, err := parseValue(limits[0], b)
+			if err != nil {
+				return 0, err
+			}
+			e, err := parseValue(limits[1], b)
+			if err != nil {
+				return 0, err
+			}
+			start, end = s, e
+		default:
+			v, err := parseValue(rangePart, b)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			// A step on a single value means from that value up to max
+			if step > 1 {
+				end = b.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("%s: %w", field, ErrBadCronExpression)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a single number and makes sure its inside the bounds
+func parseValue(value string, b bounds) (uint, error) {
+	v, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("%s: %w", value, ErrBadCronExpression)
+	}
+	return uint(v), nil
+}
+
+// Next returns the next time after t that matches the cron expression
+// The returned time is always truncated to the minute
+// If no time is found within 5 years a zero time is returned
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	loc := t.Location()
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches checks day-of-month and day-of-week the same way cron does
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
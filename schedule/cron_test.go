@@ -0,0 +1,73 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Expression  string
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "EveryMinute", Expression: "* * * * *"},
+		{Name: "Steps", Expression: "*/15 1-5/2 * * *"},
+		{Name: "Lists", Expression: "0,30 8,17 1,15 * 1-5"},
+		{Name: "SundayAsSeven", Expression: "0 0 * * 7"},
+		{Name: "Descriptor", Expression: "@hourly"},
+		{Name: "TooFewFields", Expression: "* * * *", ExpectedErr: ErrBadCronExpression},
+		{Name: "OutOfRange", Expression: "60 * * * *", ExpectedErr: ErrBadCronExpression},
+		{Name: "BadStep", Expression: "*/0 * * * *", ExpectedErr: ErrBadCronExpression},
+		{Name: "ReversedRange", Expression: "0 5-1 * * *", ExpectedErr: ErrBadCronExpression},
+		{Name: "NotANumber", Expression: "a * * * *", ExpectedErr: ErrBadCronExpression},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseCron(tc.Expression)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	type testCase struct {
+		Name       string
+		Expression string
+		From       time.Time
+		Expected   time.Time
+	}
+	// 2021-01-04 is a monday
+	testCases := []testCase{
+		{Name: "EveryMinute", Expression: "* * * * *", From: time.Date(2021, 1, 4, 10, 0, 30, 0, time.UTC), Expected: time.Date(2021, 1, 4, 10, 1, 0, 0, time.UTC)},
+		{Name: "EveryFifteen", Expression: "*/15 * * * *", From: time.Date(2021, 1, 4, 10, 16, 0, 0, time.UTC), Expected: time.Date(2021, 1, 4, 10, 30, 0, 0, time.UTC)},
+		{Name: "NextDay", Expression: "0 8 * * *", From: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Expected: time.Date(2021, 1, 5, 8, 0, 0, 0, time.UTC)},
+		{Name: "Weekend", Expression: "0 0 * * 6", From: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Expected: time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC)},
+		{Name: "NextYear", Expression: "@yearly", From: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Expected: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "DomOrDow", Expression: "0 0 15 * 5", From: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Expected: time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{Name: "LeapDay", Expression: "0 0 29 2 *", From: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		c, err := ParseCron(tc.Expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := c.Next(tc.From)
+		if !next.Equal(tc.Expected) {
+			t.Fatalf("%s: expected %s, got %s", tc.Name, tc.Expected, next)
+		}
+	}
+
+	never, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !never.Next(time.Now()).IsZero() {
+		t.Fatal("the 31st of february should never match")
+	}
+}
@@ -0,0 +1,147 @@
+// Package schedule is used to decide when subscriptionless processors should execute their Handler
+// A schedule is either a fixed interval or a cron expression, optionally limited to a run window
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	//ErrIntervalAndCron is thrown when both an interval and a cron expression is configured
+	ErrIntervalAndCron = errors.New("cannot use both an execution interval and a cron expression, pick one")
+	//ErrNegativeInterval is thrown when the interval is below zero
+	ErrNegativeInterval = errors.New("the execution interval cannot be negative")
+	//ErrBadWindow is thrown when a run window has a start or end that is not in the 15:04 format
+	ErrBadWindow = errors.New("the run window start and end has to be in the format HH:MM")
+)
+
+// Window is a daily time window that executions are allowed to run in, Start and End are in the format HH:MM
+// If End is before Start the window wraps around midnight, so 22:00 - 06:00 is a nightly window
+type Window struct {
+	Start string `json:"start" yaml:"start"`
+	End   string `json:"end" yaml:"end"`
+
+	start int
+	end   int
+}
+
+// Schedule is used to calculate when the next execution should be
+type Schedule struct {
+	// Interval is the time between two executions
+	Interval time.Duration
+	// Cron is the parsed cron expression, nil if Interval is used
+	Cron *Cron
+	// Window limits executions to a certain time of day, nil means always
+	Window *Window
+}
+
+// New will create a Schedule, only one of interval or cronExpr can be set
+// window is optional and can be nil
+func New(interval time.Duration, cronExpr string, window *Window) (*Schedule, error) {
+	if interval < 0 {
+		return nil, ErrNegativeInterval
+	}
+	if interval != 0 && cronExpr != "" {
+		return nil, ErrIntervalAndCron
+	}
+	s := &Schedule{
+		Interval: interval,
+	}
+	if cronExpr != "" {
+		c, err := ParseCron(cronExpr)
+		if err != nil {
+			return nil, err
+		}
+		if c.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("%s: %w", cronExpr, ErrCronNeverMatches)
+		}
+		s.Cron = c
+	}
+	if window != nil {
+		if err := window.parse(); err != nil {
+			return nil, err
+		}
+		s.Window = window
+	}
+	return s, nil
+}
+
+// First returns the time of the first execution
+// Interval schedules are executed right away if inside the window, cron schedules waits for the next match
+func (s *Schedule) First(now time.Time) time.Time {
+	if s.Cron != nil {
+		return s.Next(now)
+	}
+	if s.Window != nil {
+		return s.Window.NextOpen(now)
+	}
+	return now
+}
+
+// Next returns the time of the next execution after now
+func (s *Schedule) Next(now time.Time) time.Time {
+	if s.Cron == nil {
+		next := now.Add(s.Interval)
+		if s.Window != nil {
+			return s.Window.NextOpen(next)
+		}
+		return next
+	}
+	next := s.Cron.Next(now)
+	if s.Window == nil {
+		return next
+	}
+	// Look for a cron match that is also inside the window, a year of matches is plenty
+	for i := 0; i < 525600 && !next.IsZero(); i++ {
+		if s.Window.Contains(next) {
+			return next
+		}
+		// Skip ahead to the window opening to avoid walking every minute
+		open := s.Window.NextOpen(next)
+		next = s.Cron.Next(open.Add(-time.Minute))
+	}
+	return time.Time{}
+}
+
+// parse will convert Start and End into minutes of the day
+func (w *Window) parse() error {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return fmt.Errorf("%s: %w", w.Start, ErrBadWindow)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return fmt.Errorf("%s: %w", w.End, ErrBadWindow)
+	}
+	w.start = start.Hour()*60 + start.Minute()
+	w.end = end.Hour()*60 + end.Minute()
+	return nil
+}
+
+// Contains returns true if t is inside the window
+// A window with the same Start and End is open the whole day
+func (w *Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case w.start == w.end:
+		return true
+	case w.start < w.end:
+		return m >= w.start && m < w.end
+	default:
+		return m >= w.start || m < w.end
+	}
+}
+
+// NextOpen returns t if its inside the window, otherwise the next time the window opens
+func (w *Window) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	open := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !open.After(t) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open
+}
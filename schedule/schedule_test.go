@@ -0,0 +1,99 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	type testCase struct {
+		Name        string
+		Interval    time.Duration
+		Cron        string
+		Window      *Window
+		ExpectedErr error
+	}
+
+	testCases := []testCase{
+		{Name: "Interval", Interval: 10 * time.Second},
+		{Name: "Cron", Cron: "*/5 * * * *"},
+		{Name: "Window", Interval: time.Second, Window: &Window{Start: "08:00", End: "17:00"}},
+		{Name: "Both", Interval: time.Second, Cron: "* * * * *", ExpectedErr: ErrIntervalAndCron},
+		{Name: "Negative", Interval: -time.Second, ExpectedErr: ErrNegativeInterval},
+		{Name: "BadWindow", Interval: time.Second, Window: &Window{Start: "8", End: "17:00"}, ExpectedErr: ErrBadWindow},
+		{Name: "NeverMatches", Cron: "0 0 30 2 *", ExpectedErr: ErrCronNeverMatches},
+	}
+
+	for _, tc := range testCases {
+		_, err := New(tc.Interval, tc.Cron, tc.Window)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.ExpectedErr, err)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	day := &Window{Start: "08:00", End: "17:00"}
+	night := &Window{Start: "22:00", End: "06:00"}
+	if err := day.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := night.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	morning := time.Date(2021, 1, 4, 7, 30, 0, 0, time.UTC)
+	noon := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	late := time.Date(2021, 1, 4, 23, 0, 0, 0, time.UTC)
+
+	if day.Contains(morning) || !day.Contains(noon) || day.Contains(late) {
+		t.Fatal("day window contains the wrong times")
+	}
+	if night.Contains(morning) || night.Contains(noon) || !night.Contains(late) {
+		t.Fatal("night window contains the wrong times")
+	}
+	if !day.NextOpen(morning).Equal(time.Date(2021, 1, 4, 8, 0, 0, 0, time.UTC)) {
+		t.Fatal("day window should open at 08:00 the same day")
+	}
+	if !day.NextOpen(late).Equal(time.Date(2021, 1, 5, 8, 0, 0, 0, time.UTC)) {
+		t.Fatal("day window should open at 08:00 the next day")
+	}
+	if !day.NextOpen(noon).Equal(noon) {
+		t.Fatal("an open window should return the same time")
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	interval, err := New(10*time.Second, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interval.First(now).Equal(now) {
+		t.Fatal("interval schedules should run right away")
+	}
+	if !interval.Next(now).Equal(now.Add(10 * time.Second)) {
+		t.Fatal("wrong next interval execution")
+	}
+
+	windowed, err := New(time.Hour, "", &Window{Start: "08:00", End: "13:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !windowed.Next(now.Add(30 * time.Minute)).Equal(time.Date(2021, 1, 5, 8, 0, 0, 0, time.UTC)) {
+		t.Fatal("interval outside window should wait for the window to open")
+	}
+
+	cron, err := New(0, "0 * * * *", &Window{Start: "22:00", End: "02:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cron.First(now).Equal(time.Date(2021, 1, 4, 22, 0, 0, 0, time.UTC)) {
+		t.Fatal("cron should wait for the window to open, got ", cron.First(now))
+	}
+	if !cron.Next(time.Date(2021, 1, 5, 1, 0, 0, 0, time.UTC)).Equal(time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC)) {
+		t.Fatal("cron should skip to the next window")
+	}
+}
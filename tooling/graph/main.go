@@ -0,0 +1,66 @@
+// This tool is used to draw how the processors in a go4data file are connected
+// The graph is written to stdout in Graphviz DOT or Mermaid
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/percybolmer/go4data"
+	"github.com/percybolmer/go4data/register"
+)
+
+func main() {
+	var path string
+	var format string
+
+	flag.StringVar(&path, "go4data", "", "the path to the go4data YAML file to draw")
+	flag.StringVar(&format, "format", "dot", "the format of the graph, dot or mermaid")
+	flag.Parse()
+
+	if path == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
+	loaders, err := go4data.LoadLoaders(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var procs []*go4data.Processor
+	for _, la := range loaders {
+		proc, err := drawable(la)
+		if err != nil {
+			log.Fatalf("%s: %v", la.Name, err)
+		}
+		procs = append(procs, proc)
+	}
+	if err := go4data.WriteGraph(os.Stdout, go4data.GraphFormat(format), procs...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// drawable creates a processor with the topics, subscriptions and properties of the loader
+// Unlike ConvertToProcessor the configuration is not validated, so files that refers to paths or hosts on other machines can still be drawn
+func drawable(la *go4data.LoaderProccessor) (*go4data.Processor, error) {
+	proc := go4data.NewProcessor(la.Name, la.Topics...)
+	proc.Relationships = la.Relationships
+	proc.Group = la.Group
+	handler, err := register.GetHandler(la.Handler.Name)
+	if err != nil {
+		return nil, err
+	}
+	proc.SetHandler(handler)
+	if la.Handler.Cfg != nil {
+		cfg := handler.GetConfiguration()
+		for _, prop := range la.Handler.Cfg.Properties {
+			if err := cfg.SetProperty(prop.Name, prop.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := proc.Subscribe(la.Subscriptions...); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percybolmer/go4data"
+	"github.com/percybolmer/go4data/property"
+	"gopkg.in/yaml.v3"
+)
+
+// api is the management API of the runner, it controls the processors of a pipeline
+//
+//	GET  /api/processors                      lists all processors
+//	GET  /api/processors/{id or name}         shows one processor
+//	POST /api/processors/{id or name}/start   starts the processor, stop, pause and resume works the same way
+//	PUT  /api/processors/{id or name}/properties   changes the properties of the Handler, the body is a JSON or YAML map
+//	GET  /api/queues                          shows how many payloads are queued per topic and processor
+//	GET  /api/config                          returns the current configuration as a go4data yaml file
+type api struct {
+	ctx      context.Context
+	pipeline *go4data.Pipeline
+	// drain is how long a processor gets to empty its queues when stopped through the API
+	drain time.Duration
+}
+
+// queueDepth is how many payloads are queued on a topic for a processor
+type queueDepth struct {
+	Topic     string `json:"topic"`
+	Processor uint   `json:"processor"`
+	Name      string `json:"name"`
+	Queued    int    `json:"queued"`
+	QueueSize int    `json:"queuesize"`
+}
+
+// newAPI creates the handler for the management API, ctx is used when starting processors
+func newAPI(ctx context.Context, pipeline *go4data.Pipeline, drain time.Duration) http.Handler {
+	a := &api{
+		ctx:      ctx,
+		pipeline: pipeline,
+		drain:    drain,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/processors", a.listProcessors)
+	mux.HandleFunc("/api/processors/", a.processor)
+	mux.HandleFunc("/api/queues", a.queues)
+	mux.HandleFunc("/api/config", a.config)
+	return mux
+}
+
+// listProcessors writes all processors as JSON
+func (a *api) listProcessors(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, a.pipeline.ConvertToLoaders())
+}
+
+// processor handles the requests for one processor
+func (a *api) processor(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/processors/"), "/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	proc := a.find(parts[0])
+	if proc == nil {
+		http.Error(w, go4data.ErrNoSuchProcessor.Error(), http.StatusNotFound)
+		return
+	}
+	if len(parts) == 1 {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, proc.ConvertToLoader())
+		}
+		return
+	}
+
+	var err error
+	switch parts[1] {
+	case "start":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if proc.IsRunning() {
+			err = errors.New("the processor is already running")
+		} else {
+			err = proc.Start(a.ctx)
+		}
+	case "stop":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), a.drain)
+		_, err = proc.StopGraceful(ctx)
+		cancel()
+	case "pause":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		err = proc.Pause()
+	case "resume":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		err = proc.Resume()
+	case "properties":
+		if !allowMethod(w, r, http.MethodPut) {
+			return
+		}
+		err = a.setProperties(r, proc)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, proc.ConvertToLoader())
+}
+
+// setProperties reads the new properties from the body and applies them
+// The body is decoded as YAML, which JSON also is, so values gets the same types as when loaded from a go4data file
+func (a *api) setProperties(r *http.Request, proc *go4data.Processor) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return &badRequest{err: err}
+	}
+	if len(values) == 0 {
+		return &badRequest{err: errors.New("no properties to set")}
+	}
+	return proc.SetProperties(values)
+}
+
+// queues writes the amount of queued payloads per topic and processor as JSON
+func (a *api) queues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	depths := make([]queueDepth, 0)
+	for _, proc := range a.pipeline.StartOrder() {
+		for topic, queued := range proc.QueueDepths() {
+			depths = append(depths, queueDepth{
+				Topic:     topic,
+				Processor: proc.ID,
+				Name:      proc.Name,
+				Queued:    queued,
+				QueueSize: proc.QueueSize,
+			})
+		}
+	}
+	sort.Slice(depths, func(i, j int) bool {
+		if depths[i].Topic != depths[j].Topic {
+			return depths[i].Topic < depths[j].Topic
+		}
+		return depths[i].Processor < depths[j].Processor
+	})
+	writeJSON(w, depths)
+}
+
+// config writes the current configuration of the pipeline as YAML
+func (a *api) config(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	data, err := yaml.Marshal(a.pipeline.ConvertToLoaders())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// find returns the processor with the ID, or the name if ref is not a number
+func (a *api) find(ref string) *go4data.Processor {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		if proc := a.pipeline.GetProcessor(uint(id)); proc != nil {
+			return proc
+		}
+	}
+	return a.pipeline.GetProcessorByName(ref)
+}
+
+// badRequest is an error caused by the request itself
+type badRequest struct {
+	err error
+}
+
+// Error is used to be part of error interface
+func (br *badRequest) Error() string {
+	return br.err.Error()
+}
+
+// writeError writes the error with a status code that fits it
+func writeError(w http.ResponseWriter, err error) {
+	var br *badRequest
+	status := http.StatusConflict
+	switch {
+	case errors.As(err, &br), errors.Is(err, property.ErrNoSuchProperty):
+		status = http.StatusBadRequest
+	case errors.Is(err, go4data.ErrRequiredPropertiesNotFulfilled):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeJSON writes v as JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// allowMethod writes a 405 and returns false if the request does not use the method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "only "+method+" is allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
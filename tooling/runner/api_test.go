@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/percybolmer/go4data"
+	"github.com/percybolmer/go4data/payload"
+	"gopkg.in/yaml.v3"
+)
+
+const apiPipeline = `
+- id: 1
+  name: printer
+  topics:
+    - api_printed
+  subscriptions:
+    - api_in
+  queuesize: 10
+  handler:
+    configs:
+      properties:
+        - name: forward
+          value: true
+    handler_name: Stdout
+- id: 2
+  name: sink
+  subscriptions:
+    - api_printed
+  queuesize: 10
+  handler:
+    configs:
+      properties:
+        - name: forward
+          value: false
+    handler_name: Stdout
+`
+
+// newTestAPI loads and starts a pipeline in its own Environment and serves the API for it
+func newTestAPI(t *testing.T) (*httptest.Server, *go4data.Pipeline, func()) {
+	dir, err := ioutil.TempDir("", "runnerapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "go4data.yml")
+	if err := ioutil.WriteFile(path, []byte(apiPipeline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := go4data.NewEnvironment()
+	pipeline, err := env.LoadPipeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := pipeline.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newAPI(ctx, pipeline, time.Second))
+	return server, pipeline, func() {
+		server.Close()
+		cancel()
+		env.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// do sends a request to the API and returns the status and body
+func do(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestAPIProcessors(t *testing.T) {
+	server, pipeline, cleanup := newTestAPI(t)
+	defer cleanup()
+
+	status, body := do(t, http.MethodGet, server.URL+"/api/processors", "")
+	if status != http.StatusOK {
+		t.Fatal(status, body)
+	}
+	var procs []*go4data.LoaderProccessor
+	if err := json.Unmarshal([]byte(body), &procs); err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 || procs[0].Name != "printer" || !procs[0].Running {
+		t.Fatalf("wrong processors: %s", body)
+	}
+
+	printer := pipeline.GetProcessorByName("printer")
+	type testCase struct {
+		Name           string
+		Method         string
+		Path           string
+		ExpectedStatus int
+		ExpectRunning  bool
+		ExpectPaused   bool
+	}
+	testCases := []testCase{
+		{Name: "GetByName", Method: http.MethodGet, Path: "/api/processors/printer", ExpectedStatus: http.StatusOK, ExpectRunning: true},
+		{Name: "GetByID", Method: http.MethodGet, Path: "/api/processors/" + strconv.FormatUint(uint64(printer.ID), 10), ExpectedStatus: http.StatusOK, ExpectRunning: true},
+		{Name: "NoSuchProcessor", Method: http.MethodGet, Path: "/api/processors/nobody", ExpectedStatus: http.StatusNotFound, ExpectRunning: true},
+		{Name: "NoSuchAction", Method: http.MethodPost, Path: "/api/processors/printer/explode", ExpectedStatus: http.StatusNotFound, ExpectRunning: true},
+		{Name: "WrongMethod", Method: http.MethodGet, Path: "/api/processors/printer/pause", ExpectedStatus: http.StatusMethodNotAllowed, ExpectRunning: true},
+		{Name: "Pause", Method: http.MethodPost, Path: "/api/processors/printer/pause", ExpectedStatus: http.StatusOK, ExpectRunning: true, ExpectPaused: true},
+		{Name: "PauseAgain", Method: http.MethodPost, Path: "/api/processors/printer/pause", ExpectedStatus: http.StatusConflict, ExpectRunning: true, ExpectPaused: true},
+		{Name: "Resume", Method: http.MethodPost, Path: "/api/processors/printer/resume", ExpectedStatus: http.StatusOK, ExpectRunning: true},
+		{Name: "Stop", Method: http.MethodPost, Path: "/api/processors/printer/stop", ExpectedStatus: http.StatusOK},
+		{Name: "StopAgain", Method: http.MethodPost, Path: "/api/processors/printer/stop", ExpectedStatus: http.StatusConflict},
+		{Name: "Start", Method: http.MethodPost, Path: "/api/processors/printer/start", ExpectedStatus: http.StatusOK, ExpectRunning: true},
+		{Name: "StartAgain", Method: http.MethodPost, Path: "/api/processors/printer/start", ExpectedStatus: http.StatusConflict, ExpectRunning: true},
+	}
+
+	for _, tc := range testCases {
+		status, body := do(t, tc.Method, server.URL+tc.Path, "")
+		if status != tc.ExpectedStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", tc.Name, tc.ExpectedStatus, status, body)
+		}
+		if printer.IsRunning() != tc.ExpectRunning || printer.IsPaused() != tc.ExpectPaused {
+			t.Fatalf("%s: wrong state, running %v paused %v", tc.Name, printer.IsRunning(), printer.IsPaused())
+		}
+	}
+}
+
+func TestAPIProperties(t *testing.T) {
+	server, pipeline, cleanup := newTestAPI(t)
+	defer cleanup()
+	url := server.URL + "/api/processors/printer/properties"
+
+	if status, body := do(t, http.MethodPut, url, `{"forward": false}`); status != http.StatusConflict {
+		t.Fatal("running processors should not be changed: ", status, body)
+	}
+	if status, body := do(t, http.MethodPost, server.URL+"/api/processors/printer/stop", ""); status != http.StatusOK {
+		t.Fatal(status, body)
+	}
+
+	type testCase struct {
+		Name           string
+		Body           string
+		ExpectedStatus int
+		ExpectedValue  interface{}
+	}
+	testCases := []testCase{
+		{Name: "Valid", Body: `{"forward": false}`, ExpectedStatus: http.StatusOK, ExpectedValue: false},
+		{Name: "YAML", Body: "forward: true", ExpectedStatus: http.StatusOK, ExpectedValue: true},
+		{Name: "WrongType", Body: `{"forward": "sometimes"}`, ExpectedStatus: http.StatusUnprocessableEntity, ExpectedValue: true},
+		{Name: "NoSuchProperty", Body: `{"backward": true}`, ExpectedStatus: http.StatusBadRequest, ExpectedValue: true},
+		{Name: "Empty", Body: ``, ExpectedStatus: http.StatusBadRequest, ExpectedValue: true},
+		{Name: "NotAMap", Body: `[1, 2]`, ExpectedStatus: http.StatusBadRequest, ExpectedValue: true},
+	}
+	printer := pipeline.GetProcessorByName("printer")
+	for _, tc := range testCases {
+		status, body := do(t, http.MethodPut, url, tc.Body)
+		if status != tc.ExpectedStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", tc.Name, tc.ExpectedStatus, status, body)
+		}
+		if value := printer.GetConfiguration().GetProperty("forward").Value; value != tc.ExpectedValue {
+			t.Fatalf("%s: forward should be %v, got %v", tc.Name, tc.ExpectedValue, value)
+		}
+	}
+}
+
+func TestAPIQueuesAndConfig(t *testing.T) {
+	server, pipeline, cleanup := newTestAPI(t)
+	defer cleanup()
+
+	if err := pipeline.Pause(pipeline.GetProcessorByName("printer").ID); err != nil {
+		t.Fatal(err)
+	}
+	env := pipeline.GetProcessorByName("printer").Environment()
+	for i := 0; i < 3; i++ {
+		env.Publish("api_in", payload.NewBasePayload([]byte(`queued`), "test", nil))
+	}
+
+	status, body := do(t, http.MethodGet, server.URL+"/api/queues", "")
+	if status != http.StatusOK {
+		t.Fatal(status, body)
+	}
+	var depths []queueDepth
+	if err := json.Unmarshal([]byte(body), &depths); err != nil {
+		t.Fatal(err)
+	}
+	if len(depths) != 2 || depths[0].Topic != "api_in" || depths[0].Queued != 3 || depths[0].QueueSize != 10 || depths[0].Name != "printer" {
+		t.Fatalf("wrong queue depths: %s", body)
+	}
+
+	status, body = do(t, http.MethodGet, server.URL+"/api/config", "")
+	if status != http.StatusOK {
+		t.Fatal(status, body)
+	}
+	var loaders []*go4data.LoaderProccessor
+	if err := yaml.Unmarshal([]byte(body), &loaders); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaders) != 2 || loaders[0].Handler.Name != "Stdout" || !loaders[0].Paused {
+		t.Fatalf("wrong config: %s", body)
+	}
+}
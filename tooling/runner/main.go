@@ -8,8 +8,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/percybolmer/go4data"
+	"github.com/percybolmer/go4data/pubsub"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -18,9 +22,19 @@ func main() {
 
 	var path string
 	var port int
+	var drain time.Duration
+	var watch bool
+	var blocking bool
+	var publishTimeout time.Duration
+	var events bool
 
 	flag.StringVar(&path, "go4data", "", "the path to the go4data YAML file to run")
 	flag.IntVar(&port, "port", 0, "the port to host the prometheus metrics on")
+	flag.BoolVar(&watch, "watch", false, "reload the processors when the go4data file is changed")
+	flag.BoolVar(&blocking, "blocking", false, "make publishers wait for room in full queues instead of dropping payloads")
+	flag.DurationVar(&publishTimeout, "publishtimeout", 0, "the longest time a blocked publisher waits, 0 waits until the processor is stopped")
+	flag.BoolVar(&events, "events", false, "log when processors start, stop, fail validation or have failures")
+	flag.DurationVar(&drain, "drain", 30*time.Second, "how long to wait for processors to empty their queues when shutting down")
 
 	flag.Parse()
 
@@ -37,21 +51,73 @@ func main() {
 	if err != nil {
 		panic(err)
 	}*/
+	if blocking {
+		if _, err := pubsub.NewEngine(pubsub.WithDefaultEngine(2), pubsub.WithBlockingDelivery(publishTimeout)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if events {
+		stream, _ := go4data.SubscribeEvents(100)
+		go logEvents(stream)
+	}
 	log.Println("Setting up go4data")
-	wf, err := go4data.Load(path)
+	pipeline, err := go4data.LoadPipeline(path)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, warning := range pipeline.Warnings {
+		log.Println("Warning:", warning)
+	}
 
 	ctx := context.Background()
-	for _, proc := range wf {
-		if err := proc.Start(ctx); err != nil {
+	if err := pipeline.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if watch {
+		errs, err := pipeline.Watch(ctx, path, 2*time.Second)
+		if err != nil {
 			log.Fatal(err)
 		}
+		go func() {
+			for err := range errs {
+				log.Println("Failed to reload, keeping old configuration:", err)
+			}
+		}()
 	}
-	log.Println("Starting the Metrics API at /metrics")
+	log.Println("Starting the Metrics API at /metrics and the management API at /api/processors")
 
 	// @TODO better Error Handeling when running the runner.
 	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	http.Handle("/api/", newAPI(ctx, pipeline, drain))
+	go func() {
+		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	}()
+
+	// Wait for shutdown and let the processors drain their queues
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	log.Println("Shutting down, draining processors")
+	drainCtx, cancel := context.WithTimeout(ctx, drain)
+	defer cancel()
+	dropped, err := pipeline.Stop(drainCtx)
+	if err != nil {
+		log.Println(err)
+	}
+	if dropped != 0 {
+		log.Printf("dropped %d payloads", dropped)
+	}
+}
+
+// logEvents prints the lifecycle Events of the processors, processed payloads are skipped since there are too many of them
+func logEvents(stream <-chan go4data.Event) {
+	for e := range stream {
+		switch e.Type {
+		case go4data.EventPayloadProcessed:
+		case go4data.EventValidationFailed, go4data.EventFailure:
+			log.Printf("Event: %s %s(%d): %v", e.Type, e.Name, e.Processor, e.Err)
+		default:
+			log.Printf("Event: %s %s(%d)", e.Type, e.Name, e.Processor)
+		}
+	}
 }